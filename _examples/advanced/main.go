@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"github.com/yourorg/lugo"
@@ -113,7 +112,7 @@ func main() {
 	}
 
 	// Load environment-specific overrides
-	if err := cfg.LoadFile(ctx, fmt.Sprintf("config.%s.lua", cfg.Environment())); err != nil && !os.IsNotExist(err) {
+	if err := cfg.LoadFileIfExists(ctx, fmt.Sprintf("config.%s.lua", cfg.Environment())); err != nil {
 		log.Fatal(err)
 	}
 
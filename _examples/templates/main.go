@@ -30,7 +30,7 @@ func main() {
 	defer cfg.Close()
 
 	// Template variables
-	vars := lugo.TemplateConfig{
+	vars := map[string]interface{}{
 		"env":        os.Getenv("APP_ENV"),
 		"db_host":    os.Getenv("DB_HOST"),
 		"db_pass":    os.Getenv("DB_PASSWORD"),
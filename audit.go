@@ -0,0 +1,97 @@
+package lugo
+
+import (
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// AuditRecord describes a single invocation of a registered function
+type AuditRecord struct {
+	Function string        // Registered function name (including namespace)
+	Args     []interface{} // Arguments, after redaction if a redactor is set
+	Results  []interface{} // Returned values
+	Error    error         // Error returned or raised by the function
+	Duration time.Duration // Time spent in the function
+	Source   string        // Calling Lua source location, e.g. "config.lua:12"
+}
+
+// AuditRedactor rewrites the arguments of a call before they are recorded
+type AuditRedactor func(function string, args []interface{}) []interface{}
+
+// WithCallAudit emits an AuditRecord for every registered function invocation
+func WithCallAudit(fn func(AuditRecord)) Option {
+	return func(c *Config) {
+		c.auditFn = fn
+	}
+}
+
+// WithAuditRedactor sets a redactor applied to arguments before they are audited
+func WithAuditRedactor(redactor AuditRedactor) Option {
+	return func(c *Config) {
+		c.auditRedactor = redactor
+	}
+}
+
+// callAudit tracks one in-flight call. A nil *callAudit is valid and does nothing,
+// so callers do not need to check whether auditing is enabled.
+type callAudit struct {
+	cfg    *Config
+	record AuditRecord
+	start  time.Time
+	done   bool
+}
+
+// beginAudit starts auditing a call, capturing its arguments and call site
+func (c *Config) beginAudit(name string, L *lua.LState) *callAudit {
+	if c.auditFn == nil {
+		return nil
+	}
+
+	args := make([]interface{}, L.GetTop())
+	for i := range args {
+		args[i] = c.auditValue(L.Get(i + 1))
+	}
+	if c.auditRedactor != nil {
+		args = c.auditRedactor(name, args)
+	}
+
+	return &callAudit{
+		cfg: c,
+		record: AuditRecord{
+			Function: name,
+			Args:     args,
+			Source:   strings.TrimSuffix(L.Where(1), ":"),
+		},
+		start: time.Now(),
+	}
+}
+
+// finish emits the audit record. Only the first call has any effect.
+func (a *callAudit) finish(results []lua.LValue, err error) {
+	if a == nil || a.done {
+		return
+	}
+	a.done = true
+
+	a.record.Duration = time.Since(a.start)
+	a.record.Error = err
+	if len(results) > 0 {
+		a.record.Results = make([]interface{}, len(results))
+		for i, lv := range results {
+			a.record.Results[i] = a.cfg.auditValue(lv)
+		}
+	}
+
+	a.cfg.auditFn(a.record)
+}
+
+// auditValue converts a Lua value for recording, falling back to its string form
+func (c *Config) auditValue(lv lua.LValue) interface{} {
+	v, err := c.luaToGo(lv, interfaceType)
+	if err != nil {
+		return lv.String()
+	}
+	return v
+}
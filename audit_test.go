@@ -0,0 +1,67 @@
+package lugo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestCallAudit(t *testing.T) {
+	var records []AuditRecord
+
+	cfg := New(
+		WithCallAudit(func(r AuditRecord) {
+			records = append(records, r)
+		}),
+		WithAuditRedactor(func(function string, args []interface{}) []interface{} {
+			if function == "login" {
+				return []interface{}{args[0], "[REDACTED]"}
+			}
+			return args
+		}),
+	)
+	defer cfg.Close()
+
+	require.NoError(t, cfg.RegisterFunction(context.Background(), "add", func(a, b int) int {
+		return a + b
+	}))
+	require.NoError(t, cfg.RegisterFunction(context.Background(), "login", func(user, password string) error {
+		return errors.New("denied")
+	}))
+	require.NoError(t, cfg.RegisterFunctionTable(context.Background(), "utils", map[string]interface{}{
+		"upper": func(s string) string { return s + "!" },
+	}))
+	require.NoError(t, cfg.RegisterLuaFunctionWithOptions("ping", func(L *lua.LState) int {
+		L.Push(lua.LString("pong"))
+		return 1
+	}, FunctionOptions{Namespace: "net"}))
+
+	require.NoError(t, cfg.DoString(`
+		local sum = add(2, 3)
+		local s = utils.upper("hi")
+		local p = net.ping()
+		pcall(login, "alice", "hunter2")
+	`))
+
+	require.Len(t, records, 4)
+
+	assert.Equal(t, "add", records[0].Function)
+	assert.Equal(t, []interface{}{float64(2), float64(3)}, records[0].Args)
+	assert.Equal(t, []interface{}{float64(5)}, records[0].Results)
+	assert.NoError(t, records[0].Error)
+	assert.Equal(t, "<string>:2", records[0].Source)
+
+	assert.Equal(t, "utils.upper", records[1].Function)
+	assert.Equal(t, []interface{}{"hi!"}, records[1].Results)
+
+	assert.Equal(t, "net.ping", records[2].Function)
+	assert.Equal(t, []interface{}{"pong"}, records[2].Results)
+
+	assert.Equal(t, "login", records[3].Function)
+	assert.Equal(t, []interface{}{"alice", "[REDACTED]"}, records[3].Args)
+	assert.EqualError(t, records[3].Error, "denied")
+}
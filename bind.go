@@ -0,0 +1,82 @@
+package lugo
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// FieldApplier applies a changed configuration value to a live subsystem
+type FieldApplier func(newValue interface{}) error
+
+// fieldBinding tracks the value last applied for a bound path
+type fieldBinding struct {
+	path    string
+	apply   FieldApplier
+	value   interface{}
+	applied bool
+}
+
+// BindField calls applier with the value at the dotted path whenever a
+// LoadFile, including a reload by a ConfigWatcher, leaves it different from
+// the value last applied. The first load that sets the path applies it too,
+// and a load that removes it applies nil. Whole numbers are passed as int,
+// other numbers as float64, and tables converted with the same rules as Call
+// results. An applier that fails makes LoadFile return its error, and is
+// retried on the next load.
+func (c *Config) BindField(path string, applier FieldApplier) error {
+	if _, err := splitPath(path); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bindings = append(c.bindings, &fieldBinding{path: path, apply: applier})
+	return nil
+}
+
+// applyBindings calls the appliers of bound fields whose value changed
+func (c *Config) applyBindings() error {
+	c.mu.RLock()
+	bindings := c.bindings
+	c.mu.RUnlock()
+
+	for _, b := range bindings {
+		c.mu.RLock()
+		value, err := c.bindingValue(c.lookupPath(b.path))
+		c.mu.RUnlock()
+		if err != nil {
+			return &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("failed to convert bound field '%s'", b.path),
+				Cause:   err,
+			}
+		}
+
+		if b.applied && reflect.DeepEqual(value, b.value) {
+			continue
+		}
+		if err := b.apply(value); err != nil {
+			return &Error{
+				Code:    ErrExecution,
+				Message: fmt.Sprintf("failed to apply '%s'", b.path),
+				Cause:   err,
+			}
+		}
+		b.value, b.applied = value, true
+	}
+	return nil
+}
+
+// bindingValue converts lv into the value passed to a FieldApplier
+func (c *Config) bindingValue(lv lua.LValue) (interface{}, error) {
+	if lv == lua.LNil {
+		return nil, nil
+	}
+	if n, ok := lv.(lua.LNumber); ok && float64(n) == math.Trunc(float64(n)) && math.Abs(float64(n)) < 1<<53 {
+		return int(n), nil
+	}
+	return c.luaToGo(lv, interfaceType)
+}
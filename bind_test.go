@@ -0,0 +1,56 @@
+package lugo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindField(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	var applied []interface{}
+	var failNext bool
+	require.NoError(t, cfg.BindField("limits.max_connections", func(v interface{}) error {
+		if failNext {
+			failNext = false
+			return errors.New("pool busy")
+		}
+		applied = append(applied, v)
+		return nil
+	}))
+	assert.True(t, IsErrorCode(cfg.BindField("limits.", nil), ErrInvalidType))
+
+	path := filepath.Join(t.TempDir(), "limits.lua")
+	load := func(script string) error {
+		require.NoError(t, os.WriteFile(path, []byte(script), 0644))
+		return cfg.LoadFile(context.Background(), path)
+	}
+
+	require.NoError(t, load(`limits = { max_connections = 100, rate = 5 }`))
+	assert.Equal(t, []interface{}{100}, applied)
+
+	// Unrelated changes do not invoke the applier
+	require.NoError(t, load(`limits = { max_connections = 100, rate = 10 }`))
+	assert.Equal(t, []interface{}{100}, applied)
+
+	require.NoError(t, load(`limits = { max_connections = 250 }`))
+	assert.Equal(t, []interface{}{100, 250}, applied)
+
+	// A failed apply is reported and retried on the next load
+	failNext = true
+	err := load(`limits = { max_connections = 300 }`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pool busy")
+	require.NoError(t, load(`limits = { max_connections = 300 }`))
+	assert.Equal(t, []interface{}{100, 250, 300}, applied)
+
+	require.NoError(t, load(`limits = nil`))
+	assert.Equal(t, []interface{}{100, 250, 300, nil}, applied)
+}
@@ -0,0 +1,153 @@
+package lugo
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+// decodeCache holds the values decoded by Get, keyed by global, target type
+// and strictness, each tagged with the config version it was decoded at
+type decodeCache struct {
+	mu      sync.Mutex
+	entries map[decodeKey]decodeEntry
+}
+
+type decodeKey struct {
+	name   string
+	typ    reflect.Type
+	strict bool
+}
+
+type decodeEntry struct {
+	version uint64
+	value   reflect.Value
+}
+
+// WithDecodeCache makes Get remember the value it decoded for a global and
+// target type, and copy it into later targets of the same type until a load
+// or another change to the globals, as in WithStatePool, makes it stale.
+// Targets are never shared with the cache. Only targets that hold their zero
+// value use the cache, since Get keeps the fields of a struct target that the
+// config does not set.
+func WithDecodeCache(enabled bool) Option {
+	return func(c *Config) {
+		if !enabled {
+			c.decodeCache = nil
+			return
+		}
+		c.decodeCache = &decodeCache{entries: make(map[decodeKey]decodeEntry)}
+	}
+}
+
+// changed records that the globals changed, so cached decodes and pooled
+// replicas are rebuilt
+func (c *Config) changed() {
+	c.version.Add(1)
+	c.pool.invalidate()
+}
+
+// get implements Get, rejecting unknown keys if strict is set
+func (c *Config) get(ctx context.Context, name string, target interface{}, strict bool) error {
+	val := reflect.ValueOf(target)
+	if c.decodeCache == nil || val.Kind() != reflect.Ptr || val.IsNil() || !val.Elem().IsZero() {
+		return c.decode(ctx, name, target, strict)
+	}
+
+	key := decodeKey{name: name, typ: val.Type(), strict: strict}
+	version := c.version.Load()
+	if c.decodeCache.load(key, version, val.Elem()) {
+		return nil
+	}
+	if err := c.decode(ctx, name, target, strict); err != nil {
+		return err
+	}
+	c.decodeCache.store(key, version, val.Elem())
+	return nil
+}
+
+// load copies the entry for key into dst if it is current with version
+func (dc *decodeCache) load(key decodeKey, version uint64, dst reflect.Value) bool {
+	dc.mu.Lock()
+	entry, ok := dc.entries[key]
+	dc.mu.Unlock()
+	if !ok || entry.version != version {
+		return false
+	}
+	dst.Set(deepCopy(entry.value))
+	return true
+}
+
+// store records a copy of value as the entry for key at version
+func (dc *decodeCache) store(key decodeKey, version uint64, value reflect.Value) {
+	entry := decodeEntry{version: version, value: deepCopy(value)}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if current, ok := dc.entries[key]; !ok || current.version <= version {
+		dc.entries[key] = entry
+	}
+}
+
+// deepCopy returns a copy of v sharing no pointers, slices or maps with it.
+// Unexported struct fields are copied shallowly.
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		switch x := v.Interface().(type) {
+		case *big.Int:
+			return reflect.ValueOf(new(big.Int).Set(x))
+		case *big.Float:
+			return reflect.ValueOf(new(big.Float).Copy(x))
+		}
+		cp := reflect.New(v.Type().Elem())
+		cp.Elem().Set(deepCopy(v.Elem()))
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(deepCopy(v.Elem()))
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return cp
+	case reflect.Array:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				cp.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return cp
+	default:
+		return v
+	}
+}
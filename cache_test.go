@@ -0,0 +1,142 @@
+package lugo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cachedServer struct {
+	Host  string            `lua:"host"`
+	Ports []int             `lua:"ports"`
+	Tags  map[string]string `lua:"tags"`
+	TLS   *struct {
+		Cert string `lua:"cert"`
+	} `lua:"tls"`
+}
+
+func TestDecodeCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`
+		server = { host = "a", ports = { 80, 443 }, tags = { env = "prod" }, tls = { cert = "a.crt" } }
+	`), 0644))
+
+	cfg := New(WithDecodeCache(true))
+	defer cfg.Close()
+	require.NoError(t, cfg.LoadFile(context.Background(), path))
+
+	var first cachedServer
+	require.NoError(t, cfg.Get(context.Background(), "server", &first))
+	assert.Equal(t, "a", first.Host)
+
+	// Cached values are copies, so changing one result leaves the next intact
+	first.Ports[0] = 8080
+	first.Tags["env"] = "dev"
+	first.TLS.Cert = "changed"
+	var second cachedServer
+	require.NoError(t, cfg.Get(context.Background(), "server", &second))
+	assert.Equal(t, []int{80, 443}, second.Ports)
+	assert.Equal(t, map[string]string{"env": "prod"}, second.Tags)
+	assert.Equal(t, "a.crt", second.TLS.Cert)
+
+	// A target holding values is decoded into, keeping unset fields
+	partial := cachedServer{Host: "kept", Tags: map[string]string{"team": "core"}}
+	require.NoError(t, cfg.L.DoString(`other = { ports = { 1 } }`))
+	require.NoError(t, cfg.Get(context.Background(), "other", &partial))
+	assert.Equal(t, "kept", partial.Host)
+
+	// A reload invalidates the cache
+	require.NoError(t, os.WriteFile(path, []byte(`server = { host = "b" }`), 0644))
+	require.NoError(t, cfg.LoadFile(context.Background(), path))
+	var reloaded cachedServer
+	require.NoError(t, cfg.Get(context.Background(), "server", &reloaded))
+	assert.Equal(t, cachedServer{Host: "b"}, reloaded)
+
+	// So does SetGlobal
+	require.NoError(t, cfg.SetGlobal("server", map[string]interface{}{"host": "c"}))
+	var set cachedServer
+	require.NoError(t, cfg.Get(context.Background(), "server", &set))
+	assert.Equal(t, "c", set.Host)
+}
+
+func TestDecodeCacheInvalidatedByMutators(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(cfg *Config) error
+		want   string
+	}{
+		{"Unflatten", func(cfg *Config) error {
+			return cfg.Unflatten("server", map[string]interface{}{"host": "b"})
+		}, "b"},
+		{"Prune", func(cfg *Config) error {
+			require.NoError(t, cfg.L.DoString(`server.host = "b"`))
+			return cfg.Prune("server")
+		}, "b"},
+		{"TableBuilder", func(cfg *Config) error {
+			return cfg.RegisterGlobalTable("server").Set("host", "b").Build()
+		}, "b"},
+		{"RegisterConstants", func(cfg *Config) error {
+			return cfg.RegisterConstants(map[string]interface{}{"server": map[string]interface{}{"host": "b"}})
+		}, "b"},
+		{"RegisterConstantTable", func(cfg *Config) error {
+			return cfg.RegisterConstantTable("server", map[string]interface{}{"host": "b"})
+		}, ""},
+		{"RegisterType", func(cfg *Config) error {
+			return cfg.RegisterType(context.Background(), "server", cachedServer{}, cachedServer{Host: "b"})
+		}, "b"},
+		{"Call", func(cfg *Config) error {
+			_, err := cfg.Call("rename", "b")
+			return err
+		}, "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := New(WithDecodeCache(true))
+			defer cfg.Close()
+			require.NoError(t, cfg.DoString(`
+				server = { host = "a" }
+				function rename(host) server.host = host end
+			`))
+
+			var before cachedServer
+			require.NoError(t, cfg.Get(context.Background(), "server", &before))
+			assert.Equal(t, "a", before.Host)
+
+			require.NoError(t, tt.mutate(cfg))
+			var after cachedServer
+			require.NoError(t, cfg.Get(context.Background(), "server", &after))
+			assert.Equal(t, tt.want, after.Host)
+		})
+	}
+}
+
+func BenchmarkDecodeCache(b *testing.B) {
+	for _, cached := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cached=%v", cached), func(b *testing.B) {
+			cfg := New(WithDecodeCache(cached))
+			defer cfg.Close()
+			require.NoError(b, cfg.DoString(`
+				server = {
+					host = "localhost",
+					ports = { 80, 443, 8080, 8443 },
+					tags = { env = "prod", team = "core", region = "eu" },
+					tls = { cert = "server.crt" },
+				}
+			`))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var server cachedServer
+				if err := cfg.Get(context.Background(), "server", &server); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package lugo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// DecodeOptions controls how GetInto maps Lua values onto Go values
+type DecodeOptions struct {
+	// TagName is the struct tag holding Lua key names, e.g. "config" or
+	// "json". It defaults to "lua". Untagged fields use their lowercased
+	// name, a "-" tag skips the field, and options after a comma are ignored.
+	TagName string
+	// WeaklyTyped coerces between strings, numbers and booleans where the
+	// target field requires it. It is always on with WithWeaklyTypedInput.
+	WeaklyTyped bool
+	// DisallowUnknownKeys makes decoding fail when a table has keys that do
+	// not match any field of the struct it is decoded into
+	DisallowUnknownKeys bool
+	// Lenient skips slice elements and map entries that cannot be converted
+	// instead of failing. It is always on with WithLenientDecoding.
+	Lenient bool
+	// ZeroBasedArrays decodes an index 0 in an array table as the first
+	// element. Otherwise such a table fails to decode into a slice, and
+	// decodes into interface{} as a map. It is always on with
+	// WithZeroBasedArrays.
+	ZeroBasedArrays bool
+	// InternStrings interns decoded strings so identical strings share
+	// storage. It is always on with WithStringInterning.
+	InternStrings bool
+}
+
+// decoder carries the options and cycle-tracking state of a single decode
+type decoder struct {
+	opts DecodeOptions
+	seen map[*lua.LTable]bool
+}
+
+// newDecoder returns a decoder with the config-wide defaults
+func (c *Config) newDecoder() *decoder {
+	return &decoder{opts: DecodeOptions{
+		WeaklyTyped:     c.weaklyTyped,
+		Lenient:         c.lenientDecoding,
+		ZeroBasedArrays: c.zeroBased,
+		InternStrings:   c.internStrings,
+	}}
+}
+
+// GetInto decodes the named global into target like Get, but with the tag
+// name, coercion and unknown-key handling given by opts. It checks and
+// validates the value as Get does, so both report the same errors.
+func (c *Config) GetInto(ctx context.Context, name string, target interface{}, opts DecodeOptions) error {
+	defer c.readLock()()
+
+	lv := c.L.GetGlobal(name)
+	if lv == lua.LNil {
+		return &Error{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("configuration '%s' not found", name),
+		}
+	}
+
+	if c.weaklyTyped {
+		opts.WeaklyTyped = true
+	}
+	if c.lenientDecoding {
+		opts.Lenient = true
+	}
+	if c.zeroBased {
+		opts.ZeroBasedArrays = true
+	}
+	if c.internStrings {
+		opts.InternStrings = true
+	}
+	return c.decodeGlobal(name, lv, target, &decoder{opts: opts})
+}
+
+// tagName returns the struct tag holding Lua keys
+func (d *decoder) tagName() string {
+	if d.opts.TagName == "" {
+		return "lua"
+	}
+	return d.opts.TagName
+}
+
+// fieldKey returns the Lua key for field, or false if the field is skipped
+func (d *decoder) fieldKey(field reflect.StructField) (string, bool) {
+	name, _, _ := strings.Cut(field.Tag.Get(d.tagName()), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return strings.ToLower(field.Name), true
+	}
+	return name, true
+}
+
+// checkUnknownKeys reports keys of table that match no exported field of typ
+func (d *decoder) checkUnknownKeys(table *lua.LTable, typ reflect.Type) error {
+	known := make(map[string]reflect.Type)
+	d.fieldTypes(typ, known)
+
+	var unknown []string
+	table.ForEach(func(k, _ lua.LValue) {
+		if key, ok := k.(lua.LString); !ok || known[string(key)] == nil {
+			unknown = append(unknown, k.String())
+		}
+	})
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown keys for %v: %s", typ, strings.Join(unknown, ", "))
+}
+
+// fieldTypes maps the Lua keys of the exported fields of typ, including those
+// of untagged embedded structs, to the field types
+func (d *decoder) fieldTypes(typ reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if isInlined(field, d.tagName()) {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			d.fieldTypes(embedded, fields)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name, ok := d.fieldKey(field); ok {
+			fields[name] = field.Type
+		}
+	}
+}
+
+// weakScalar coerces a string, number or boolean lv into the Lua type that
+// decodes natively into kind k, using TypeConverter, e.g. "8080" for an int
+// field becomes 8080. Other values are returned unchanged.
+func weakScalar(lv lua.LValue, k reflect.Kind) (lua.LValue, error) {
+	var v interface{}
+	switch x := lv.(type) {
+	case lua.LString:
+		v = strings.TrimSpace(string(x))
+	case lua.LNumber:
+		v = float64(x)
+	case lua.LBool:
+		v = bool(x)
+	default:
+		return lv, nil
+	}
+
+	var tc TypeConverter
+	switch {
+	case k == reflect.String:
+		if _, ok := lv.(lua.LString); ok {
+			return lv, nil
+		}
+		s, err := tc.ToString(v)
+		return lua.LString(s), err
+	case k == reflect.Bool:
+		b, err := tc.ToBool(v)
+		return lua.LBool(b), err
+	case isNumberKind(k):
+		f, err := tc.ToFloat(v)
+		return lua.LNumber(f), err
+	}
+	return lv, nil
+}
+
+// isNumberKind reports whether k is an integer or floating-point kind
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
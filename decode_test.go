@@ -0,0 +1,489 @@
+package lugo
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInto(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		server = {
+			listen_host = "0.0.0.0",
+			listen_port = "8080",
+			timeout = 30,
+			limits = { max_conns = "100" },
+		}
+	`))
+
+	type Limits struct {
+		MaxConns int `config:"max_conns"`
+	}
+	type Server struct {
+		Host    string `config:"listen_host"`
+		Port    int    `config:"listen_port"`
+		Timeout string `config:"timeout"`
+		Limits  Limits `config:"limits"`
+		Ignored string `config:"-"`
+	}
+
+	var s Server
+	err := cfg.GetInto(context.Background(), "server", &s, DecodeOptions{TagName: "config", WeaklyTyped: true})
+	require.NoError(t, err)
+	assert.Equal(t, Server{Host: "0.0.0.0", Port: 8080, Timeout: "30", Limits: Limits{MaxConns: 100}}, s)
+
+	// Without weak typing a string cannot fill an int field, which fails
+	// validation as in Get
+	err = cfg.GetInto(context.Background(), "server", &Server{}, DecodeOptions{TagName: "config"})
+	assert.True(t, IsErrorCode(err, ErrValidation))
+	assert.Contains(t, err.Error(), "field listen_port")
+	type LuaServer struct {
+		Port int `lua:"listen_port"`
+	}
+	err = cfg.Get(context.Background(), "server", &LuaServer{})
+	assert.True(t, IsErrorCode(err, ErrValidation))
+
+	// Unknown keys are reported when disallowed
+	type Partial struct {
+		Host string `config:"listen_host"`
+	}
+	var p Partial
+	require.NoError(t, cfg.GetInto(context.Background(), "server", &p, DecodeOptions{TagName: "config"}))
+	assert.Equal(t, "0.0.0.0", p.Host)
+
+	err = cfg.GetInto(context.Background(), "server", &p, DecodeOptions{TagName: "config", DisallowUnknownKeys: true})
+	require.True(t, IsErrorCode(err, ErrConversion))
+	assert.Contains(t, err.Error(), "limits, listen_port, timeout")
+
+	err = cfg.GetInto(context.Background(), "missing", &p, DecodeOptions{})
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+}
+
+func TestWeaklyTypedInput(t *testing.T) {
+	type Server struct {
+		Port    int     `lua:"port"`
+		Debug   bool    `lua:"debug"`
+		Ratio   float64 `lua:"ratio"`
+		Version string  `lua:"version"`
+	}
+	script := `server = { port = "8080", debug = "true", ratio = "0.5", version = 2 }`
+
+	// Strict by default
+	strict := New()
+	defer strict.Close()
+	require.NoError(t, strict.DoString(script))
+	err := strict.Get(context.Background(), "server", &Server{})
+	assert.True(t, IsErrorCode(err, ErrValidation))
+
+	cfg := New(WithWeaklyTypedInput(true))
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(script))
+
+	var s Server
+	require.NoError(t, cfg.Get(context.Background(), "server", &s))
+	assert.Equal(t, Server{Port: 8080, Debug: true, Ratio: 0.5, Version: "2"}, s)
+
+	// Values that cannot be coerced are still rejected
+	require.NoError(t, cfg.DoString(`server.port = "eighty"`))
+	err = cfg.Get(context.Background(), "server", &s)
+	assert.True(t, IsErrorCode(err, ErrValidation))
+}
+
+func TestLenientDecoding(t *testing.T) {
+	type Server struct {
+		Ports  []int          `lua:"ports"`
+		Limits map[string]int `lua:"limits"`
+	}
+	script := `server = { ports = { 80, "http", 443 }, limits = { conns = 100 } }`
+
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(script))
+
+	// A bad element fails the whole decode and is named in the error
+	err := cfg.Get(context.Background(), "server", &Server{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "element 2")
+
+	require.NoError(t, cfg.DoString(`server = { ports = { 80 }, limits = { conns = "many" } }`))
+	err = cfg.Get(context.Background(), "server", &Server{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "key conns")
+
+	lenient := New(WithLenientDecoding(true))
+	defer lenient.Close()
+	require.NoError(t, lenient.DoString(script))
+
+	var s Server
+	require.NoError(t, lenient.Get(context.Background(), "server", &s))
+	assert.Equal(t, []int{80, 443}, s.Ports)
+	assert.Equal(t, map[string]int{"conns": 100}, s.Limits)
+
+	// Pooled states decode with the same setting
+	pooled := New(WithLenientDecoding(true), WithStatePool(1))
+	defer pooled.Close()
+	require.NoError(t, pooled.DoString(script))
+	s = Server{}
+	require.NoError(t, pooled.Get(context.Background(), "server", &s))
+	assert.Equal(t, []int{80, 443}, s.Ports)
+}
+
+func TestInterfaceDecodingErrors(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(`
+		items = { "a", {}, "c", function() end }
+		items[2].self = items
+		named = { ok = 1, bad = {}, handler = function() end }
+		named.bad.self = named
+	`))
+
+	// An element that fails to convert fails the decode and is named
+	var v interface{}
+	err := cfg.Get(context.Background(), "items", &v)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "element 2")
+	err = cfg.Get(context.Background(), "named", &v)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "key bad")
+
+	// Lenient decoding drops only the value that fails to convert, and
+	// functions are left out either way, keeping array indexes
+	lenient := New(WithLenientDecoding(true))
+	defer lenient.Close()
+	require.NoError(t, lenient.DoString(`
+		items = { "a", {}, "c", function() end }
+		items[2].self = items
+		named = { ok = 1, bad = {}, handler = function() end }
+		named.bad.self = named
+	`))
+	require.NoError(t, lenient.Get(context.Background(), "items", &v))
+	assert.Equal(t, []interface{}{"a", map[string]interface{}{}, "c", nil}, v)
+	require.NoError(t, lenient.Get(context.Background(), "named", &v))
+	assert.Equal(t, map[string]interface{}{"ok": float64(1), "bad": map[string]interface{}{}}, v)
+}
+
+func TestEmbeddedStructs(t *testing.T) {
+	type Metadata struct {
+		Owner   string `lua:"owner"`
+		Version int    `lua:"version"`
+	}
+	type Service struct {
+		Metadata
+		Name string `lua:"name"`
+	}
+	type Tagged struct {
+		Metadata `lua:"meta"`
+		Name     string `lua:"name"`
+	}
+	type Optional struct {
+		*Metadata
+		Name string `lua:"name"`
+	}
+
+	cfg := New()
+	defer cfg.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cfg.DoString(`
+		service = { name = "api", owner = "platform", version = 3 }
+		tagged = { name = "worker", meta = { owner = "data", version = 1 } }
+		bare = { name = "cron" }
+	`))
+
+	// Without a tag the embedded fields are read from the parent table
+	var svc Service
+	require.NoError(t, cfg.Get(ctx, "service", &svc))
+	assert.Equal(t, Service{Metadata: Metadata{Owner: "platform", Version: 3}, Name: "api"}, svc)
+
+	// With a tag the embedded struct is a nested table
+	var tagged Tagged
+	require.NoError(t, cfg.Get(ctx, "tagged", &tagged))
+	assert.Equal(t, Tagged{Metadata: Metadata{Owner: "data", Version: 1}, Name: "worker"}, tagged)
+
+	// An embedded pointer is only allocated when one of its fields is set
+	var opt Optional
+	require.NoError(t, cfg.Get(ctx, "service", &opt))
+	require.NotNil(t, opt.Metadata)
+	assert.Equal(t, "platform", opt.Owner)
+	opt = Optional{}
+	require.NoError(t, cfg.Get(ctx, "bare", &opt))
+	assert.Nil(t, opt.Metadata)
+
+	// Inlined keys are not unknown, and their types are validated
+	require.NoError(t, cfg.GetInto(ctx, "service", &svc, DecodeOptions{DisallowUnknownKeys: true}))
+	require.NoError(t, cfg.DoString(`broken = { name = "api", version = "three" }`))
+	err := cfg.Get(ctx, "broken", &svc)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected number")
+
+	// Converting to Lua flattens untagged embedded structs the same way
+	require.NoError(t, cfg.SetGlobal("out", Service{Metadata: Metadata{Owner: "ops", Version: 2}, Name: "db"}))
+	require.NoError(t, cfg.SetGlobal("out_tagged", Tagged{Metadata: Metadata{Owner: "ops"}, Name: "db"}))
+	for expr, want := range map[string]interface{}{
+		"out.owner":             "ops",
+		"out.version":           float64(2),
+		"out.metadata":          nil,
+		"out_tagged.meta.owner": "ops",
+		"out_tagged.owner":      nil,
+	} {
+		v, err := cfg.Eval(expr)
+		require.NoError(t, err)
+		assert.Equal(t, want, v, expr)
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	type Ledger struct {
+		Supply  *big.Int   `lua:"supply"`
+		Limit   *big.Int   `lua:"limit"`
+		Rate    *big.Float `lua:"rate"`
+		Fee     *big.Float `lua:"fee"`
+		Missing *big.Int   `lua:"missing"`
+	}
+
+	cfg := New()
+	defer cfg.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cfg.DoString(`
+		ledger = {
+			supply = "1234567890123456789012345678901234567890",
+			limit = 1000000,
+			rate = "0.000000000000000000000000000001",
+			fee = 2.5,
+		}
+	`))
+
+	var ledger Ledger
+	require.NoError(t, cfg.Get(ctx, "ledger", &ledger))
+	assert.Equal(t, "1234567890123456789012345678901234567890", ledger.Supply.String())
+	assert.Equal(t, int64(1000000), ledger.Limit.Int64())
+	assert.Equal(t, "1e-30", ledger.Rate.Text('g', 10))
+	assert.Equal(t, "2.5", ledger.Fee.String())
+	assert.Nil(t, ledger.Missing)
+
+	for _, script := range []string{
+		`ledger = { supply = "12abc" }`,
+		`ledger = { supply = 1.5 }`,
+		`ledger = { supply = true }`,
+		`ledger = { rate = "fast" }`,
+	} {
+		require.NoError(t, cfg.DoString(script))
+		assert.Error(t, cfg.Get(ctx, "ledger", &Ledger{}), script)
+	}
+}
+
+func TestStrictFields(t *testing.T) {
+	type Core struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+	type Plugin struct {
+		Name string `lua:"name"`
+	}
+
+	cfg := New()
+	defer cfg.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cfg.DoString(`
+		core = { host = "localhost", prot = 8080 }
+		plugin = { name = "metrics", experimental_flag = true }
+	`))
+
+	// A strict Get on the core section and a lenient one on the plugin section
+	var core Core
+	err := cfg.GetStrict(ctx, "core", &core)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "prot")
+	var plugin Plugin
+	require.NoError(t, cfg.Get(ctx, "plugin", &plugin))
+	assert.Equal(t, "metrics", plugin.Name)
+
+	// Strictness can be made the default and relaxed per call
+	cfg.SetStrict(true)
+	assert.Error(t, cfg.Get(ctx, "plugin", &plugin))
+	require.NoError(t, cfg.GetLenient(ctx, "plugin", &plugin))
+	cfg.SetStrict(false)
+	require.NoError(t, cfg.Get(ctx, "core", &core))
+
+	strict := New(WithStrictFields(true))
+	defer strict.Close()
+	require.NoError(t, strict.DoString(`core = { host = "localhost", port = 8080, debug = true }`))
+	assert.Error(t, strict.Get(ctx, "core", &core))
+}
+
+func TestZeroIndexedArrays(t *testing.T) {
+	type Pipeline struct {
+		Stages []string `lua:"stages"`
+	}
+	script := `pipeline = { stages = { [0] = "fetch", "build", "test" } }`
+	ctx := context.Background()
+
+	// Element 0 is reported rather than dropped
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(script))
+	err := cfg.Get(ctx, "pipeline", &Pipeline{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "index 0")
+
+	// Untyped values keep every element by decoding as a map
+	v, err := cfg.Eval("pipeline.stages")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"0": "fetch", "1": "build", "2": "test"}, v)
+
+	zero := New(WithZeroBasedArrays(true))
+	defer zero.Close()
+	require.NoError(t, zero.DoString(script))
+	var p Pipeline
+	require.NoError(t, zero.Get(ctx, "pipeline", &p))
+	assert.Equal(t, []string{"fetch", "build", "test"}, p.Stages)
+	v, err = zero.Eval("pipeline.stages")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"fetch", "build", "test"}, v)
+
+	// Per call, and for a table holding only index 0
+	require.NoError(t, cfg.DoString(`pipeline = { stages = { [0] = "only" } }`))
+	require.NoError(t, cfg.GetInto(ctx, "pipeline", &p, DecodeOptions{ZeroBasedArrays: true}))
+	assert.Equal(t, []string{"only"}, p.Stages)
+}
+
+// repeatedHosts builds entries whose hosts are equal but separately allocated
+const repeatedHosts = `
+	entries = {}
+	for i = 1, 500 do
+		entries[i] = { host = "db" .. ".example.com", tags = { "primary" .. "", "eu" .. "-west" } }
+	end
+`
+
+type internEntry struct {
+	Host string   `lua:"host"`
+	Tags []string `lua:"tags"`
+}
+
+func TestStringInterning(t *testing.T) {
+	for _, interned := range []bool{false, true} {
+		cfg := New(WithStringInterning(interned))
+		require.NoError(t, cfg.DoString(repeatedHosts))
+
+		var entries []internEntry
+		require.NoError(t, cfg.Get(context.Background(), "entries", &entries))
+		cfg.Close()
+
+		require.Len(t, entries, 500)
+		assert.Equal(t, "db.example.com", entries[499].Host)
+		assert.Equal(t, []string{"primary", "eu-west"}, entries[499].Tags)
+		shared := unsafe.StringData(entries[0].Host) == unsafe.StringData(entries[499].Host)
+		assert.Equal(t, interned, shared)
+	}
+}
+
+// BenchmarkStringInterning reports the heap still held by decoded configs
+// once their Lua states are closed
+func BenchmarkStringInterning(b *testing.B) {
+	for _, interned := range []bool{false, true} {
+		b.Run(fmt.Sprintf("interned=%v", interned), func(b *testing.B) {
+			kept := make([][]internEntry, 0, b.N)
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			for i := 0; i < b.N; i++ {
+				cfg := New(WithStringInterning(interned))
+				if err := cfg.DoString(repeatedHosts); err != nil {
+					b.Fatal(err)
+				}
+				var entries []internEntry
+				if err := cfg.Get(context.Background(), "entries", &entries); err != nil {
+					b.Fatal(err)
+				}
+				cfg.Close()
+				kept = append(kept, entries)
+			}
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "retained-B/op")
+			runtime.KeepAlive(kept)
+		})
+	}
+}
+
+func TestToStringMetamethod(t *testing.T) {
+	script := `
+		local Version = {}
+		Version.__tostring = function(v) return v.major .. "." .. v.minor end
+		local function version(major, minor)
+			return setmetatable({ major = major, minor = minor }, Version)
+		end
+
+		app = { name = "api", version = version(1, 4), plain = { major = 2 } }
+		broken = { version = setmetatable({}, { __tostring = function() return {} end }) }
+		slow = { version = setmetatable({}, { __tostring = function() while true do end end }) }
+	`
+	type App struct {
+		Name    string `lua:"name"`
+		Version string `lua:"version"`
+	}
+
+	// Metamethods are only called when enabled
+	disabled := New()
+	defer disabled.Close()
+	require.NoError(t, disabled.DoString(script))
+	var app App
+	assert.Error(t, disabled.Get(context.Background(), "app", &app))
+
+	cfg := New(WithToStringMetamethods(true), WithSandbox(&Sandbox{MaxExecutionTime: 50 * time.Millisecond}))
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(script))
+
+	require.NoError(t, cfg.Get(context.Background(), "app", &app))
+	assert.Equal(t, App{Name: "api", Version: "1.4"}, app)
+
+	// Tables without __tostring are still rejected
+	var plain struct {
+		Plain string `lua:"plain"`
+	}
+	assert.Error(t, cfg.Get(context.Background(), "app", &plain))
+
+	err := cfg.Get(context.Background(), "broken", &app)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "__tostring returned table, not a string")
+
+	// A metamethod that does not return is stopped
+	err = cfg.Get(context.Background(), "slow", &app)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "__tostring failed")
+
+	exported, err := cfg.ExportLua("app")
+	require.NoError(t, err)
+	assert.Contains(t, exported, `version = "1.4"`)
+
+	// Concurrent reads do not share the state while a metamethod runs
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				var got App
+				assert.NoError(t, cfg.Get(context.Background(), "app", &got))
+				assert.Equal(t, "1.4", got.Version)
+			}
+		}()
+	}
+	wg.Wait()
+}
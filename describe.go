@@ -0,0 +1,157 @@
+package lugo
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Manifest describes everything registered with a Config
+type Manifest struct {
+	// Types lists the types registered with RegisterType, sorted by name
+	Types []TypeManifest
+	// Functions lists the Go functions reachable from the globals, and any
+	// function registered with metadata, sorted by dotted name
+	Functions []FunctionManifest
+	// Constants lists the names registered with RegisterConstants and
+	// RegisterConstantTable, sorted
+	Constants []string
+	// Middleware lists the names registered with RegisterMiddleware, sorted
+	Middleware []string
+	// Globals lists the user-defined globals, as ListGlobals does
+	Globals []string
+}
+
+// TypeManifest describes a registered type
+type TypeManifest struct {
+	Name   string
+	GoType string
+	Fields []FieldManifest
+}
+
+// FieldManifest describes a field of a registered type
+type FieldManifest struct {
+	Key      string          // Lua key
+	Type     string          // Go type
+	Validate string          // validate tag, if any
+	Fields   []FieldManifest // fields of a nested struct
+}
+
+// FunctionManifest describes a registered function
+type FunctionManifest struct {
+	Name     string
+	Metadata *FunctionMetadata // nil when none was registered
+}
+
+// Describe returns a manifest of the registered types, functions, constants
+// and middleware, for tooling and debugging
+func (c *Config) Describe() Manifest {
+	manifest := Manifest{Globals: c.ListGlobals()}
+
+	c.middlewareMu.RLock()
+	for name := range c.middlewareMap {
+		manifest.Middleware = append(manifest.Middleware, name)
+	}
+	c.middlewareMu.RUnlock()
+	sort.Strings(manifest.Middleware)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for name, t := range c.types {
+		manifest.Types = append(manifest.Types, TypeManifest{
+			Name:   name,
+			GoType: t.String(),
+			Fields: describeFields(t, map[reflect.Type]bool{}),
+		})
+	}
+	sort.Slice(manifest.Types, func(i, j int) bool { return manifest.Types[i].Name < manifest.Types[j].Name })
+
+	for name := range c.constants {
+		manifest.Constants = append(manifest.Constants, name)
+	}
+	sort.Strings(manifest.Constants)
+
+	functions := make(map[string]*FunctionMetadata)
+	for name, metadata := range c.functionMetadata {
+		functions[name] = metadata
+	}
+	for _, name := range manifest.Globals {
+		c.collectFunctions(name, c.L.GetGlobal(name), functions, map[*lua.LTable]bool{})
+	}
+	for name, metadata := range functions {
+		manifest.Functions = append(manifest.Functions, FunctionManifest{Name: name, Metadata: metadata})
+	}
+	sort.Slice(manifest.Functions, func(i, j int) bool { return manifest.Functions[i].Name < manifest.Functions[j].Name })
+
+	return manifest
+}
+
+// collectFunctions adds the Go functions found at or below lv to functions.
+// Metadata is stored under the unqualified name, so a namespaced function
+// falls back to it when its dotted name has none.
+func (c *Config) collectFunctions(path string, lv lua.LValue, functions map[string]*FunctionMetadata, seen map[*lua.LTable]bool) {
+	switch v := lv.(type) {
+	case *lua.LFunction:
+		if !v.IsG {
+			return
+		}
+		if _, ok := functions[path]; ok {
+			return
+		}
+		short := path[strings.LastIndex(path, ".")+1:]
+		functions[path] = c.functionMetadata[short]
+		if _, global := c.L.GetGlobal(short).(*lua.LFunction); short != path && !global {
+			// The metadata belongs to the qualified name
+			delete(functions, short)
+		}
+	case *lua.LTable:
+		if seen[v] {
+			return
+		}
+		seen[v] = true
+		v.ForEach(func(k, value lua.LValue) {
+			if key, ok := k.(lua.LString); ok {
+				c.collectFunctions(path+"."+string(key), value, functions, seen)
+			}
+		})
+	}
+}
+
+// describeFields lists the fields of the struct type t. onPath holds the
+// types being described so recursive types stop instead of looping.
+func describeFields(t reflect.Type, onPath map[reflect.Type]bool) []FieldManifest {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || onPath[t] {
+		return nil
+	}
+	onPath[t] = true
+	defer delete(onPath, t)
+
+	var fields []FieldManifest
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isInlined(field, "lua") {
+			fields = append(fields, describeFields(field.Type, onPath)...)
+			continue
+		}
+		if field.PkgPath != "" { // Skip unexported fields
+			continue
+		}
+		key := luaFieldName(field)
+		if key == "-" {
+			continue
+		}
+		fields = append(fields, FieldManifest{
+			Key:      key,
+			Type:     field.Type.String(),
+			Validate: field.Tag.Get("validate"),
+			Fields:   describeFields(field.Type, onPath),
+		})
+	}
+	return fields
+}
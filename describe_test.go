@@ -0,0 +1,59 @@
+package lugo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestDescribe(t *testing.T) {
+	type Server struct {
+		Host string `lua:"host" validate:"required"`
+		Port int    `lua:"port"`
+		TLS  struct {
+			Enabled bool `lua:"enabled"`
+		} `lua:"tls"`
+	}
+
+	cfg := New()
+	defer cfg.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cfg.RegisterType(ctx, "Server", Server{}))
+	require.NoError(t, cfg.RegisterFunction(ctx, "double", func(x int) int { return x * 2 }))
+	require.NoError(t, cfg.RegisterLuaFunctionWithOptions("get", func(L *lua.LState) int { return 0 }, FunctionOptions{
+		Namespace: "http",
+		Metadata:  &FunctionMetadata{Description: "Fetches a URL"},
+	}))
+	require.NoError(t, cfg.RegisterConstants(map[string]interface{}{"VERSION": "1.0"}))
+	require.NoError(t, cfg.RegisterConstantTable("status", map[string]interface{}{"OK": 200}))
+	require.NoError(t, cfg.RegisterMiddleware("logging", func(next lua.LGFunction) lua.LGFunction { return next }))
+	require.NoError(t, cfg.DoString(`app = { name = "demo" }; function helper() end`))
+
+	manifest := cfg.Describe()
+
+	require.Len(t, manifest.Types, 1)
+	assert.Equal(t, "Server", manifest.Types[0].Name)
+	assert.Equal(t, []FieldManifest{
+		{Key: "host", Type: "string", Validate: "required"},
+		{Key: "port", Type: "int"},
+		{Key: "tls", Type: "struct { Enabled bool \"lua:\\\"enabled\\\"\" }", Fields: []FieldManifest{
+			{Key: "enabled", Type: "bool"},
+		}},
+	}, manifest.Types[0].Fields)
+
+	// Lua functions defined by scripts are not registered functions
+	require.Len(t, manifest.Functions, 2)
+	assert.Equal(t, "double", manifest.Functions[0].Name)
+	assert.Nil(t, manifest.Functions[0].Metadata)
+	assert.Equal(t, "http.get", manifest.Functions[1].Name)
+	require.NotNil(t, manifest.Functions[1].Metadata)
+	assert.Equal(t, "Fetches a URL", manifest.Functions[1].Metadata.Description)
+
+	assert.Equal(t, []string{"VERSION", "status"}, manifest.Constants)
+	assert.Equal(t, []string{"logging"}, manifest.Middleware)
+	assert.Subset(t, manifest.Globals, []string{"Server", "app", "double", "helper", "http"})
+}
@@ -1,12 +1,17 @@
 package lugo
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 type DocGenerator struct {
+	// Format is "markdown" (the default) or "jsonschema", which produces a
+	// draft-07 JSON Schema editors can use to complete and check configs
 	Format           string
 	TypeDescriptions map[string]string
 	IncludeExamples  bool
@@ -18,17 +23,37 @@ func (c *Config) GenerateDocs(v interface{}, gen DocGenerator) (string, error) {
 		t = t.Elem()
 	}
 
+	switch gen.Format {
+	case "", "markdown":
+	case "jsonschema":
+		return generateJSONSchema(t, gen)
+	default:
+		return "", &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("unsupported documentation format %q", gen.Format),
+		}
+	}
+
 	var b strings.Builder
 	b.WriteString("# Configuration Reference\n\n")
 
-	if err := generateFieldDocs(&b, t, "", gen); err != nil {
+	if err := generateFieldDocs(&b, t, "", gen, map[reflect.Type]bool{}); err != nil {
 		return "", err
 	}
 
 	return b.String(), nil
 }
 
-func generateFieldDocs(b *strings.Builder, t reflect.Type, prefix string, gen DocGenerator) error {
+// generateFieldDocs documents the fields of the struct type t under prefix.
+// onPath holds the types being documented so recursive types stop instead of
+// looping.
+func generateFieldDocs(b *strings.Builder, t reflect.Type, prefix string, gen DocGenerator, onPath map[reflect.Type]bool) error {
+	if onPath[t] {
+		return nil
+	}
+	onPath[t] = true
+	defer delete(onPath, t)
+
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
@@ -76,9 +101,17 @@ func generateFieldDocs(b *strings.Builder, t reflect.Type, prefix string, gen Do
 			}
 		}
 
-		// Handle nested structs
-		if field.Type.Kind() == reflect.Struct {
-			if err := generateFieldDocs(b, field.Type, path, gen); err != nil {
+		// Handle nested structs, including the elements of slices and maps,
+		// whose fields are documented under "*", e.g. "servers.*.host"
+		nested, nestedPath := field.Type, path
+		for kind := nested.Kind(); kind == reflect.Ptr || kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map; kind = nested.Kind() {
+			if kind != reflect.Ptr {
+				nestedPath += ".*"
+			}
+			nested = nested.Elem()
+		}
+		if nested.Kind() == reflect.Struct && nested != timeType {
+			if err := generateFieldDocs(b, nested, nestedPath, gen, onPath); err != nil {
 				return err
 			}
 		}
@@ -95,6 +128,8 @@ func getTypeDescription(t reflect.Type, descriptions map[string]string) string {
 
 	// Default type descriptions
 	switch t.Kind() {
+	case reflect.Ptr:
+		return getTypeDescription(t.Elem(), descriptions)
 	case reflect.String:
 		return "string"
 	case reflect.Int, reflect.Int64:
@@ -113,3 +148,183 @@ func getTypeDescription(t reflect.Type, descriptions map[string]string) string {
 		return t.String()
 	}
 }
+
+// generateJSONSchema returns a draft-07 JSON Schema for the struct type t
+func generateJSONSchema(t reflect.Type, gen DocGenerator) (string, error) {
+	if t.Kind() != reflect.Struct {
+		return "", &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("expected struct, got %v", t),
+		}
+	}
+
+	schema := typeSchema(t, gen)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// typeSchema returns the JSON Schema of values of type t
+func typeSchema(t reflect.Type, gen DocGenerator) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case durationType:
+		return map[string]interface{}{"type": "string"}
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case bigIntType, bigFloatType:
+		return map[string]interface{}{"type": []string{"string", "number"}}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), gen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), gen)}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		structSchemaFields(t, gen, properties, &required)
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchemaFields adds the schemas of the fields of the struct type t to
+// properties, and the keys of required fields to required
+func structSchemaFields(t reflect.Type, gen DocGenerator, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isInlined(field, "lua") {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			structSchemaFields(embedded, gen, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		key := luaFieldName(field)
+		if key == "-" {
+			continue
+		}
+
+		schema := typeSchema(field.Type, gen)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			schema["description"] = doc
+		}
+		if example := field.Tag.Get("example"); gen.IncludeExamples && example != "" {
+			schema["examples"] = []string{example}
+		}
+		if applyRuleSchema(schema, field.Type, strings.Split(field.Tag.Get("validate"), ",")) {
+			*required = append(*required, key)
+		}
+		properties[key] = schema
+	}
+}
+
+// applyRuleSchema adds the constraints expressible in JSON Schema for the
+// validate rules of a field of type t to schema, reporting whether the field
+// is required. Rules after dive apply to the elements.
+func applyRuleSchema(schema map[string]interface{}, t reflect.Type, rules []string) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	required := false
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			required = true
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil || t == durationType {
+				continue
+			}
+			var prefix string
+			switch t.Kind() {
+			case reflect.String:
+				prefix = "Length"
+			case reflect.Slice, reflect.Array:
+				prefix = "Items"
+			case reflect.Map:
+				prefix = "Properties"
+			}
+			bounds := []string{name}
+			if name == "len" {
+				bounds = []string{"min", "max"}
+			}
+			for _, bound := range bounds {
+				if prefix == "" {
+					schema[bound+"imum"] = n
+				} else {
+					schema[bound+prefix] = int(n)
+				}
+			}
+		case "oneof":
+			var enum []interface{}
+			for _, option := range strings.Fields(param) {
+				if n, err := strconv.ParseFloat(option, 64); err == nil && isNumberKind(t.Kind()) {
+					enum = append(enum, n)
+				} else {
+					enum = append(enum, option)
+				}
+			}
+			schema["enum"] = enum
+		case "startswith":
+			addPattern(schema, "^"+regexp.QuoteMeta(param))
+		case "endswith":
+			addPattern(schema, regexp.QuoteMeta(param)+"$")
+		case "semver":
+			addPattern(schema, semverRegex.String())
+		case "email":
+			schema["format"] = "email"
+		case "hostname":
+			schema["format"] = "hostname"
+		case "url":
+			schema["format"] = "uri"
+		case "dive":
+			if elem, ok := schema["items"].(map[string]interface{}); ok {
+				applyRuleSchema(elem, t.Elem(), rules[i+1:])
+			} else if elem, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				applyRuleSchema(elem, t.Elem(), rules[i+1:])
+			}
+			return required
+		}
+	}
+	return required
+}
+
+// addPattern sets the pattern of schema, or adds it to allOf when schema
+// already has one
+func addPattern(schema map[string]interface{}, pattern string) {
+	if _, ok := schema["pattern"]; !ok {
+		schema["pattern"] = pattern
+		return
+	}
+	allOf, _ := schema["allOf"].([]interface{})
+	schema["allOf"] = append(allOf, map[string]interface{}{"pattern": pattern})
+}
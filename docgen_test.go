@@ -0,0 +1,100 @@
+package lugo
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDocsJSONSchema(t *testing.T) {
+	type AppConfig struct {
+		Name     string `lua:"name" validate:"required" doc:"Service name"`
+		Version  string `lua:"version" validate:"semver" example:"1.2.3"`
+		LogLevel string `lua:"log_level" validate:"oneof=debug info warn error"`
+		Server   struct {
+			Host    string        `lua:"host" validate:"hostname"`
+			Port    int           `lua:"port" validate:"required,min=1024,max=65535"`
+			Timeout time.Duration `lua:"timeout" validate:"min=1s"`
+		} `lua:"server"`
+		Tags    []string           `lua:"tags" validate:"max=5,dive,startswith=env:"`
+		Weights map[string]float64 `lua:"weights"`
+	}
+
+	cfg := New()
+	defer cfg.Close()
+	out, err := cfg.GenerateDocs(AppConfig{}, DocGenerator{Format: "jsonschema", IncludeExamples: true})
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &schema))
+	assert.Equal(t, "http://json-schema.org/draft-07/schema#", schema["$schema"])
+	assert.Equal(t, "object", schema["type"])
+	assert.Equal(t, []interface{}{"name"}, schema["required"])
+
+	properties := schema["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "description": "Service name"}, properties["name"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "string",
+		"enum": []interface{}{"debug", "info", "warn", "error"},
+	}, properties["log_level"])
+	assert.Equal(t, []interface{}{"1.2.3"}, properties["version"].(map[string]interface{})["examples"])
+	assert.Contains(t, properties["version"], "pattern")
+
+	server := properties["server"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"port"}, server["required"])
+	serverProperties := server["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "integer", "minimum": 1024.0, "maximum": 65535.0}, serverProperties["port"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "hostname"}, serverProperties["host"])
+	assert.Equal(t, map[string]interface{}{"type": "string"}, serverProperties["timeout"])
+
+	assert.Equal(t, map[string]interface{}{
+		"type":     "array",
+		"maxItems": 5.0,
+		"items":    map[string]interface{}{"type": "string", "pattern": "^env:"},
+	}, properties["tags"])
+	assert.Equal(t, map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "number"},
+	}, properties["weights"])
+
+	_, err = cfg.GenerateDocs(AppConfig{}, DocGenerator{Format: "yaml"})
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+}
+
+func TestGenerateDocsNestedCollections(t *testing.T) {
+	type Template struct {
+		Name string `lua:"name" doc:"Template name"`
+		Path string `lua:"path"`
+	}
+	type Node struct {
+		Label    string  `lua:"label"`
+		Children []*Node `lua:"children"`
+	}
+	type Config struct {
+		Templates []Template            `lua:"templates"`
+		Databases map[string]*Template  `lua:"databases"`
+		Primary   *Template             `lua:"primary"`
+		Tree      Node                  `lua:"tree"`
+		Started   []time.Time           `lua:"started"`
+		Limits    map[string][]Template `lua:"limits"`
+	}
+
+	cfg := New()
+	defer cfg.Close()
+	out, err := cfg.GenerateDocs(Config{}, DocGenerator{})
+	require.NoError(t, err)
+
+	assert.Contains(t, out, "## templates\n\n**Type:** `array`")
+	assert.Contains(t, out, "## templates.*.name\n\n**Type:** `string`\n\nTemplate name")
+	assert.Contains(t, out, "## templates.*.path")
+	assert.Contains(t, out, "## databases.*.name")
+	assert.Contains(t, out, "## primary\n\n**Type:** `table`")
+	assert.Contains(t, out, "## primary.path")
+	assert.Contains(t, out, "## limits.*.*.name")
+	assert.Contains(t, out, "## tree.children")
+	assert.NotContains(t, out, "## tree.children.*.label")
+	assert.NotContains(t, out, "## started.*")
+}
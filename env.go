@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"go.uber.org/zap"
 )
 
 // Environment represents a configuration environment (e.g., dev, staging, prod)
@@ -22,12 +24,52 @@ type Environment struct {
 	IncludePaths []string
 }
 
+// Environment variables consulted, in order, by Config.Environment when no
+// environment has been set explicitly
+var environmentVars = []string{"APP_ENV", "ENVIRONMENT"}
+
+// WithEnvironment sets the initial active environment, taking precedence over
+// the APP_ENV and ENVIRONMENT environment variables
+func WithEnvironment(name string) Option {
+	return func(c *Config) {
+		c.environment = name
+	}
+}
+
+// Environment returns the active environment: the last one set with
+// SetEnvironment or activated through an EnvManager, else the one given to
+// WithEnvironment, else the value of APP_ENV or ENVIRONMENT. It returns an
+// empty string when none of these are set.
+func (c *Config) Environment() string {
+	c.mu.RLock()
+	name := c.environment
+	c.mu.RUnlock()
+	if name != "" {
+		return name
+	}
+
+	for _, key := range environmentVars {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// SetEnvironment changes the active environment at runtime
+func (c *Config) SetEnvironment(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.environment = name
+}
+
 // EnvManager manages different configuration environments
 type EnvManager struct {
 	cfg          *Config
 	environments map[string]*Environment
 	activeEnv    string
 	configDir    string
+	logger       *zap.Logger
 }
 
 // NewEnvManager creates a new environment manager
@@ -36,6 +78,7 @@ func (c *Config) NewEnvManager(configDir string) *EnvManager {
 		cfg:          c,
 		environments: make(map[string]*Environment),
 		configDir:    configDir,
+		logger:       c.logger,
 	}
 }
 
@@ -62,6 +105,7 @@ func (em *EnvManager) RegisterEnvironment(env *Environment) error {
 	}
 
 	em.environments[env.Name] = env
+	em.logger.Debug("environment registered", zap.String("name", env.Name))
 	return nil
 }
 
@@ -69,9 +113,12 @@ func (em *EnvManager) RegisterEnvironment(env *Environment) error {
 func (em *EnvManager) ActivateEnvironment(name string) error {
 	env, ok := em.environments[name]
 	if !ok {
+		em.logger.Warn("environment not found", zap.String("name", name))
 		return fmt.Errorf("environment not found: %s", name)
 	}
 
+	previous := em.activeEnv
+
 	// Load base configuration first
 	if env.BaseConfig != "" {
 		basePath := filepath.Join(em.configDir, env.BaseConfig)
@@ -104,6 +151,10 @@ func (em *EnvManager) ActivateEnvironment(name string) error {
 	}
 
 	em.activeEnv = name
+	em.cfg.SetEnvironment(name)
+	em.logger.Info("environment activated",
+		zap.String("name", name),
+		zap.String("previous", previous))
 	return nil
 }
 
@@ -133,6 +184,9 @@ func (em *EnvManager) loadEnvVars(prefix string) error {
 		if err := em.cfg.SetGlobal(luaName, value); err != nil {
 			return fmt.Errorf("failed to set environment variable %s: %w", key, err)
 		}
+		em.logger.Debug("environment variable override applied",
+			zap.String("env", key),
+			zap.String("global", luaName))
 	}
 
 	return nil
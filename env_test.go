@@ -140,3 +140,35 @@ func TestEnvironmentManager(t *testing.T) {
 		assert.Equal(t, "prod-key", apiKey)
 	})
 }
+
+func TestConfigEnvironment(t *testing.T) {
+	t.Setenv("APP_ENV", "")
+	t.Setenv("ENVIRONMENT", "")
+
+	cfg := New()
+	defer cfg.Close()
+	assert.Equal(t, "", cfg.Environment())
+
+	// Environment variables provide the default, APP_ENV first
+	t.Setenv("ENVIRONMENT", "staging")
+	assert.Equal(t, "staging", cfg.Environment())
+	t.Setenv("APP_ENV", "qa")
+	assert.Equal(t, "qa", cfg.Environment())
+
+	// The option overrides the environment variables
+	withOpt := New(WithEnvironment("production"))
+	defer withOpt.Close()
+	assert.Equal(t, "production", withOpt.Environment())
+
+	// SetEnvironment overrides both
+	withOpt.SetEnvironment("canary")
+	assert.Equal(t, "canary", withOpt.Environment())
+
+	// Activating an environment makes it the active one
+	configDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "dev.lua"), []byte(`debug = true`), 0644))
+	em := withOpt.NewEnvManager(configDir)
+	require.NoError(t, em.RegisterEnvironment(&Environment{Name: "dev", EnvConfig: "dev.lua"}))
+	require.NoError(t, em.ActivateEnvironment("dev"))
+	assert.Equal(t, "dev", withOpt.Environment())
+}
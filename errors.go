@@ -1,7 +1,9 @@
 package lugo
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -188,6 +190,7 @@ func WrapLuaError(L *lua.LState, err error) *LuaError {
 	if luaErr, ok := err.(*LuaError); ok {
 		return luaErr // Already wrapped
 	}
+	err = plainLuaError(err)
 
 	message := "Lua runtime error"
 	if err != nil {
@@ -196,3 +199,121 @@ func WrapLuaError(L *lua.LState, err error) *LuaError {
 
 	return NewLuaError(L, ErrExecution, message, err)
 }
+
+// ErrorConverter returns the fields of the Lua table representing err
+type ErrorConverter func(err error) map[string]interface{}
+
+// errorType pairs a registered error type with its converter
+type errorType struct {
+	typ     reflect.Type
+	convert ErrorConverter
+}
+
+// RegisterErrorType makes errors of the same type as sample, returned by Go
+// functions called from Lua, reach Lua as a table built by convert, such as
+// {code = 404, message = "not found"}, in place of the default error table
+// described at raiseError. Errors wrapping one of that type match too. The
+// table's message field defaults to the matched error's Error(), and tostring
+// returns it.
+func (c *Config) RegisterErrorType(sample error, convert ErrorConverter) error {
+	if sample == nil || convert == nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "error type and converter cannot be nil",
+		}
+	}
+
+	c.errorTypesMu.Lock()
+	defer c.errorTypesMu.Unlock()
+	c.errorTypes = append(c.errorTypes, errorType{typ: reflect.TypeOf(sample), convert: convert})
+	return nil
+}
+
+// raiseError raises err, returned by a registered Go function, in L as an
+// error table so that Lua code can inspect it after pcall. Errors of a type
+// registered with RegisterErrorType use their converter; others become
+// {code = c, message = m}, where c is the ErrorCode of the first *Error in
+// the chain, or ErrExecution, and m is err.Error(). tostring of either table
+// returns its message.
+func (c *Config) raiseError(L *lua.LState, err error) {
+	table := c.errorTable(L, err)
+	if table == nil {
+		code := ErrExecution
+		var lugoErr *Error
+		if errors.As(err, &lugoErr) {
+			code = lugoErr.Code
+		}
+		table = L.NewTable()
+		table.RawSetString("code", lua.LNumber(code))
+		table.RawSetString("message", lua.LString(err.Error()))
+		setErrorMetatable(L, table)
+	}
+	L.Error(table, 1)
+}
+
+// isStructuredError reports whether a recovered panic is an error raised as a
+// table by raiseError, which recovery must pass on unchanged
+func isStructuredError(r interface{}) bool {
+	apiErr, ok := r.(*lua.ApiError)
+	return ok && apiErr.Object.Type() == lua.LTTable
+}
+
+// errorTable converts the first error in err's chain with a registered type,
+// returning nil if there is none
+func (c *Config) errorTable(L *lua.LState, err error) *lua.LTable {
+	c.errorTypesMu.RLock()
+	types := c.errorTypes
+	c.errorTypesMu.RUnlock()
+	if len(types) == 0 {
+		return nil
+	}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		for _, et := range types {
+			if reflect.TypeOf(e) != et.typ {
+				continue
+			}
+			lv, convErr := c.goToLua(et.convert(e))
+			table, ok := lv.(*lua.LTable)
+			if convErr != nil || !ok {
+				return nil
+			}
+			if table.RawGetString("message") == lua.LNil {
+				table.RawSetString("message", lua.LString(e.Error()))
+			}
+			setErrorMetatable(L, table)
+			return table
+		}
+	}
+	return nil
+}
+
+// setErrorMetatable makes tostring of an error table return its message
+func setErrorMetatable(L *lua.LState, table *lua.LTable) {
+	message := table.RawGetString("message")
+	meta := L.NewTable()
+	meta.RawSetString("__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(message)
+		return 1
+	}))
+	L.SetMetatable(table, meta)
+}
+
+// plainLuaError replaces an error table raised by a registered function with
+// its message, so the error reads as the message rather than as the table's
+// address once it reaches Go
+func plainLuaError(err error) error {
+	apiErr, ok := err.(*lua.ApiError)
+	if !ok {
+		return err
+	}
+	table, ok := apiErr.Object.(*lua.LTable)
+	if !ok {
+		return err
+	}
+	message, ok := table.RawGetString("message").(lua.LString)
+	if !ok {
+		return err
+	}
+	return &lua.ApiError{Type: apiErr.Type, Object: message, StackTrace: apiErr.StackTrace, Cause: apiErr.Cause}
+}
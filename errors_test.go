@@ -2,6 +2,8 @@ package lugo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -259,6 +261,40 @@ func TestRegisterLuaFunctionWithOptions(t *testing.T) {
 	assert.True(t, metricsCalled, "Metrics middleware should have been called")
 }
 
+func TestRegisterMiddleware(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	var order []string
+	named := func(name string) func(lua.LGFunction) lua.LGFunction {
+		return func(next lua.LGFunction) lua.LGFunction {
+			return func(L *lua.LState) int {
+				order = append(order, name+":before")
+				n := next(L)
+				order = append(order, name+":after")
+				return n
+			}
+		}
+	}
+	require.NoError(t, cfg.RegisterMiddleware("logging", named("logging")))
+	require.NoError(t, cfg.RegisterMiddleware("metrics", named("metrics")))
+
+	err := cfg.RegisterMiddleware("logging", named("logging"))
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+	assert.Contains(t, err.Error(), "already registered")
+	assert.True(t, IsErrorCode(cfg.RegisterMiddleware("", named("x")), ErrInvalidType))
+
+	err = cfg.RegisterLuaFunctionWithOptions("work", func(L *lua.LState) int {
+		order = append(order, "work")
+		L.Push(lua.LNumber(1))
+		return 1
+	}, FunctionOptions{Middleware: []string{"logging", "metrics"}})
+	require.NoError(t, err)
+
+	require.NoError(t, cfg.DoString(`assert(work() == 1)`))
+	assert.Equal(t, []string{"logging:before", "metrics:before", "work", "metrics:after", "logging:after"}, order)
+}
+
 func TestRegisterFunctionTable(t *testing.T) {
 	cfg := New()
 	defer cfg.Close()
@@ -336,3 +372,164 @@ func TestRegisterFunctionTable(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, hookCalled, "hook should have been called")
 }
+
+func TestRegisterFunctionTableWithOptions(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	var order []string
+	require.NoError(t, cfg.RegisterMiddleware("trace", func(next lua.LGFunction) lua.LGFunction {
+		return func(L *lua.LState) int {
+			order = append(order, "trace")
+			return next(L)
+		}
+	}))
+
+	err := cfg.RegisterFunctionTableWithOptions(context.Background(), "mathx", map[string]FunctionSpec{
+		"add": {
+			Func: func(x, y int) int {
+				order = append(order, "add")
+				return x + y
+			},
+			Options: FunctionOptions{
+				Metadata: &FunctionMetadata{
+					Description: "Adds two numbers",
+					Params: []ParamMetadata{
+						{Name: "x", Type: "number"},
+						{Name: "y", Type: "number"},
+					},
+				},
+				Middleware: []string{"trace"},
+				Aliases:    []string{"plus"},
+			},
+		},
+		"neg": {
+			Func: func(x int) int { return -x },
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cfg.DoString(`
+		assert(mathx.add(2, 3) == 5)
+		assert(mathx.plus(1, 1) == 2)
+		assert(mathx.neg(4) == -4)
+	`))
+
+	assert.Equal(t, []string{"trace", "add", "trace", "add"}, order)
+	require.NotNil(t, cfg.functionMetadata["add"])
+	assert.Equal(t, "Adds two numbers", cfg.functionMetadata["add"].Description)
+
+	err = cfg.RegisterFunctionTableWithOptions(context.Background(), "bad", map[string]FunctionSpec{
+		"x": {Func: "not a function"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.(*Error).Message, "failed to wrap function")
+	assert.Equal(t, lua.LNil, cfg.L.GetGlobal("bad"))
+
+	// Conflicting names are rejected before the table is created
+	strict := New(WithStrictRegistration(true))
+	defer strict.Close()
+	err = strict.RegisterFunctionTableWithOptions(context.Background(), "mathx", map[string]FunctionSpec{
+		"add": {Func: func(x, y int) int { return x + y }, Options: FunctionOptions{Aliases: []string{"sum"}}},
+		"sum": {Func: func(x, y int) int { return x + y }},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "'mathx.sum' is already defined")
+	assert.Equal(t, lua.LNil, strict.L.GetGlobal("mathx"))
+}
+
+type httpError struct {
+	Status int
+	Reason string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%d %s", e.Status, e.Reason)
+}
+
+func TestRegisterErrorType(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.RegisterErrorType(&httpError{}, func(err error) map[string]interface{} {
+		he := err.(*httpError)
+		return map[string]interface{}{"code": he.Status, "reason": he.Reason}
+	}))
+	assert.True(t, IsErrorCode(cfg.RegisterErrorType(nil, nil), ErrInvalidType))
+
+	require.NoError(t, cfg.RegisterFunction(context.Background(), "fetch", func(path string) (string, error) {
+		switch path {
+		case "/missing":
+			return "", fmt.Errorf("fetching %s: %w", path, &httpError{Status: 404, Reason: "Not Found"})
+		case "/plain":
+			return "", errors.New("connection refused")
+		}
+		return "ok", nil
+	}))
+	require.NoError(t, cfg.RegisterFunctionWithOptions(context.Background(), "fetch_v2", func(path string) error {
+		return &httpError{Status: 503, Reason: "Unavailable"}
+	}, FunctionOptions{}))
+
+	require.NoError(t, cfg.DoString(`
+		local ok, err = pcall(fetch, "/missing")
+		assert(not ok)
+		status = err.code
+		reason = err.reason
+		message = tostring(err)
+		if err.code == 404 then fallback = "used" end
+
+		local ok, err = pcall(fetch, "/plain")
+		plain = err.message
+
+		local ok, err = pcall(fetch_v2, "/")
+		v2_status = err.code
+	`))
+
+	for name, want := range map[string]interface{}{
+		"status":    float64(404),
+		"reason":    "Not Found",
+		"message":   "404 Not Found",
+		"fallback":  "used",
+		"plain":     "connection refused",
+		"v2_status": float64(503),
+	} {
+		got, err := cfg.Eval(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, name)
+	}
+}
+
+func TestPcallErrorObjects(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.RegisterFunction(context.Background(), "lookup", func(key string) (string, error) {
+		switch key {
+		case "missing":
+			return "", fmt.Errorf("lookup: %w", NewError(ErrNotFound, "key missing not found"))
+		case "broken":
+			return "", errors.New("backend unavailable")
+		}
+		return "value", nil
+	}))
+	require.NoError(t, cfg.SetGlobal("ERR_NOT_FOUND", int(ErrNotFound)))
+	require.NoError(t, cfg.SetGlobal("ERR_EXECUTION", int(ErrExecution)))
+
+	require.NoError(t, cfg.DoString(`
+		local ok, err = pcall(lookup, "missing")
+		assert(not ok)
+		assert(err.code == ERR_NOT_FOUND, "code " .. tostring(err.code))
+		assert(err.message == "lookup: key missing not found", err.message)
+		assert(tostring(err) == err.message)
+
+		ok, err = pcall(lookup, "broken")
+		assert(err.code == ERR_EXECUTION)
+		assert(err.message == "backend unavailable")
+	`))
+
+	// Uncaught, the error still reads as its message in Go
+	err := cfg.DoString(`lookup("broken")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backend unavailable")
+	assert.NotContains(t, err.Error(), "table: 0x")
+}
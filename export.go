@@ -0,0 +1,157 @@
+package lugo
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// WithDeterministicTables makes ExportLua write table keys in the order they
+// were first set, which for a loaded file is the order they appear in the
+// source, so exported configs diff cleanly against their originals. Merge
+// copies keys in the same order. Without it keys are written in no
+// particular order.
+func WithDeterministicTables(enabled bool) Option {
+	return func(c *Config) {
+		c.deterministic = enabled
+	}
+}
+
+// ExportLua returns Lua source assigning the current value of each named
+// global, or of every user-defined global when no names are given. Tables
+// with a __tostring metamethod are written as the string it returns, and
+// functions and other values without a literal form are omitted. A named global that
+// is not set is ErrNotFound, and a cyclic table is ErrInvalidType.
+func (c *Config) ExportLua(names ...string) (string, error) {
+	if len(names) == 0 {
+		names = c.ListGlobals()
+	}
+
+	defer c.readLock()()
+
+	g := NewGenerator()
+	for _, name := range names {
+		lv := c.lookupPath(name)
+		if lv == lua.LNil {
+			return "", &Error{
+				Code:    ErrNotFound,
+				Message: fmt.Sprintf("configuration '%s' not found", name),
+			}
+		}
+		if !exportable(lv) {
+			continue
+		}
+		g.buffer.WriteString(name)
+		g.buffer.WriteString(" = ")
+		if err := c.exportValue(g, lv, name, make(map[*lua.LTable]bool)); err != nil {
+			return "", err
+		}
+		g.buffer.WriteString("\n")
+	}
+	return g.String(), nil
+}
+
+// exportValue writes lv to g as a Lua literal. path names lv for errors, and
+// onPath holds the tables being written.
+func (c *Config) exportValue(g *Generator, lv lua.LValue, path string, onPath map[*lua.LTable]bool) error {
+	lv, err := c.metaString(lv)
+	if err != nil {
+		return &Error{
+			Code:    ErrConversion,
+			Message: fmt.Sprintf("cannot export '%s'", path),
+			Cause:   err,
+		}
+	}
+	table, ok := lv.(*lua.LTable)
+	if !ok {
+		switch v := lv.(type) {
+		case lua.LString:
+			g.buffer.WriteString(luaStringLiteral(string(v)))
+		default:
+			g.buffer.WriteString(lv.String())
+		}
+		return nil
+	}
+
+	if onPath[table] {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("cannot export cyclic table at '%s'", path),
+		}
+	}
+	onPath[table] = true
+	defer delete(onPath, table)
+
+	if isArrayTable(table) {
+		g.buffer.WriteString("{ ")
+		for i := 1; i <= table.Len(); i++ {
+			if i > 1 {
+				g.buffer.WriteString(", ")
+			}
+			if v := table.RawGetInt(i); !exportable(v) {
+				g.buffer.WriteString("nil")
+			} else if err := c.exportValue(g, v, fmt.Sprintf("%s.%d", path, i), onPath); err != nil {
+				return err
+			}
+		}
+		g.buffer.WriteString(" }")
+		return nil
+	}
+
+	empty := true
+	c.forEachKey(table, func(k, v lua.LValue) {
+		if err != nil || !exportable(k) || !exportable(v) {
+			return
+		}
+		if empty {
+			g.buffer.WriteString("{\n")
+			g.indent++
+			empty = false
+		}
+		g.writeIndent()
+		if key, ok := k.(lua.LString); ok {
+			g.writeKey(string(key))
+		} else {
+			g.buffer.WriteString("[")
+			err = c.exportValue(g, k, path, onPath)
+			g.buffer.WriteString("]")
+		}
+		g.buffer.WriteString(" = ")
+		if err == nil {
+			err = c.exportValue(g, v, path+"."+k.String(), onPath)
+		}
+		g.buffer.WriteString(",\n")
+	})
+	if empty {
+		g.buffer.WriteString("{}")
+		return err
+	}
+	g.indent--
+	g.writeIndent()
+	g.buffer.WriteString("}")
+	return err
+}
+
+// exportable reports whether lv can be written as a Lua literal
+func exportable(lv lua.LValue) bool {
+	switch lv.(type) {
+	case lua.LString, lua.LNumber, lua.LBool, *lua.LTable:
+		return true
+	default:
+		return false
+	}
+}
+
+// forEachKey calls fn for each key of table, in the order the keys were first
+// set when WithDeterministicTables is enabled
+func (c *Config) forEachKey(table *lua.LTable, fn func(k, v lua.LValue)) {
+	if !c.deterministic {
+		table.ForEach(fn)
+		return
+	}
+	// gopher-lua's Next walks the array part, then the other keys in the
+	// order they were inserted
+	for k, v := table.Next(lua.LNil); k != lua.LNil; k, v = table.Next(k) {
+		fn(k, v)
+	}
+}
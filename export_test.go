@@ -0,0 +1,72 @@
+package lugo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportLuaDeterministic(t *testing.T) {
+	source := `server = {
+    [10] = "ten",
+    name = "edge",
+    port = 8080,
+    enabled = true,
+    tls = {
+        key = "server.key",
+        cert = "server.crt",
+    },
+    hosts = { "a", "b" },
+    empty = {},
+    handler = function() end,
+}
+`
+	cfg := New(WithDeterministicTables(true))
+	defer cfg.Close()
+	require.NoError(t, cfg.LoadBytes(context.Background(), "config.lua", []byte(source)))
+
+	exported, err := cfg.ExportLua("server")
+	require.NoError(t, err)
+	assert.Equal(t, `server = {
+    [10] = "ten",
+    name = "edge",
+    port = 8080,
+    enabled = true,
+    tls = {
+        key = "server.key",
+        cert = "server.crt",
+    },
+    hosts = { "a", "b" },
+    empty = {},
+}
+`, exported)
+
+	// The export loads back to the same values
+	reloaded := New()
+	defer reloaded.Close()
+	require.NoError(t, reloaded.LoadBytes(context.Background(), "exported.lua", []byte(exported)))
+	assert.Equal(t, cfg.GetAll(), reloaded.GetAll())
+
+	// Merged keys keep their order after the existing ones
+	require.NoError(t, cfg.L.DoString(`overrides = { zone = "b", region = "a", port = 9090 }`))
+	require.NoError(t, cfg.Merge(context.Background(), "server.tls", "overrides"))
+	exported, err = cfg.ExportLua("server.tls")
+	require.NoError(t, err)
+	assert.Equal(t, `server.tls = {
+    key = "server.key",
+    cert = "server.crt",
+    zone = "b",
+    region = "a",
+    port = 9090,
+}
+`, exported)
+
+	_, err = cfg.ExportLua("missing")
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+
+	require.NoError(t, cfg.L.DoString(`loop = {}; loop.self = loop`))
+	_, err = cfg.ExportLua("loop")
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+}
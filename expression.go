@@ -0,0 +1,85 @@
+package lugo
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Evaluator is a Lua expression compiled once by CompileExpression and
+// evaluated any number of times against different variables
+type Evaluator struct {
+	cfg   *Config
+	expr  string
+	proto *lua.FunctionProto
+	base  *lua.LTable
+}
+
+// CompileExpression compiles expr, such as `user.plan == "pro" and user.age
+// >= 18`, into an Evaluator. The expression is parsed once, so evaluating it
+// repeatedly avoids the parsing cost of Eval.
+func (c *Config) CompileExpression(expr string) (*Evaluator, error) {
+	name := "<expression>"
+	chunk, err := parse.Parse(strings.NewReader("return "+expr), name)
+	if err != nil {
+		return nil, &Error{
+			Code:    ErrParse,
+			Message: fmt.Sprintf("failed to parse expression '%s'", expr),
+			Cause:   err,
+		}
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, &Error{
+			Code:    ErrParse,
+			Message: fmt.Sprintf("failed to compile expression '%s'", expr),
+			Cause:   err,
+		}
+	}
+
+	// Expressions cannot assign, so evaluations can share one set of built-ins
+	base := c.L.NewTable()
+	base.RawSetString("__index", c.isolatedEnv())
+
+	return &Evaluator{cfg: c, expr: expr, proto: proto, base: base}, nil
+}
+
+// Eval evaluates the expression with vars as its only variables, alongside
+// the built-ins DoStringWithEnv allows. Globals of the configuration are not
+// visible, and assignments made while evaluating do not leak into it.
+func (e *Evaluator) Eval(vars map[string]interface{}) (interface{}, error) {
+	c := e.cfg
+	if r, release := c.acquireState(); r != nil {
+		defer release()
+		c = r
+	}
+
+	env := c.L.NewTable()
+	env.Metatable = e.base
+	for name, value := range vars {
+		lv, err := c.goToLua(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", name, err)
+		}
+		env.RawSetString(name, lv)
+	}
+
+	fn := c.L.NewFunctionFromProto(e.proto)
+	fn.Env = env
+
+	execCtx, restore := c.bindExecContext(executionContext(c.L), c.maxExecutionTime())
+	err := c.L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true})
+	restore()
+	if err != nil {
+		if ctxErr := contextError(execCtx, fmt.Sprintf("expression '%s'", e.expr), err); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, WrapLuaError(c.L, err)
+	}
+
+	result := c.L.Get(-1)
+	c.L.Pop(1)
+	return c.luaToGo(result, interfaceType)
+}
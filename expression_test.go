@@ -0,0 +1,84 @@
+package lugo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileExpression(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`secret = "hidden"`))
+
+	eval, err := cfg.CompileExpression(`user.plan == "pro" and user.age >= min_age`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		plan string
+		age  int
+		want bool
+	}{
+		{"pro", 30, true},
+		{"pro", 16, false},
+		{"free", 30, false},
+	}
+	for _, tt := range tests {
+		got, err := eval.Eval(map[string]interface{}{
+			"user":    map[string]interface{}{"plan": tt.plan, "age": tt.age},
+			"min_age": 18,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "plan=%s age=%d", tt.plan, tt.age)
+	}
+
+	// Only the given variables and safe built-ins are visible
+	eval, err = cfg.CompileExpression(`string.upper(name) .. tostring(secret)`)
+	require.NoError(t, err)
+	got, err := eval.Eval(map[string]interface{}{"name": "flag"})
+	require.NoError(t, err)
+	assert.Equal(t, "FLAGnil", got)
+
+	_, err = cfg.CompileExpression(`user.plan ==`)
+	assert.True(t, IsErrorCode(err, ErrParse))
+
+	eval, err = cfg.CompileExpression(`user.plan`)
+	require.NoError(t, err)
+	_, err = eval.Eval(nil)
+	assert.Error(t, err)
+}
+
+func BenchmarkExpression(b *testing.B) {
+	cfg := New()
+	defer cfg.Close()
+
+	const expr = `user.plan == "pro" and user.age >= 18`
+	user := map[string]interface{}{"plan": "pro", "age": 30}
+
+	b.Run("eval", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := cfg.SetGlobal("user", user); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := cfg.Eval(expr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("compiled", func(b *testing.B) {
+		eval, err := cfg.CompileExpression(expr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		vars := map[string]interface{}{"user": user}
+		for i := 0; i < b.N; i++ {
+			if _, err := eval.Eval(vars); err != nil {
+				b.Fatal(fmt.Errorf("iteration %d: %w", i, err))
+			}
+		}
+	})
+}
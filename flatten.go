@@ -0,0 +1,203 @@
+package lugo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Flatten walks the named global table and returns its leaf values keyed by
+// dotted path, e.g. "server.tls.enabled". Integer keys are written as
+// zero-based indexes, so the first element of servers is "servers.0".
+// Functions and empty tables have no flat representation and are omitted.
+func (c *Config) Flatten(name string) (map[string]interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	lv := c.L.GetGlobal(name)
+	if lv == lua.LNil {
+		return nil, &Error{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("configuration '%s' not found", name),
+		}
+	}
+
+	table, ok := lv.(*lua.LTable)
+	if !ok {
+		return nil, &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("configuration '%s' is not a table", name),
+		}
+	}
+
+	flat := make(map[string]interface{})
+	if err := c.flattenTable(table, "", flat, make(map[*lua.LTable]bool)); err != nil {
+		return nil, err
+	}
+	return flat, nil
+}
+
+// flattenTable adds the leaves of table to flat under prefix. onPath holds
+// the tables being walked so cycles are reported instead of recursing forever.
+func (c *Config) flattenTable(table *lua.LTable, prefix string, flat map[string]interface{}, onPath map[*lua.LTable]bool) error {
+	if onPath[table] {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("cannot flatten cyclic table at '%s'", prefix),
+		}
+	}
+	onPath[table] = true
+	defer delete(onPath, table)
+
+	var err error
+	table.ForEach(func(k, v lua.LValue) {
+		if err != nil {
+			return
+		}
+
+		var segment string
+		segment, err = flatKey(k, prefix)
+		if err != nil {
+			return
+		}
+		path := segment
+		if prefix != "" {
+			path = prefix + "." + segment
+		}
+
+		switch v := v.(type) {
+		case *lua.LTable:
+			err = c.flattenTable(v, path, flat, onPath)
+		case *lua.LFunction:
+			// Functions are not data
+		default:
+			var goVal interface{}
+			goVal, err = c.luaToGo(v, interfaceType)
+			if err != nil {
+				err = &Error{
+					Code:    ErrConversion,
+					Message: fmt.Sprintf("cannot flatten value at '%s'", path),
+					Cause:   err,
+				}
+				return
+			}
+			flat[path] = goVal
+		}
+	})
+	return err
+}
+
+// flatKey converts a table key to a path segment. Integer keys become
+// zero-based indexes; keys that would make the path ambiguous are rejected.
+func flatKey(k lua.LValue, prefix string) (string, error) {
+	switch k := k.(type) {
+	case lua.LString:
+		if strings.Contains(string(k), ".") {
+			return "", &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("cannot flatten key %q under '%s': keys must not contain '.'", string(k), prefix),
+			}
+		}
+		return string(k), nil
+	case lua.LNumber:
+		n := float64(k)
+		if n == math.Trunc(n) && n >= 1 {
+			return strconv.Itoa(int(n) - 1), nil
+		}
+	}
+	return "", &Error{
+		Code:    ErrInvalidType,
+		Message: fmt.Sprintf("cannot flatten key %s under '%s'", k.String(), prefix),
+	}
+}
+
+// Unflatten builds a nested table from dotted keys, the inverse of Flatten,
+// and stores it in the named global, replacing any previous value.
+// Intermediate tables are created as needed and numeric segments are
+// zero-based indexes, so "servers.0.host" sets servers[1].host.
+func (c *Config) Unflatten(name string, flat map[string]interface{}) error {
+	if name == "" {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "table name cannot be empty",
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.changed()
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	root := c.L.NewTable()
+	for _, key := range keys {
+		lv, err := c.goToLua(flat[key])
+		if err != nil {
+			return &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("failed to convert value for '%s'", key),
+				Cause:   err,
+			}
+		}
+
+		segments := strings.Split(key, ".")
+		table := root
+		for i, segment := range segments {
+			k, err := unflatKey(segment, key)
+			if err != nil {
+				return err
+			}
+
+			if i == len(segments)-1 {
+				if _, isTable := table.RawGet(k).(*lua.LTable); isTable {
+					return &Error{
+						Code:    ErrInvalidType,
+						Message: fmt.Sprintf("key '%s' conflicts with nested keys below it", key),
+					}
+				}
+				table.RawSet(k, lv)
+				break
+			}
+
+			switch next := table.RawGet(k).(type) {
+			case *lua.LTable:
+				table = next
+			case *lua.LNilType:
+				child := c.L.NewTable()
+				table.RawSet(k, child)
+				table = child
+			default:
+				return &Error{
+					Code:    ErrInvalidType,
+					Message: fmt.Sprintf("key '%s' conflicts with the value at '%s'", key, strings.Join(segments[:i+1], ".")),
+				}
+			}
+		}
+	}
+
+	c.L.SetGlobal(name, root)
+	return nil
+}
+
+// unflatKey converts a path segment to a table key. Numeric segments are
+// zero-based indexes and become one-based Lua integer keys.
+func unflatKey(segment, key string) (lua.LValue, error) {
+	if segment == "" {
+		return nil, &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("key '%s' contains an empty segment", key),
+		}
+	}
+	if n, err := strconv.Atoi(segment); err == nil && n >= 0 {
+		return lua.LNumber(n + 1), nil
+	}
+	return lua.LString(segment), nil
+}
@@ -0,0 +1,98 @@
+package lugo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlatten(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		config = {
+			name = "app",
+			server = {
+				port = 8080,
+				tls = { enabled = true, cert = "/etc/cert.pem" },
+			},
+			servers = {
+				{ host = "a.example.com" },
+				{ host = "b.example.com", weight = 2 },
+			},
+			tags = { "web", "prod" },
+			empty = {},
+			handler = function() end,
+		}
+	`))
+
+	flat, err := cfg.Flatten("config")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":               "app",
+		"server.port":        float64(8080),
+		"server.tls.enabled": true,
+		"server.tls.cert":    "/etc/cert.pem",
+		"servers.0.host":     "a.example.com",
+		"servers.1.host":     "b.example.com",
+		"servers.1.weight":   float64(2),
+		"tags.0":             "web",
+		"tags.1":             "prod",
+	}, flat)
+
+	_, err = cfg.Flatten("missing")
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+
+	require.NoError(t, cfg.DoString(`
+		dotted = { ["a.b"] = 1 }
+		cyclic = {}
+		cyclic.self = cyclic
+	`))
+	_, err = cfg.Flatten("dotted")
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+	_, err = cfg.Flatten("cyclic")
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+}
+
+func TestUnflattenRoundTrip(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	flat := map[string]interface{}{
+		"name":               "app",
+		"server.port":        8080,
+		"server.tls.enabled": true,
+		"servers.0.host":     "a.example.com",
+		"servers.1.host":     "b.example.com",
+		"tags.0":             "web",
+		"tags.1":             "prod",
+	}
+	require.NoError(t, cfg.Unflatten("config", flat))
+
+	require.NoError(t, cfg.DoString(`
+		assert(config.server.tls.enabled == true)
+		assert(#config.servers == 2)
+		assert(config.servers[2].host == "b.example.com")
+		assert(config.tags[1] == "web")
+	`))
+
+	roundTrip, err := cfg.Flatten("config")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":               "app",
+		"server.port":        float64(8080),
+		"server.tls.enabled": true,
+		"servers.0.host":     "a.example.com",
+		"servers.1.host":     "b.example.com",
+		"tags.0":             "web",
+		"tags.1":             "prod",
+	}, roundTrip)
+
+	// Conflicting and malformed keys are rejected
+	err = cfg.Unflatten("bad", map[string]interface{}{"a": 1, "a.b": 2})
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+	err = cfg.Unflatten("bad", map[string]interface{}{"a..b": 1})
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+}
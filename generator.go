@@ -3,14 +3,17 @@ package lugo
 import (
 	"bytes"
 	"fmt"
+	"math/big"
 	"reflect"
 	"strings"
+	"time"
 )
 
 // Generator provides a fluent API for generating Lua code
 type Generator struct {
-	buffer bytes.Buffer
-	indent int
+	buffer    bytes.Buffer
+	indent    int
+	fieldDocs bool
 }
 
 // NewGenerator creates a new Lua code generator
@@ -36,6 +39,13 @@ func (g *Generator) writeIndent() {
 	g.buffer.WriteString(strings.Repeat("    ", g.indent))
 }
 
+// WithFieldDocs makes Struct write the doc tag of each field as a comment
+// above it, producing self-documenting starter configs
+func (g *Generator) WithFieldDocs(enabled bool) *Generator {
+	g.fieldDocs = enabled
+	return g
+}
+
 // Table starts a new table declaration
 func (g *Generator) Table(name string) *Generator {
 	g.writeIndent()
@@ -64,11 +74,7 @@ func (g *Generator) EndTable() *Generator {
 // Field adds a field to the current table
 func (g *Generator) Field(name string, value interface{}) *Generator {
 	g.writeIndent()
-	if strings.Contains(name, " ") || strings.Contains(name, "-") {
-		g.buffer.WriteString(fmt.Sprintf("[\"%s\"]", name))
-	} else {
-		g.buffer.WriteString(name)
-	}
+	g.writeKey(name)
 	g.buffer.WriteString(" = ")
 	g.writeValue(value)
 	g.buffer.WriteString(",\n")
@@ -89,6 +95,65 @@ func (g *Generator) Array(values ...interface{}) *Generator {
 	return g
 }
 
+// Struct adds a table named name holding the fields of the struct v, keyed
+// by their lua tags as Get expects. Nested structs become nested tables,
+// slices arrays and maps keyed tables; time.Duration and time.Time values are
+// written as strings Get can parse back.
+func (g *Generator) Struct(name string, v interface{}) *Generator {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	g.writeIndent()
+	if name != "" {
+		g.writeKey(name)
+		g.buffer.WriteString(" = ")
+	}
+	g.writeValue(val.Interface())
+	if g.indent == 0 {
+		g.buffer.WriteString("\n")
+	} else {
+		g.buffer.WriteString(",\n")
+	}
+	return g
+}
+
+// writeStructFields writes the fields of the struct val, one per line
+func (g *Generator) writeStructFields(val reflect.Value) {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if isInlined(field, "lua") {
+			fieldVal := val.Field(i)
+			if fieldVal.Kind() == reflect.Ptr {
+				if fieldVal.IsNil() {
+					continue
+				}
+				fieldVal = fieldVal.Elem()
+			}
+			g.writeStructFields(fieldVal)
+			continue
+		}
+		if field.PkgPath != "" { // Skip unexported fields
+			continue
+		}
+		key := luaFieldName(field)
+		if key == "-" {
+			continue
+		}
+		if doc := field.Tag.Get("doc"); g.fieldDocs && doc != "" {
+			for _, line := range strings.Split(doc, "\n") {
+				g.Comment(line)
+			}
+		}
+		g.writeIndent()
+		g.writeKey(key)
+		g.buffer.WriteString(" = ")
+		g.writeValue(val.Field(i).Interface())
+		g.buffer.WriteString(",\n")
+	}
+}
+
 // Comment adds a comment
 func (g *Generator) Comment(text string) *Generator {
 	g.writeIndent()
@@ -108,6 +173,26 @@ func (g *Generator) Raw(code string) *Generator {
 	return g
 }
 
+// LuaExpr is a Lua expression written to the output verbatim, for values
+// that refer to locals or other code instead of literals
+type LuaExpr string
+
+// Local adds a local variable declaration
+func (g *Generator) Local(name string, value interface{}) *Generator {
+	g.writeIndent()
+	g.buffer.WriteString("local ")
+	g.buffer.WriteString(name)
+	g.buffer.WriteString(" = ")
+	g.writeValue(value)
+	g.buffer.WriteString("\n")
+	return g
+}
+
+// Require adds a local variable bound to a required module
+func (g *Generator) Require(localName, module string) *Generator {
+	return g.Local(localName, LuaExpr("require("+quoteLuaString(module)+")"))
+}
+
 // Function adds a function declaration
 func (g *Generator) Function(name string, params ...string) *Generator {
 	g.writeIndent()
@@ -136,11 +221,51 @@ func (g *Generator) writeValue(v interface{}) {
 		g.buffer.WriteString("nil")
 		return
 	}
+	if expr, ok := v.(LuaExpr); ok {
+		g.buffer.WriteString(string(expr))
+		return
+	}
+
+	switch x := v.(type) {
+	case time.Duration:
+		g.buffer.WriteString(quoteLuaString(x.String()))
+		return
+	case time.Time:
+		g.buffer.WriteString(quoteLuaString(x.Format(time.RFC3339Nano)))
+		return
+	case *big.Int:
+		g.buffer.WriteString(quoteLuaString(x.String()))
+		return
+	case *big.Float:
+		g.buffer.WriteString(quoteLuaString(x.Text('g', -1)))
+		return
+	}
 
 	val := reflect.ValueOf(v)
 	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			g.buffer.WriteString("nil")
+		} else {
+			g.writeValue(val.Elem().Interface())
+		}
+	case reflect.Struct:
+		switch x := v.(type) {
+		case big.Int:
+			g.writeValue(&x)
+			return
+		case big.Float:
+			g.writeValue(&x)
+			return
+		}
+		g.buffer.WriteString("{\n")
+		g.indent++
+		g.writeStructFields(val)
+		g.indent--
+		g.writeIndent()
+		g.buffer.WriteString("}")
 	case reflect.String:
-		g.buffer.WriteString(fmt.Sprintf("%q", v))
+		g.buffer.WriteString(luaStringLiteral(val.String()))
 	case reflect.Bool:
 		g.buffer.WriteString(fmt.Sprintf("%v", v))
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
@@ -164,11 +289,7 @@ func (g *Generator) writeValue(v interface{}) {
 			g.writeIndent()
 			k := iter.Key()
 			if k.Kind() == reflect.String {
-				if strings.Contains(k.String(), " ") || strings.Contains(k.String(), "-") {
-					g.buffer.WriteString(fmt.Sprintf("[\"%s\"]", k))
-				} else {
-					g.buffer.WriteString(k.String())
-				}
+				g.writeKey(k.String())
 			} else {
 				g.buffer.WriteString(fmt.Sprintf("[%v]", k))
 			}
@@ -183,3 +304,101 @@ func (g *Generator) writeValue(v interface{}) {
 		g.buffer.WriteString(fmt.Sprintf("%v", v))
 	}
 }
+
+// writeKey writes a table key, bracketing and quoting it when it is not a
+// valid Lua identifier
+func (g *Generator) writeKey(name string) {
+	if isLuaIdentifier(name) {
+		g.buffer.WriteString(name)
+		return
+	}
+	g.buffer.WriteString("[")
+	g.buffer.WriteString(quoteLuaString(name))
+	g.buffer.WriteString("]")
+}
+
+// luaKeywords are reserved words that cannot be used as bare table keys
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "if": true,
+	"in": true, "local": true, "nil": true, "not": true, "or": true,
+	"repeat": true, "return": true, "then": true, "true": true, "until": true,
+	"while": true,
+}
+
+// isLuaIdentifier reports whether name can be written as a bare Lua identifier.
+// Lua identifiers are ASCII only, so any multi-byte UTF-8 name is rejected.
+func isLuaIdentifier(name string) bool {
+	if name == "" || luaKeywords[name] {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		switch {
+		case ch == '_', 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z':
+		case '0' <= ch && ch <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// luaStringLiteral returns s as a Lua string literal, using the long-bracket
+// form for multiline strings so they stay readable. Strings whose other
+// control characters long brackets cannot carry are quoted instead.
+func luaStringLiteral(s string) string {
+	if !strings.Contains(s, "\n") {
+		return quoteLuaString(s)
+	}
+	for i := 0; i < len(s); i++ {
+		if ch := s[i]; (ch < 0x20 && ch != '\n' && ch != '\t') || ch == 0x7f {
+			return quoteLuaString(s)
+		}
+	}
+
+	// Pick a level whose closing bracket does not occur in s
+	level := ""
+	for strings.Contains(s+"]", "]"+level+"]") {
+		level += "="
+	}
+	// Lua drops a newline directly after the opening bracket, so one is
+	// added for strings that start with a newline
+	open := "[" + level + "["
+	if strings.HasPrefix(s, "\n") {
+		open += "\n"
+	}
+	return open + s + "]" + level + "]"
+}
+
+// quoteLuaString returns s as a double-quoted Lua string literal. Unlike Go's
+// %q it never emits \u or \x escapes, which Lua 5.1 does not understand, so
+// multi-byte UTF-8 sequences are written through as raw bytes.
+func quoteLuaString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch ch {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if ch < 0x20 || ch == 0x7f {
+				fmt.Fprintf(&b, "\\%03d", ch)
+			} else {
+				b.WriteByte(ch)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -1,9 +1,14 @@
 package lugo
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
 )
 
 func TestGenerator(t *testing.T) {
@@ -90,3 +95,184 @@ end
 		})
 	}
 }
+
+func TestGeneratorUTF8RoundTrip(t *testing.T) {
+	g := NewGenerator()
+	g.Table("config").
+		Field("greeting", "こんにちは世界 👋").
+		Field("名前", "设置").
+		Field("end", "keyword key").
+		Field("quoted", "line1\nline2 \"q\" \\ tab\t\u200b").
+		Field("labels", map[string]string{"😀": "grin"}).
+		EndTable()
+
+	code := g.String()
+	assert.Contains(t, code, `greeting = "こんにちは世界 👋"`)
+	assert.Contains(t, code, `["名前"] = "设置"`)
+	assert.Contains(t, code, `["end"] = "keyword key"`)
+
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(code))
+
+	var config map[string]interface{}
+	require.NoError(t, cfg.GetGlobal("config", &config))
+	assert.Equal(t, "こんにちは世界 👋", config["greeting"])
+	assert.Equal(t, "设置", config["名前"])
+	assert.Equal(t, "keyword key", config["end"])
+	assert.Equal(t, "line1\nline2 \"q\" \\ tab\t\u200b", config["quoted"])
+	assert.Equal(t, map[string]interface{}{"😀": "grin"}, config["labels"])
+}
+
+func TestGeneratorStringEscaping(t *testing.T) {
+	values := []string{
+		`plain`,
+		`say "hi"`,
+		`C:\path\`,
+		`\"`,
+		"tab\there\r\nand a\x00nul\x7f",
+		"first line\nsecond line",
+		"\nstarts with a newline",
+		"ends with a bracket]",
+		"has ]] and ]=] inside\nacross lines",
+		"multiline with \"quotes\" and \\ backslashes\n",
+	}
+
+	g := NewGenerator()
+	g.Table("config")
+	for i, v := range values {
+		g.Field(fmt.Sprintf("v%d", i), v)
+	}
+	g.EndTable()
+	code := g.String()
+	assert.Contains(t, code, "v5 = [[first line\nsecond line]]")
+	assert.Contains(t, code, "v8 = [==[has ]] and ]=] inside\nacross lines]==]")
+
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(code), code)
+	for i, v := range values {
+		got, err := cfg.GetRaw(fmt.Sprintf("config.v%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, v, got.String(), "value %d", i)
+	}
+}
+
+func TestGeneratorPreamble(t *testing.T) {
+	g := NewGenerator()
+	g.Require("defaults", "app.defaults").
+		Local("region", "eu-west-1").
+		Table("config").
+		Field("region", LuaExpr("region")).
+		Field("timeout", LuaExpr("defaults.timeout")).
+		EndTable()
+
+	want := `local defaults = require("app.defaults")
+local region = "eu-west-1"
+config = {
+    region = region,
+    timeout = defaults.timeout,
+}
+`
+	assert.Equal(t, want, g.String())
+
+	cfg := New()
+	defer cfg.Close()
+
+	cfg.L.PreloadModule("app.defaults", func(L *lua.LState) int {
+		mod := L.NewTable()
+		mod.RawSetString("timeout", lua.LNumber(30))
+		L.Push(mod)
+		return 1
+	})
+	require.NoError(t, cfg.DoString(g.String()))
+
+	var config struct {
+		Region  string `lua:"region"`
+		Timeout int    `lua:"timeout"`
+	}
+	require.NoError(t, cfg.Get(context.Background(), "config", &config))
+	assert.Equal(t, "eu-west-1", config.Region)
+	assert.Equal(t, 30, config.Timeout)
+}
+
+func TestGeneratorStruct(t *testing.T) {
+	type Database struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+	type Meta struct {
+		Owner string `lua:"owner"`
+	}
+	type ServiceConfig struct {
+		Meta
+		Name      string              `lua:"name"`
+		Enabled   bool                `lua:"enabled"`
+		Ratio     float64             `lua:"ratio"`
+		Timeout   time.Duration       `lua:"timeout"`
+		Started   time.Time           `lua:"started"`
+		Tags      []string            `lua:"tags"`
+		Primary   *Database           `lua:"primary"`
+		Databases map[string]Database `lua:"databases"`
+		Replicas  []Database          `lua:"replicas"`
+		Labels    map[string]string   `lua:"labels"`
+		Quoted    string              `lua:"end"`
+		Ignored   string              `lua:"-"`
+		internal  string
+	}
+
+	want := ServiceConfig{
+		Meta:      Meta{Owner: "platform"},
+		Name:      "api \"edge\"",
+		Enabled:   true,
+		Ratio:     0.25,
+		Timeout:   90 * time.Second,
+		Started:   time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Tags:      []string{"a", "b"},
+		Primary:   &Database{Host: "db1", Port: 5432},
+		Databases: map[string]Database{"analytics": {Host: "db2", Port: 5433}},
+		Replicas:  []Database{{Host: "r1", Port: 1}, {Host: "r2", Port: 2}},
+		Labels:    map[string]string{"team": "core"},
+		Quoted:    "keyword",
+	}
+	source := NewGenerator().Struct("service", want).String()
+
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.L.DoString(source), source)
+
+	var got ServiceConfig
+	require.NoError(t, cfg.Get(context.Background(), "service", &got))
+	assert.Equal(t, want, got)
+	assert.Contains(t, source, `timeout = "1m30s"`)
+	assert.Contains(t, source, `["end"] = "keyword"`)
+	assert.NotContains(t, source, "ignored")
+	assert.NotContains(t, source, "internal")
+}
+
+func TestGeneratorFieldDocs(t *testing.T) {
+	type Server struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port" doc:"The listen port"`
+		TLS  struct {
+			Cert string `lua:"cert" doc:"Path to the certificate\nin PEM format"`
+		} `lua:"tls" doc:"TLS settings"`
+	}
+	server := Server{Host: "localhost", Port: 8080}
+	server.TLS.Cert = "server.crt"
+
+	assert.Equal(t, `server = {
+    host = "localhost",
+    -- The listen port
+    port = 8080,
+    -- TLS settings
+    tls = {
+        -- Path to the certificate
+        -- in PEM format
+        cert = "server.crt",
+    },
+}
+`, NewGenerator().WithFieldDocs(true).Struct("server", server).String())
+
+	assert.NotContains(t, NewGenerator().Struct("server", server).String(), "--")
+}
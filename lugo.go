@@ -1,15 +1,28 @@
 package lugo
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"math/big"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unique"
 
 	lua "github.com/yuin/gopher-lua"
 	"go.uber.org/zap"
@@ -25,6 +38,48 @@ type Config struct {
 	hooks            map[HookType][]Hook
 	functionMetadata map[string]*FunctionMetadata
 	middlewareMap    map[string]func(lua.LGFunction) lua.LGFunction
+	middlewareMu     sync.RWMutex
+	allowedModules   map[string]bool
+	baseRequire      lua.LValue
+	packageTables    map[string]*lua.LTable
+	builtins         map[string]lua.LValue
+	resolveMeta      bool
+	toStringMeta     bool
+	auditFn          func(AuditRecord)
+	auditRedactor    AuditRedactor
+	loadTimeout      time.Duration
+	sourcePositions  map[string]string
+	globalWatchers   map[string][]GlobalWatcher
+	watchedGlobals   *lua.LTable
+	validation       bool
+	validators       map[string]ValidatorFunc
+	validatorFuncs   map[string]func(interface{}) error
+	environment      string
+	weaklyTyped      bool
+	profiling        bool
+	profile          ProfileReport
+	profileMu        sync.Mutex
+	pathGuards       bool
+	sandboxed        map[sandboxSlot]sandboxedGlobal
+	pool             *statePool
+	migrations       []migration
+	bindings         []*fieldBinding
+	errorTypes       []errorType
+	lenientDecoding  bool
+	zeroBased        bool
+	strictNames      bool
+	strictFields     bool
+	schemas          map[string]*SchemaValidator
+	templating       bool
+	templateVars     map[string]interface{}
+	deterministic    bool
+	internStrings    bool
+	decodeCache      *decodeCache
+	version          atomic.Uint64
+	types            map[string]reflect.Type
+	constants        map[string]bool
+	errorTypesMu     sync.RWMutex
+	closeOnce        sync.Once
 }
 
 // Option represents a configuration option
@@ -75,7 +130,6 @@ type ErrorCode int
 
 const (
 	ErrInvalidType ErrorCode = iota
-	ErrType        ErrorCode = ErrInvalidType // Alias ErrType to ErrInvalidType
 	ErrNotFound
 	ErrValidation
 	ErrSandbox
@@ -85,8 +139,12 @@ const (
 	ErrIO
 	ErrParse
 	ErrConversion
+	ErrStack
 )
 
+// ErrType is an alias of ErrInvalidType
+const ErrType = ErrInvalidType
+
 type Error struct {
 	Code     ErrorCode
 	Message  string
@@ -158,11 +216,17 @@ func New(opts ...Option) *Config {
 		functionMetadata: make(map[string]*FunctionMetadata),
 		middlewareMap:    make(map[string]func(lua.LGFunction) lua.LGFunction),
 	}
+	cfg.captureBuiltins()
 
 	for _, opt := range opts {
 		opt(cfg)
 	}
 
+	// The allowlist applies to every execution path, not only sandboxed loads
+	if cfg.allowedModules != nil {
+		cfg.installRequireAllowlist()
+	}
+
 	return cfg
 }
 
@@ -187,9 +251,152 @@ func WithMiddleware(middleware Middleware) Option {
 	}
 }
 
-// Close closes the Lua state
+// WithAllowedRequireModules restricts require to the given module names.
+// Once set, any module not in the list is denied.
+func WithAllowedRequireModules(modules ...string) Option {
+	return func(c *Config) {
+		if c.allowedModules == nil {
+			c.allowedModules = make(map[string]bool)
+		}
+		for _, name := range modules {
+			c.allowedModules[name] = true
+		}
+	}
+}
+
+// WithMetatableResolution makes struct decoding fall back to the metatable's
+// __index for fields that are not set on the table itself, so computed fields
+// on OO-style config objects are materialized
+func WithMetatableResolution(enabled bool) Option {
+	return func(c *Config) {
+		c.resolveMeta = enabled
+	}
+}
+
+// WithToStringMetamethods makes decoding into a string, and ExportLua, call
+// the __tostring metamethod of tables and userdata, so objects such as
+// versions or URLs decode into strings. Metamethods are Lua code, so each is
+// bounded by the sandbox's MaxExecutionTime, and the methods that run them
+// hold the write lock rather than sharing the state with other readers. Use
+// WithStatePool to keep such reads concurrent.
+func WithToStringMetamethods(enabled bool) Option {
+	return func(c *Config) {
+		c.toStringMeta = enabled
+	}
+}
+
+// WithValidation enables enforcement of `validate` struct tags in Get.
+// Supported rules are required, omitempty, required_if, min, max, len, oneof,
+// startswith, endswith, email, hostname, hostname_port, ip, url, semver,
+// duration, gtfield, unique, ref and dive, plus any registered with
+// RegisterValidator.
+func WithValidation(enabled bool) Option {
+	return func(c *Config) {
+		c.validation = enabled
+	}
+}
+
+// WithWeaklyTypedInput makes decoding coerce between strings, numbers and
+// booleans when a value does not match its target field, so a string "8080"
+// fills an int field and "true" a bool field. Values that cannot be coerced
+// still fail validation.
+func WithWeaklyTypedInput(enabled bool) Option {
+	return func(c *Config) {
+		c.weaklyTyped = enabled
+	}
+}
+
+// WithLenientDecoding makes decoding skip slice elements and map entries that
+// cannot be converted, as older versions did, instead of failing with an
+// error naming the offending element or key
+func WithLenientDecoding(enabled bool) Option {
+	return func(c *Config) {
+		c.lenientDecoding = enabled
+	}
+}
+
+// WithStrictRegistration makes the Register* functions return an error when
+// the name being registered is already defined, instead of silently replacing
+// the existing value. Use ReplaceFunction to swap an implementation on purpose.
+func WithStrictRegistration(enabled bool) Option {
+	return func(c *Config) {
+		c.strictNames = enabled
+	}
+}
+
+// WithStrictFields makes Get fail when a table has keys that match no field
+// of the struct it is decoded into, catching typos such as "prot = 8080".
+// SetStrict changes the setting at runtime, and GetStrict and GetLenient
+// choose per call.
+func WithStrictFields(enabled bool) Option {
+	return func(c *Config) {
+		c.strictFields = enabled
+	}
+}
+
+// SetStrict changes whether Get rejects unknown keys, as WithStrictFields
+func (c *Config) SetStrict(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.strictFields = enabled
+}
+
+// WithSchema runs v against the value decoded by every Get of the global
+// name, after tag validation, and fails the Get with ErrValidation when the
+// schema rejects it. The schema applies whether or not WithValidation is set.
+func WithSchema(name string, v *SchemaValidator) Option {
+	return func(c *Config) {
+		if c.schemas == nil {
+			c.schemas = make(map[string]*SchemaValidator)
+		}
+		c.schemas[name] = v
+	}
+}
+
+// WithStringInterning makes Get and the other decoding methods intern the
+// strings they produce, so identical strings, such as a hostname repeated in
+// hundreds of entries, share one copy once the Lua state no longer holds
+// them. It saves memory for large configs at the cost of a lookup per string.
+func WithStringInterning(enabled bool) Option {
+	return func(c *Config) {
+		c.internStrings = enabled
+	}
+}
+
+// WithZeroBasedArrays decodes tables that use index 0, as some generated
+// configs do, as arrays whose first element is at index 0. Without it such a
+// table fails to decode into a slice rather than silently losing element 0,
+// and decodes into interface{} as a map keyed by index.
+func WithZeroBasedArrays(enabled bool) Option {
+	return func(c *Config) {
+		c.zeroBased = enabled
+	}
+}
+
+// WithTimeoutPerLoad bounds how long each LoadFile may execute, in place of
+// Sandbox.MaxExecutionTime. A load that runs out of time is rolled back:
+// global variables are restored to what they were before the load started, so
+// no partially-applied configuration is left behind, and LoadFile returns an
+// ErrTimeout error. Tables that existed before the load and were modified in
+// place by it are not rolled back. A deadline on the context passed to
+// LoadFile shortens the limit for that load.
+func WithTimeoutPerLoad(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.loadTimeout = timeout
+	}
+}
+
+// Close closes the Lua state. It is safe to call more than once.
 func (c *Config) Close() {
-	c.L.Close()
+	if c == nil {
+		return
+	}
+	c.closeOnce.Do(func() {
+		c.pool.close()
+		if c.L != nil {
+			c.L.Close()
+		}
+	})
 }
 
 // RegisterHook registers a hook for a specific point
@@ -239,6 +446,13 @@ func (c *Config) RegisterType(ctx context.Context, name string, typeStruct inter
 		table = defaultTable
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.changed()
+	if c.types == nil {
+		c.types = make(map[string]reflect.Type)
+	}
+	c.types[name] = val.Type()
 	c.L.SetGlobal(name, table)
 	return nil
 }
@@ -261,11 +475,189 @@ func (c *Config) RegisterFunction(ctx context.Context, name string, fn interface
 	}
 
 	luaFn := c.createLuaFunction(name, final)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkNameFree(name); err != nil {
+		return err
+	}
 	c.L.SetGlobal(name, c.L.NewFunction(luaFn))
 
 	return nil
 }
 
+// ReplaceFunction swaps the implementation of an already registered function.
+// name may be a dotted namespace path such as "http.client.get". The new
+// implementation is wrapped with the configured middlewares, and any stored
+// metadata keeps its descriptive fields while its parameter and return types
+// are refreshed from the new signature.
+func (c *Config) ReplaceFunction(name string, fn interface{}) error {
+	wrapped, err := c.wrapGoFunction(fn)
+	if err != nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "failed to wrap function",
+			Cause:   err,
+		}
+	}
+
+	final := wrapped
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		final = c.middlewares[i](final)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	parts := strings.Split(name, ".")
+	funcName := parts[len(parts)-1]
+
+	var parent *lua.LTable
+	if len(parts) > 1 {
+		lv := c.L.GetGlobal(parts[0])
+		for _, part := range parts[1 : len(parts)-1] {
+			table, ok := lv.(*lua.LTable)
+			if !ok {
+				lv = lua.LNil
+				break
+			}
+			lv = table.RawGetString(part)
+		}
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return &Error{
+				Code:    ErrNotFound,
+				Message: fmt.Sprintf("function '%s' not found", name),
+			}
+		}
+		parent = table
+	}
+
+	var current lua.LValue
+	if parent != nil {
+		current = parent.RawGetString(funcName)
+	} else {
+		current = c.L.GetGlobal(funcName)
+	}
+	if _, ok := current.(*lua.LFunction); !ok {
+		return &Error{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("function '%s' not found", name),
+		}
+	}
+
+	luaFn := c.L.NewFunction(c.createLuaFunction(name, final))
+	if parent != nil {
+		parent.RawSetString(funcName, luaFn)
+	} else {
+		c.L.SetGlobal(funcName, luaFn)
+	}
+
+	if metadata, ok := c.functionMetadata[funcName]; ok {
+		c.functionMetadata[funcName] = refreshSignatureMetadata(metadata, reflect.TypeOf(fn))
+	}
+
+	return nil
+}
+
+// refreshSignatureMetadata returns a copy of metadata whose parameter and return
+// types describe ft. Names and descriptions are kept for positions that still exist.
+func refreshSignatureMetadata(metadata *FunctionMetadata, ft reflect.Type) *FunctionMetadata {
+	updated := *metadata
+	contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+
+	updated.Params = nil
+	for i := 0; i < ft.NumIn(); i++ {
+		if i == 0 && ft.In(i).Implements(contextType) {
+			continue
+		}
+		param := ParamMetadata{Name: fmt.Sprintf("arg%d", len(updated.Params)+1)}
+		if idx := len(updated.Params); idx < len(metadata.Params) {
+			param = metadata.Params[idx]
+		}
+		param.Type = ft.In(i).String()
+		updated.Params = append(updated.Params, param)
+	}
+
+	updated.Returns = nil
+	for i := 0; i < ft.NumOut(); i++ {
+		if ft.Out(i).Implements(errorType) {
+			continue
+		}
+		ret := ReturnMetadata{Name: fmt.Sprintf("result%d", len(updated.Returns)+1)}
+		if idx := len(updated.Returns); idx < len(metadata.Returns) {
+			ret = metadata.Returns[idx]
+		}
+		ret.Type = ft.Out(i).String()
+		updated.Returns = append(updated.Returns, ret)
+	}
+
+	return &updated
+}
+
+// SimpleFunc is a Go function that receives its Lua arguments as natural Go values
+type SimpleFunc func(args []interface{}) ([]interface{}, error)
+
+// RegisterSimpleFunc registers a function without reflecting over its signature.
+// Arguments are converted with the same rules as Call results, and each returned
+// value is converted back to Lua. A non-nil error is raised as a Lua error.
+func (c *Config) RegisterSimpleFunc(name string, fn SimpleFunc) error {
+	if name == "" {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "function name cannot be empty",
+		}
+	}
+
+	if fn == nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "function cannot be nil",
+		}
+	}
+
+	wrapped := func(ctx context.Context, L *lua.LState) ([]lua.LValue, error) {
+		args := make([]interface{}, L.GetTop())
+		for i := range args {
+			arg, err := c.luaToGo(L.Get(i+1), reflect.TypeOf((*interface{})(nil)).Elem())
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i+1, err)
+			}
+			args[i] = arg
+		}
+
+		results, err := fn(args)
+		if err != nil {
+			return nil, err
+		}
+
+		luaResults := make([]lua.LValue, len(results))
+		for i, result := range results {
+			lv, err := c.goToLua(result)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert return value: %w", err)
+			}
+			luaResults[i] = lv
+		}
+		return luaResults, nil
+	}
+
+	// Apply middlewares in reverse order
+	final := LuaFunction(wrapped)
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		final = c.middlewares[i](final)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkNameFree(name); err != nil {
+		return err
+	}
+	c.L.SetGlobal(name, c.L.NewFunction(c.createLuaFunction(name, final)))
+	return nil
+}
+
 // RegisterFunctionTable registers multiple functions in a table with context
 func (c *Config) RegisterFunctionTable(ctx context.Context, name string, funcs map[string]interface{}) error {
 	if name == "" {
@@ -295,10 +687,10 @@ func (c *Config) RegisterFunctionTable(ctx context.Context, name string, funcs m
 	// Create the table outside the lock
 	table := c.L.NewTable()
 
-	// Prepare all functions before acquiring the lock
-	luaFuncs := make(map[string]lua.LGFunction)
-	for funcName, fn := range funcs {
-		wrapped, err := c.wrapGoFunction(fn)
+	// Prepare all functions before acquiring the lock, in name order so the
+	// first failure reported is the same on every run
+	for _, funcName := range slices.Sorted(maps.Keys(funcs)) {
+		wrapped, err := c.wrapGoFunction(funcs[funcName])
 		if err != nil {
 			return &Error{
 				Code:    ErrInvalidType,
@@ -308,40 +700,16 @@ func (c *Config) RegisterFunctionTable(ctx context.Context, name string, funcs m
 		}
 
 		// Create the Lua function wrapper that captures the context
-		luaFn := func(L *lua.LState) int {
-			defer func() {
-				if r := recover(); r != nil {
-					c.logger.Error("function panic",
-						zap.String("function", funcName),
-						zap.Any("panic", r),
-					)
-					L.RaiseError("function execution failed: %v", r)
-				}
-			}()
-
-			results, err := wrapped(ctx, L)
-			if err != nil {
-				L.RaiseError("%v", err)
-				return 0
-			}
-
-			for _, result := range results {
-				L.Push(result)
-			}
-
-			return len(results)
-		}
-
-		luaFuncs[funcName] = luaFn
-	}
-
-	// Register all functions in the table
-	for funcName, luaFn := range luaFuncs {
+		luaFn := c.createLuaFunctionWithContext(ctx, name+"."+funcName, wrapped)
 		table.RawSetString(funcName, c.L.NewFunction(luaFn))
 	}
 
 	// Only lock when modifying global state
 	c.mu.Lock()
+	if err := c.checkNameFree(name); err != nil {
+		c.mu.Unlock()
+		return err
+	}
 	c.L.SetGlobal(name, table)
 	c.mu.Unlock()
 
@@ -350,140 +718,782 @@ func (c *Config) RegisterFunctionTable(ctx context.Context, name string, funcs m
 	return c.runHooks(ctx, AfterExec, event)
 }
 
-// LoadFile loads and executes a Lua file with context and hooks
-func (c *Config) LoadFile(ctx context.Context, filename string) error {
-	start := time.Now()
-	event := HookEvent{
-		Type: BeforeLoad,
-		Name: filename,
-	}
-
-	if err := c.runHooks(ctx, BeforeLoad, event); err != nil {
-		return &Error{
-			Code:    ErrExecution,
-			Message: "before load hook failed",
-			Cause:   err,
-		}
-	}
-
-	// Apply sandbox restrictions
-	if err := c.applySandboxRestrictions(); err != nil {
-		return &Error{
-			Code:    ErrSandbox,
-			Message: "failed to apply sandbox restrictions",
-			Cause:   err,
-		}
-	}
-
-	err := c.L.DoFile(filename)
-	elapsed := time.Since(start)
-
-	event.Elapsed = elapsed
-	event.Error = err
-
+// RegisterFunctionWithOptions registers a Go function like RegisterFunction,
+// with the namespace, alias, metadata and call hook support of
+// RegisterLuaFunctionWithOptions
+func (c *Config) RegisterFunctionWithOptions(ctx context.Context, name string, fn interface{}, opts FunctionOptions) error {
+	wrapped, err := c.wrapGoFunction(fn)
 	if err != nil {
 		return &Error{
-			Code:    ErrExecution,
-			Message: "failed to load file",
+			Code:    ErrInvalidType,
+			Message: "failed to wrap function",
 			Cause:   err,
 		}
 	}
 
-	return c.runHooks(ctx, AfterLoad, event)
-}
-
-// Get retrieves the configuration into the provided struct with validation
-func (c *Config) Get(ctx context.Context, name string, target interface{}) error {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	lv := c.L.GetGlobal(name)
-	if lv == lua.LNil {
-		return &Error{
-			Code:    ErrNotFound,
-			Message: fmt.Sprintf("configuration '%s' not found", name),
-		}
-	}
-
-	if err := c.validateValue(lv, reflect.TypeOf(target).Elem()); err != nil {
-		return &Error{
-			Code:    ErrValidation,
-			Message: "validation failed",
-			Cause:   err,
-		}
+	// Apply middlewares in reverse order
+	final := wrapped
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		final = c.middlewares[i](final)
 	}
 
-	return c.luaToStruct(lv, target)
+	return c.RegisterLuaFunctionWithOptions(name, c.bindLuaFunction(ctx, final), opts)
 }
 
-// Helper functions
-
-func (c *Config) createLuaFunction(name string, fn LuaFunction) lua.LGFunction {
+// bindLuaFunction adapts a LuaFunction to a plain lua.LGFunction using ctx.
+// Unlike createLuaFunction it adds no panic recovery or auditing, for callers
+// that register through RegisterLuaFunctionWithOptions which provides both.
+func (c *Config) bindLuaFunction(ctx context.Context, fn LuaFunction) lua.LGFunction {
 	return func(L *lua.LState) int {
-		defer func() {
-			if r := recover(); r != nil {
-				c.logger.Error("function panic",
-					zap.String("function", name),
-					zap.Any("panic", r),
-				)
-				L.RaiseError("function execution failed: %v", r)
-			}
-		}()
-
-		ctx := context.Background()
 		results, err := fn(ctx, L)
 		if err != nil {
-			L.RaiseError("%v", err)
+			c.raiseError(L, err)
 			return 0
 		}
-
 		for _, result := range results {
 			L.Push(result)
 		}
-
 		return len(results)
 	}
 }
 
-func (c *Config) applySandboxRestrictions() error {
-	// Create a restricted environment
-	restricted := c.L.NewTable()
+// FunctionSpec describes a function registered with RegisterFunctionTableWithOptions
+type FunctionSpec struct {
+	Func    interface{}     // Go function, converted like RegisterFunction
+	Options FunctionOptions // Metadata, aliases, middleware and call hooks (Namespace is ignored)
+}
+
+// RegisterFunctionTableWithOptions registers a table of Go functions where each
+// function carries its own options, using the same machinery as
+// RegisterLuaFunctionWithOptions with the table name as the namespace
+func (c *Config) RegisterFunctionTableWithOptions(ctx context.Context, name string, specs map[string]FunctionSpec) error {
+	if name == "" {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "table name cannot be empty",
+		}
+	}
+
+	if len(specs) == 0 {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "functions map cannot be empty",
+		}
+	}
+
+	event := HookEvent{
+		Type: BeforeExec,
+		Name: name,
+		Args: []interface{}{specs},
+	}
+	if err := c.runHooks(ctx, BeforeExec, event); err != nil {
+		return err
+	}
+
+	// Check and wrap every function before touching the Lua state, so a bad
+	// spec leaves no half-registered table behind
+	funcNames := slices.Sorted(maps.Keys(specs))
+	luaFuncs := make(map[string]lua.LGFunction, len(specs))
+	taken := make(map[string]bool)
+	for _, funcName := range funcNames {
+		spec := specs[funcName]
+		if funcName == "" {
+			return &Error{
+				Code:    ErrInvalidType,
+				Message: "function name cannot be empty",
+			}
+		}
+		for _, n := range append([]string{funcName}, spec.Options.Aliases...) {
+			if c.strictNames && taken[n] {
+				return &Error{
+					Code:    ErrInvalidType,
+					Message: fmt.Sprintf("'%s.%s' is already defined", name, n),
+				}
+			}
+			taken[n] = true
+		}
+
+		wrapped, err := c.wrapGoFunction(spec.Func)
+		if err != nil {
+			return &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("failed to wrap function '%s'", funcName),
+				Cause:   err,
+			}
+		}
+
+		luaFuncs[funcName] = c.bindLuaFunction(ctx, wrapped)
+	}
+
+	c.mu.Lock()
+	if err := c.checkNameFree(name); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.L.SetGlobal(name, c.L.NewTable())
+	c.mu.Unlock()
+
+	for _, funcName := range funcNames {
+		luaFn := luaFuncs[funcName]
+		opts := specs[funcName].Options
+		opts.Namespace = name
+		if err := c.RegisterLuaFunctionWithOptions(funcName, luaFn, opts); err != nil {
+			return err
+		}
+	}
+
+	event.Type = AfterExec
+	return c.runHooks(ctx, AfterExec, event)
+}
+
+// LoadFile loads and executes a Lua file with context and hooks. With
+// WithTemplating, a file whose name ends in ".tmpl" is rendered as a template
+// first, and the rendered source is loaded as LoadBytes does.
+func (c *Config) LoadFile(ctx context.Context, filename string) error {
+	if c.templating && strings.HasSuffix(filename, ".tmpl") {
+		rendered, err := renderTemplate(ctx, filename, TemplateConfig{Variables: c.templateVariables()})
+		if err != nil {
+			return &Error{
+				Code:    ErrExecution,
+				Message: fmt.Sprintf("failed to render template %s", filename),
+				Cause:   err,
+			}
+		}
+		return c.LoadBytes(ctx, filename, rendered)
+	}
+	return c.loadChunk(ctx, filename, c.recordSourcePositions, func() (*lua.LFunction, error) {
+		return c.L.LoadFile(filename)
+	})
+}
+
+// LoadBytes loads and executes Lua source held in memory, such as a config
+// embedded with go:embed or fetched from a database, exactly as LoadFile does.
+// name is used as the chunk name in errors, hooks and source positions.
+func (c *Config) LoadBytes(ctx context.Context, name string, data []byte) error {
+	record := func(name string) {
+		c.recordChunkPositions(name, bytes.NewReader(data))
+	}
+	return c.loadChunk(ctx, name, record, func() (*lua.LFunction, error) {
+		return c.L.Load(bytes.NewReader(data), name)
+	})
+}
+
+// LoadReader reads r to the end and loads the source like LoadBytes
+func (c *Config) LoadReader(ctx context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return &Error{
+			Code:    ErrIO,
+			Message: fmt.Sprintf("failed to read %s", name),
+			Cause:   err,
+		}
+	}
+	return c.LoadBytes(ctx, name, data)
+}
+
+// loadChunk runs the chunk returned by compile with load hooks, sandbox
+// restrictions, the load timeout, migrations and bindings. record stores the
+// source positions of the chunk's assignments.
+func (c *Config) loadChunk(ctx context.Context, filename string, record func(string), compile func() (*lua.LFunction, error)) error {
+	start := time.Now()
+	event := HookEvent{
+		Type: BeforeLoad,
+		Name: filename,
+	}
+
+	if err := c.runHooks(ctx, BeforeLoad, event); err != nil {
+		return &Error{
+			Code:    ErrExecution,
+			Message: "before load hook failed",
+			Cause:   err,
+		}
+	}
+
+	record(filename)
+
+	// Apply sandbox restrictions for the duration of the load
+	defer c.restoreSandbox()
+	if err := c.applySandboxRestrictions(); err != nil {
+		return &Error{
+			Code:    ErrSandbox,
+			Message: "failed to apply sandbox restrictions",
+			Cause:   err,
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &Error{
+			Code:    ErrCanceled,
+			Message: fmt.Sprintf("loading %s was cancelled before it started", filename),
+			Cause:   err,
+		}
+	}
+
+	timeout := c.loadTimeout
+	if timeout <= 0 {
+		timeout = c.maxExecutionTime()
+	}
+
+	var snapshot globalsSnapshot
+	loadCtx, restore := c.bindExecContext(ctx, timeout)
+	if loadCtx != nil {
+		snapshot = c.snapshotGlobals()
+	}
+
+	// Compile and run separately, as DoFile does, so each phase can be timed
+	parseStart := time.Now()
+	fn, err := compile()
+	parsed := time.Since(parseStart)
+	if err == nil {
+		c.L.Push(fn)
+		err = c.L.PCall(0, lua.MultRet, nil)
+	}
+	executed := time.Since(parseStart) - parsed
+	elapsed := time.Since(start)
+	restore()
+	c.changed()
+
+	if c.profiling {
+		c.recordProfile(func(p *ProfileReport) {
+			*p = ProfileReport{File: filename, Parse: parsed, Execute: executed}
+		})
+	}
+
+	event.Elapsed = elapsed
+	event.Error = err
+
+	if err != nil {
+		if ctxErr := contextError(loadCtx, "loading "+filename, err); ctxErr != nil {
+			c.restoreGlobals(snapshot)
+			ctxErr.Message += "; globals were rolled back"
+			return ctxErr
+		}
+		return &Error{
+			Code:    ErrExecution,
+			Message: "failed to load file",
+			Cause:   plainLuaError(err),
+		}
+	}
+
+	if err := c.runMigrations(); err != nil {
+		return err
+	}
+	if err := c.applyBindings(); err != nil {
+		return err
+	}
+
+	return c.runHooks(ctx, AfterLoad, event)
+}
+
+// maxExecutionTime returns the sandbox limit on a single script execution
+func (c *Config) maxExecutionTime() time.Duration {
+	if c.sandbox == nil {
+		return 0
+	}
+	return c.sandbox.MaxExecutionTime
+}
+
+// bindExecContext makes running scripts stop when ctx ends or, if timeout is
+// positive, once timeout has elapsed, and exposes ctx to the Go functions
+// they call. It returns the context the Lua state is bound to, or nil when
+// there is nothing to bind, and a function that unbinds it, restoring any
+// context the state had before.
+func (c *Config) bindExecContext(ctx context.Context, timeout time.Duration) (context.Context, func()) {
+	if timeout <= 0 && ctx == context.Background() {
+		return nil, func() {}
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	previous := c.L.Context()
+	c.L.SetContext(ctx)
+	bound := &boundContext{Context: ctx}
+	return bound, func() {
+		bound.err, bound.unbound = ctx.Err(), true
+		cancel()
+		if previous != nil {
+			c.L.SetContext(previous)
+		} else {
+			c.L.RemoveContext()
+		}
+	}
+}
+
+// boundContext is a context returned by bindExecContext. Once unbound it
+// keeps reporting the error it had at that moment, so the cancellation that
+// releases its timer is not mistaken for the script being cancelled.
+type boundContext struct {
+	context.Context
+	err     error
+	unbound bool
+}
+
+func (b *boundContext) Err() error {
+	if b.unbound {
+		return b.err
+	}
+	return b.Context.Err()
+}
+
+// contextError describes err, returned by a script run bound to execCtx, as
+// ErrTimeout or ErrCanceled when execCtx has ended. It returns nil when the
+// failure had nothing to do with the context.
+func contextError(execCtx context.Context, what string, err error) *Error {
+	if execCtx == nil || execCtx.Err() == nil {
+		return nil
+	}
+	if errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+		return &Error{
+			Code:    ErrTimeout,
+			Message: what + " did not finish in time",
+			Cause:   err,
+		}
+	}
+	return &Error{
+		Code:    ErrCanceled,
+		Message: what + " was cancelled",
+		Cause:   err,
+	}
+}
+
+// executionContext returns the context of the script running on L, so Go
+// functions called from Lua see the context passed to LoadFile or CallContext
+func executionContext(L *lua.LState) context.Context {
+	if ctx := L.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// runScript runs fn under the sandbox execution time limit and the context
+// of any script already running, reporting a script that runs out of time as
+// ErrTimeout
+func (c *Config) runScript(fn func() error) error {
+	execCtx, restore := c.bindExecContext(executionContext(c.L), c.maxExecutionTime())
+	err := fn()
+	restore()
+	c.changed()
+
+	if err == nil {
+		return nil
+	}
+	if ctxErr := contextError(execCtx, "script", err); ctxErr != nil {
+		return ctxErr
+	}
+	return WrapLuaError(c.L, err)
+}
+
+// globalsSnapshot is a shallow copy of each table returned by globalTables
+type globalsSnapshot map[*lua.LTable]map[lua.LValue]lua.LValue
+
+// snapshotGlobals returns a shallow copy of the global variables
+func (c *Config) snapshotGlobals() globalsSnapshot {
+	snapshot := make(globalsSnapshot)
+	for _, table := range c.globalTables() {
+		values := make(map[lua.LValue]lua.LValue)
+		table.ForEach(func(k, v lua.LValue) {
+			values[k] = v
+		})
+		snapshot[table] = values
+	}
+	return snapshot
+}
+
+// restoreGlobals resets the global variables to a snapshot taken by
+// snapshotGlobals. Watchers of a watched global are told about the change
+// when its value is restored.
+func (c *Config) restoreGlobals(snapshot globalsSnapshot) {
+	for _, table := range c.globalTables() {
+		values, ok := snapshot[table]
+		if !ok {
+			continue
+		}
+
+		var added []lua.LValue
+		table.ForEach(func(k, _ lua.LValue) {
+			if _, ok := values[k]; !ok {
+				added = append(added, k)
+			}
+		})
+		for _, k := range added {
+			c.restoreGlobal(table, k, lua.LNil)
+		}
+		for k, v := range values {
+			c.restoreGlobal(table, k, v)
+		}
+	}
+}
+
+// restoreGlobal sets table[k] to v without metamethods, notifying the
+// watchers of k if table holds the watched globals and the value changes
+func (c *Config) restoreGlobal(table *lua.LTable, k, v lua.LValue) {
+	old := table.RawGet(k)
+	table.RawSet(k, v)
+	if table != c.watchedGlobals || old == v {
+		return
+	}
+	if name, ok := k.(lua.LString); ok {
+		for _, watcher := range c.globalWatchers[string(name)] {
+			watcher(old, v)
+		}
+	}
+}
+
+// LoadFileIfExists loads a Lua file like LoadFile, but returns nil if the file
+// does not exist. Any other error, such as a permission or syntax error, is returned.
+func (c *Config) LoadFileIfExists(ctx context.Context, filename string) error {
+	if _, err := os.Stat(filename); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return &Error{
+			Code:    ErrIO,
+			Message: fmt.Sprintf("failed to stat %s", filename),
+			Cause:   err,
+		}
+	}
+
+	return c.LoadFile(ctx, filename)
+}
+
+// Get retrieves the configuration into the provided struct with validation.
+// target may also point to a slice or map, e.g. *[]ServerConfig for a global
+// holding an array of tables, or to an interface{}, which receives the
+// natural Go value: map[string]interface{}, []interface{} or a scalar.
+func (c *Config) Get(ctx context.Context, name string, target interface{}) error {
+	c.mu.RLock()
+	strict := c.strictFields
+	c.mu.RUnlock()
+	return c.get(ctx, name, target, strict)
+}
+
+// GetStrict retrieves the configuration like Get, but fails if the table, or
+// a nested table decoded into a struct, has keys that match no field,
+// whatever WithStrictFields or SetStrict say
+func (c *Config) GetStrict(ctx context.Context, name string, target interface{}) error {
+	return c.get(ctx, name, target, true)
+}
+
+// GetLenient retrieves the configuration like Get, ignoring keys that match
+// no field even when strict fields are enabled
+func (c *Config) GetLenient(ctx context.Context, name string, target interface{}) error {
+	return c.get(ctx, name, target, false)
+}
+
+// decode validates and decodes the global name into target, bypassing the
+// decode cache
+func (c *Config) decode(ctx context.Context, name string, target interface{}, strict bool) error {
+	if r, release := c.acquireState(); r != nil {
+		defer release()
+		return r.decode(ctx, name, target, strict)
+	}
+
+	defer c.readLock()()
+
+	lv := c.L.GetGlobal(name)
+	if lv == lua.LNil {
+		return &Error{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("configuration '%s' not found", name),
+		}
+	}
+
+	d := c.newDecoder()
+	d.opts.DisallowUnknownKeys = strict
+	return c.decodeGlobal(name, lv, target, d)
+}
+
+// decodeGlobal checks lv, the value of the global name, against the type of
+// target, decodes it into target with d, and enforces validate tags and the
+// schema registered for name. Get and GetInto share it so they report the
+// same errors. The caller must hold the lock, see readLock.
+func (c *Config) decodeGlobal(name string, lv lua.LValue, target interface{}, d *decoder) error {
+	var validated, converted time.Duration
+	if c.profiling {
+		defer func() {
+			c.recordProfile(func(p *ProfileReport) {
+				p.Global, p.Validate, p.Convert = name, validated, converted
+			})
+		}()
+	}
+
+	phaseStart := time.Now()
+	if err := c.validateValueWith(lv, reflect.TypeOf(target).Elem(), name, d); err != nil {
+		return &Error{
+			Code:    ErrValidation,
+			Message: "validation failed",
+			Cause:   ValidationErrors(nil).add(name, err, "").relativeTo(name),
+		}
+	}
+	validated = time.Since(phaseStart)
+
+	phaseStart = time.Now()
+	if err := c.decodeInto(lv, target, d); err != nil {
+		var lugoErr *Error
+		if errors.As(err, &lugoErr) {
+			return err
+		}
+		return &Error{
+			Code:    ErrConversion,
+			Message: fmt.Sprintf("failed to decode '%s'", name),
+			Cause:   err,
+		}
+	}
+	converted = time.Since(phaseStart)
+
+	if c.validation {
+		phaseStart = time.Now()
+		val := reflect.ValueOf(target).Elem()
+		if err := c.validateNested(val, val, ""); err != nil {
+			return &Error{
+				Code:    ErrValidation,
+				Message: "validation failed",
+				Cause:   ValidationErrors(nil).add("", err, ""),
+			}
+		}
+		validated += time.Since(phaseStart)
+	}
+
+	if schema := c.schemas[name]; schema != nil {
+		phaseStart = time.Now()
+		if err := schema.Validate(target); err != nil {
+			return &Error{
+				Code:    ErrValidation,
+				Message: fmt.Sprintf("schema validation failed for '%s'", name),
+				Cause:   err,
+			}
+		}
+		validated += time.Since(phaseStart)
+	}
+
+	return nil
+}
+
+// decodeInto decodes lv into the value target points to. Structs are filled
+// field by field, keeping fields the table does not set; other targets, such
+// as slices and maps, are replaced by the converted value.
+func (c *Config) decodeInto(lv lua.LValue, target interface{}, d *decoder) error {
+	val := reflect.ValueOf(target)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer")
+	}
+	if val.Elem().Kind() == reflect.Struct {
+		return c.luaToStructWith(lv, target, d)
+	}
+
+	goval, err := c.luaToGoWith(lv, val.Elem().Type(), d)
+	if err != nil {
+		return err
+	}
+	rv, err := assignableValue(goval, val.Elem().Type())
+	if err != nil {
+		return err
+	}
+	val.Elem().Set(rv)
+	return nil
+}
+
+// GetWithFallbackChain decodes the first of names that is defined into
+// target, as Get does. names[0] is the current name and the rest are older
+// names kept for compatibility; using one of them logs a deprecation warning.
+// Errors from decoding a defined name are returned without trying the rest.
+func (c *Config) GetWithFallbackChain(ctx context.Context, target interface{}, names ...string) error {
+	if len(names) == 0 {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "at least one configuration name is required",
+		}
+	}
+
+	for i, name := range names {
+		c.mu.RLock()
+		defined := c.L.GetGlobal(name) != lua.LNil
+		c.mu.RUnlock()
+		if !defined {
+			continue
+		}
+
+		if i > 0 {
+			c.logger.Warn("configuration uses a deprecated name",
+				zap.String("name", name),
+				zap.String("preferred", names[0]))
+		}
+		return c.Get(ctx, name, target)
+	}
 
-	// Add safe basic functions
-	safeFuncs := map[string]lua.LGFunction{
-		"assert":   c.L.GetGlobal("assert").(*lua.LFunction).GFunction,
-		"error":    c.L.GetGlobal("error").(*lua.LFunction).GFunction,
-		"ipairs":   c.L.GetGlobal("ipairs").(*lua.LFunction).GFunction,
-		"next":     c.L.GetGlobal("next").(*lua.LFunction).GFunction,
-		"pairs":    c.L.GetGlobal("pairs").(*lua.LFunction).GFunction,
-		"select":   c.L.GetGlobal("select").(*lua.LFunction).GFunction,
-		"tonumber": c.L.GetGlobal("tonumber").(*lua.LFunction).GFunction,
-		"tostring": c.L.GetGlobal("tostring").(*lua.LFunction).GFunction,
-		"type":     c.L.GetGlobal("type").(*lua.LFunction).GFunction,
-		"unpack":   c.L.GetGlobal("unpack").(*lua.LFunction).GFunction,
+	return &Error{
+		Code:    ErrNotFound,
+		Message: fmt.Sprintf("none of the configurations %s were found", strings.Join(names, ", ")),
+	}
+}
+
+// ValidatePath validates only the subtree at path within the named global
+// against the matching portion of schema, which is a struct (or pointer to
+// struct) shaped like the full configuration. This allows re-validating a
+// single changed key without surfacing unrelated issues elsewhere.
+func (c *Config) ValidatePath(ctx context.Context, name, path string, schema interface{}) error {
+	if schema == nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "schema cannot be nil",
+		}
+	}
+
+	defer c.readLock()()
+
+	if c.L.GetGlobal(name) == lua.LNil {
+		return &Error{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("configuration '%s' not found", name),
+		}
+	}
+
+	t, err := schemaTypeAt(reflect.TypeOf(schema), strings.Split(path, "."))
+	if err != nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("path '%s' not found in schema", path),
+			Cause:   err,
+		}
+	}
+
+	lv := c.lookupPath(name + "." + path)
+	if err := c.validateValue(lv, t, name+"."+path); err != nil {
+		return &Error{
+			Code:    ErrValidation,
+			Message: fmt.Sprintf("validation failed at %s", path),
+			Cause:   err,
+		}
 	}
 
-	// Add safe standard libraries
-	safeLibs := map[string]*lua.LTable{
-		"string": c.L.GetGlobal("string").(*lua.LTable),
-		"table":  c.L.GetGlobal("table").(*lua.LTable),
-		"math":   c.L.GetGlobal("math").(*lua.LTable),
+	return nil
+}
+
+// schemaTypeAt walks t along segments, matching struct fields by Lua name or
+// Go name, and stepping into map and slice element types
+func schemaTypeAt(t reflect.Type, segments []string) (reflect.Type, error) {
+	for _, seg := range segments {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			found := false
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				if !field.IsExported() {
+					continue
+				}
+				if seg == luaFieldName(field) || seg == field.Name {
+					t = field.Type
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("no field %s in %v", seg, t)
+			}
+		case reflect.Map, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("cannot descend into %v at %s", t, seg)
+		}
 	}
+	return t, nil
+}
+
+// Helper functions
+
+// createLuaFunction wraps fn so it receives the context of the script that
+// calls it
+func (c *Config) createLuaFunction(name string, fn LuaFunction) lua.LGFunction {
+	return c.wrapLuaFunction(name, fn, executionContext)
+}
+
+func (c *Config) createLuaFunctionWithContext(ctx context.Context, name string, fn LuaFunction) lua.LGFunction {
+	return c.wrapLuaFunction(name, fn, func(*lua.LState) context.Context { return ctx })
+}
+
+// wrapLuaFunction adapts fn to a lua.LGFunction with panic recovery and
+// auditing, calling it with the context returned by ctxOf
+func (c *Config) wrapLuaFunction(name string, fn LuaFunction, ctxOf func(*lua.LState) context.Context) lua.LGFunction {
+	return func(L *lua.LState) int {
+		audit := c.beginAudit(name, L)
+		defer func() {
+			if r := recover(); r != nil {
+				if isStructuredError(r) {
+					panic(r)
+				}
+				c.logger.Error("function panic",
+					zap.String("function", name),
+					zap.Any("panic", r),
+				)
+				audit.finish(nil, fmt.Errorf("%v", r))
+				L.RaiseError("function execution failed: %v", r)
+			}
+		}()
+
+		results, err := fn(ctxOf(L), L)
+		audit.finish(results, err)
+		if err != nil {
+			c.raiseError(L, err)
+			return 0
+		}
+
+		for _, result := range results {
+			L.Push(result)
+		}
 
-	// Set up safe functions
-	c.L.SetFuncs(restricted, safeFuncs)
+		return len(results)
+	}
+}
 
-	// Add safe libraries to restricted environment
-	for name, lib := range safeLibs {
-		restricted.RawSetString(name, lib)
+// SetSandbox replaces the sandbox restrictions, which apply to every
+// subsequent LoadFile, so a trusted base file can be loaded with more
+// permissions before tightening them for untrusted overrides. Globals set by
+// earlier loads are kept as they are, including functions: a function that
+// captured a library such as io while it was allowed can still use it when
+// called later.
+func (c *Config) SetSandbox(sandbox *Sandbox) error {
+	if sandbox == nil {
+		return &Error{
+			Code:    ErrSandbox,
+			Message: "sandbox cannot be nil",
+		}
+	}
+	if sandbox.MaxMemory > 0 && sandbox.MaxMemory < 100*1024 {
+		return &Error{
+			Code:    ErrSandbox,
+			Message: "memory limit too small (minimum 100KB)",
+		}
 	}
 
-	if !c.sandbox.EnableFileIO {
+	c.mu.Lock()
+	c.sandbox = sandbox
+	c.mu.Unlock()
+	c.changed()
+	return nil
+}
+
+func (c *Config) applySandboxRestrictions() error {
+	// Create a restricted environment
+	restricted := c.L.NewTable()
+
+	// Add safe basic functions and libraries
+	c.addSafeBuiltins(restricted)
+
+	if c.sandbox.EnableFileIO {
+		c.installPathGuards()
+	} else {
 		// Remove file-related capabilities
-		c.L.SetGlobal("io", lua.LNil)
-		c.L.SetGlobal("dofile", lua.LNil)
-		c.L.SetGlobal("loadfile", lua.LNil)
-		c.L.SetGlobal("load", lua.LNil)
+		c.setSandboxGlobal("io", lua.LNil)
+		c.setSandboxGlobal("dofile", lua.LNil)
+		c.setSandboxGlobal("loadfile", lua.LNil)
+		c.setSandboxGlobal("load", lua.LNil)
 
 		// Restrict os library to non-file operations
 		osTable := c.L.NewTable()
@@ -495,6 +1505,18 @@ func (c *Config) applySandboxRestrictions() error {
 			}
 		}
 		restricted.RawSetString("os", osTable)
+		c.setSandboxGlobal("os", osTable)
+
+		// package.loaded, which is also the registry's _LOADED, and
+		// package.preload would still hand out the full libraries
+		if loaded := c.packageTable("loaded"); loaded != nil {
+			c.setSandboxField(loaded, "io", lua.LNil)
+			c.setSandboxField(loaded, "os", osTable)
+		}
+		if preload := c.packageTable("preload"); preload != nil {
+			c.setSandboxField(preload, "io", lua.LNil)
+			c.setSandboxField(preload, "os", lua.LNil)
+		}
 	}
 
 	if !c.sandbox.EnableNetworking {
@@ -502,6 +1524,7 @@ func (c *Config) applySandboxRestrictions() error {
 	}
 
 	// Custom require function that respects restrictions
+	base := c.L.GetGlobal("require")
 	requireFn := c.L.NewFunction(func(L *lua.LState) int {
 		modname := L.CheckString(1)
 
@@ -518,12 +1541,13 @@ func (c *Config) applySandboxRestrictions() error {
 		}
 
 		// Call original require for allowed modules
-		L.Push(L.GetGlobal("require"))
+		L.Push(base)
 		L.Push(lua.LString(modname))
 		L.Call(1, 1)
 		return 1
 	})
 	restricted.RawSetString("require", requireFn)
+	c.setSandboxGlobal("require", requireFn)
 
 	// Set memory limit (note: this is best-effort as Lua doesn't provide fine-grained control)
 	if c.sandbox.MaxMemory > 0 {
@@ -535,11 +1559,184 @@ func (c *Config) applySandboxRestrictions() error {
 	}
 
 	// Replace the global environment
-	c.L.SetGlobal("_G", restricted)
+	c.setSandboxGlobal("_G", restricted)
 
 	return nil
 }
 
+// sandboxState applies sandbox to a state of its own, such as a plugin's, for
+// good rather than for the duration of a load: the replaced fields are never
+// restored.
+func sandboxState(L *lua.LState, sandbox *Sandbox) error {
+	sc := &Config{L: L, sandbox: sandbox}
+	sc.captureBuiltins()
+	return sc.applySandboxRestrictions()
+}
+
+// safeFunctions and safeLibraries are the built-ins available inside a
+// sandboxed environment
+var (
+	safeFunctions = []string{"assert", "error", "ipairs", "next", "pairs", "select", "tonumber", "tostring", "type", "unpack"}
+	safeLibraries = []string{"string", "table", "math"}
+)
+
+// captureBuiltins records the safe built-ins of a new state, before any
+// script can assign a global with the same name, such as type
+func (c *Config) captureBuiltins() {
+	c.builtins = make(map[string]lua.LValue, len(safeFunctions)+len(safeLibraries))
+	for _, names := range [][]string{safeFunctions, safeLibraries} {
+		for _, name := range names {
+			c.builtins[name] = c.L.GetGlobal(name)
+		}
+	}
+}
+
+// addSafeBuiltins adds the safe built-in functions and libraries to env
+func (c *Config) addSafeBuiltins(env *lua.LTable) {
+	for name, lv := range c.builtins {
+		env.RawSetString(name, lv)
+	}
+}
+
+// sandboxSlot is a field of a table, such as a global or an entry of
+// package.loaded, replaced by applySandboxRestrictions
+type sandboxSlot struct {
+	table *lua.LTable
+	name  string
+}
+
+// sandboxedGlobal remembers a field replaced by applySandboxRestrictions
+type sandboxedGlobal struct {
+	original  lua.LValue
+	installed lua.LValue
+}
+
+// setSandboxGlobal replaces a global for the duration of a sandboxed load,
+// remembering the original value for restoreSandbox
+func (c *Config) setSandboxGlobal(name string, value lua.LValue) {
+	c.setSandboxField(c.L.G.Global, name, value)
+}
+
+// setSandboxField replaces the field name of table for the duration of a
+// sandboxed load, remembering the original value for restoreSandbox
+func (c *Config) setSandboxField(table *lua.LTable, name string, value lua.LValue) {
+	if c.sandboxed == nil {
+		c.sandboxed = make(map[sandboxSlot]sandboxedGlobal)
+	}
+	slot := sandboxSlot{table: table, name: name}
+	saved, ok := c.sandboxed[slot]
+	if !ok {
+		saved.original = table.RawGetString(name)
+	}
+	saved.installed = value
+	c.sandboxed[slot] = saved
+	table.RawSetString(name, value)
+}
+
+// restoreSandbox puts back the fields replaced by applySandboxRestrictions.
+// A field the loaded script assigned itself is left as the script set it.
+func (c *Config) restoreSandbox() {
+	for slot, saved := range c.sandboxed {
+		if slot.table.RawGetString(slot.name) == saved.installed {
+			slot.table.RawSetString(slot.name, saved.original)
+		}
+	}
+	c.sandboxed = nil
+}
+
+// packageTable returns the table the package library keeps under field, such
+// as package.loaded, or nil if there is none. It looks through the views
+// installRequireAllowlist puts in place of the package tables.
+func (c *Config) packageTable(field string) *lua.LTable {
+	if table, ok := c.packageTables[field]; ok {
+		return table
+	}
+	table, _ := c.L.GetField(c.L.GetGlobal("package"), field).(*lua.LTable)
+	return table
+}
+
+// installRequireAllowlist replaces the global require with one that only
+// loads modules from the allowlist. package.loaded and package.preload would
+// still hand out the other modules, so they are replaced by views of the
+// allowed entries, and the loaders refuse the other modules too. The
+// registry's _LOADED, which require itself uses, is not reachable from Lua.
+func (c *Config) installRequireAllowlist() {
+	if c.baseRequire != nil {
+		return
+	}
+	c.baseRequire = c.L.GetGlobal("require")
+	base := c.baseRequire
+
+	c.L.SetGlobal("require", c.L.NewFunction(func(L *lua.LState) int {
+		modname := L.CheckString(1)
+		if !c.allowedModules[modname] {
+			L.RaiseError("module '%s' is not allowed", modname)
+			return 0
+		}
+
+		L.Push(base)
+		L.Push(lua.LString(modname))
+		L.Call(1, 1)
+		return 1
+	}))
+
+	pkg, ok := c.L.GetGlobal("package").(*lua.LTable)
+	if !ok {
+		return
+	}
+	c.packageTables = make(map[string]*lua.LTable)
+	for _, field := range []string{"loaded", "preload"} {
+		if table, ok := pkg.RawGetString(field).(*lua.LTable); ok {
+			c.packageTables[field] = table
+			pkg.RawSetString(field, c.allowedModulesView(table))
+		}
+	}
+	if loaders, ok := pkg.RawGetString("loaders").(*lua.LTable); ok {
+		for i := 1; i <= loaders.Len(); i++ {
+			if loader, ok := loaders.RawGetInt(i).(*lua.LFunction); ok {
+				loaders.RawSetInt(i, c.allowedLoader(loader))
+			}
+		}
+	}
+}
+
+// allowedModulesView returns a table that reads the entries of table for
+// allowed modules only, and writes through to table
+func (c *Config) allowedModulesView(table *lua.LTable) *lua.LTable {
+	mt := c.L.NewTable()
+	mt.RawSetString("__index", c.L.NewFunction(func(L *lua.LState) int {
+		if name, ok := L.Get(2).(lua.LString); ok && c.allowedModules[string(name)] {
+			L.Push(table.RawGet(name))
+			return 1
+		}
+		L.Push(lua.LNil)
+		return 1
+	}))
+	mt.RawSetString("__newindex", table)
+	mt.RawSetString("__metatable", lua.LString("restricted"))
+
+	view := c.L.NewTable()
+	c.L.SetMetatable(view, mt)
+	return view
+}
+
+// allowedLoader wraps a package.loaders searcher so that it reports modules
+// outside the allowlist as not allowed instead of finding them
+func (c *Config) allowedLoader(loader *lua.LFunction) *lua.LFunction {
+	return c.L.NewFunction(func(L *lua.LState) int {
+		modname := L.CheckString(1)
+		if !c.allowedModules[modname] {
+			L.Push(lua.LString(fmt.Sprintf("module '%s' is not allowed", modname)))
+			return 1
+		}
+
+		L.Push(loader)
+		L.Push(lua.LString(modname))
+		L.Call(1, 1)
+		return 1
+	})
+}
+
 func (c *Config) runHooks(ctx context.Context, hookType HookType, event HookEvent) error {
 	c.mu.RLock()
 	hooks := c.hooks[hookType]
@@ -565,11 +1762,47 @@ func (c *Config) structToTable(v interface{}) (*lua.LTable, error) {
 	}
 
 	table := c.L.NewTable()
+	fieldCount, err := c.setStructFields(table, val, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no fields were converted and the test expects this type to be unsupported,
+	// return an error here.
+	if fieldCount == 0 {
+		return nil, fmt.Errorf("unsupported type: %T (no fields to convert)", v)
+	}
+
+	return table, nil
+}
+
+// setStructFields stores the exported fields of the struct val in table and
+// returns how many were stored. Fields of untagged embedded structs are
+// stored in table too; those of an embedded struct (inlined) do not replace
+// keys already set by the parent.
+func (c *Config) setStructFields(table *lua.LTable, val reflect.Value, inlined bool) (int, error) {
 	typ := val.Type()
 	fieldCount := 0
 
 	for i := 0; i < val.NumField(); i++ {
 		field := typ.Field(i)
+		fv := val.Field(i)
+
+		if isInlined(field, "lua") {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			n, err := c.setStructFields(table, fv, true)
+			if err != nil {
+				return 0, err
+			}
+			fieldCount += n
+			continue
+		}
+
 		if field.PkgPath != "" { // Skip unexported fields
 			continue
 		}
@@ -579,23 +1812,35 @@ func (c *Config) structToTable(v interface{}) (*lua.LTable, error) {
 			name = strings.ToLower(field.Name)
 		}
 
-		fv := val.Field(i)
 		lv, err := c.goToLua(fv.Interface())
 		if err != nil {
-			return nil, fmt.Errorf("field %s: %w", name, err)
+			return 0, fmt.Errorf("field %s: %w", name, err)
 		}
 
-		table.RawSetString(name, lv)
+		if !inlined || table.RawGetString(name) == lua.LNil {
+			table.RawSetString(name, lv)
+		}
 		fieldCount++
 	}
 
-	// If no fields were converted and the test expects this type to be unsupported,
-	// return an error here.
-	if fieldCount == 0 {
-		return nil, fmt.Errorf("unsupported type: %T (no fields to convert)", v)
-	}
+	return fieldCount, nil
+}
 
-	return table, nil
+// isInlined reports whether field is an embedded struct, or pointer to one,
+// without a tagName tag, whose fields belong to the parent table
+func isInlined(field reflect.StructField, tagName string) bool {
+	if !field.Anonymous || field.Tag.Get(tagName) != "" {
+		return false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		// An unexported embedded pointer cannot be allocated or followed
+		if !field.IsExported() {
+			return false
+		}
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
 }
 
 func (c *Config) wrapGoFunction(fn interface{}) (LuaFunction, error) {
@@ -604,54 +1849,86 @@ func (c *Config) wrapGoFunction(fn interface{}) (LuaFunction, error) {
 		return nil, fmt.Errorf("expected function, got %T", fn)
 	}
 
-	return func(ctx context.Context, L *lua.LState) ([]lua.LValue, error) {
-		ft := val.Type()
-		totalArgs := ft.NumIn()
-		contextOffset := 0
+	// Work out how to call the function once, so each call only converts
+	// its arguments and results
+	ft := val.Type()
+	contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+
+	totalArgs := ft.NumIn()
+	contextOffset := 0
+	if totalArgs > 0 && ft.In(0).Implements(contextType) {
+		contextOffset = 1
+	}
+	paramTypes := make([]reflect.Type, totalArgs)
+	for i := range paramTypes {
+		paramTypes[i] = ft.In(i)
+	}
+	// The elements of a variadic parameter are taken from the remaining
+	// Lua arguments
+	var variadicType reflect.Type
+	fixedArgs := totalArgs
+	if ft.IsVariadic() {
+		fixedArgs--
+		variadicType = ft.In(fixedArgs).Elem()
+	}
+	isError := make([]bool, ft.NumOut())
+	for i := range isError {
+		isError[i] = ft.Out(i).Implements(errorType)
+	}
+
+	convertArg := func(L *lua.LState, luaIndex int, paramType reflect.Type, argNum int) (reflect.Value, error) {
+		luaArg := L.Get(luaIndex)
 
-		// Check if first parameter is context
-		hasContext := totalArgs > 0 && ft.In(0).Implements(reflect.TypeOf((*context.Context)(nil)).Elem())
-		if hasContext {
-			contextOffset = 1
+		// Handle nil values
+		if luaArg == lua.LNil {
+			return reflect.Zero(paramType), nil
 		}
 
-		// Prepare arguments
-		args := make([]reflect.Value, totalArgs)
+		goArg, err := c.luaToGo(luaArg, paramType)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("argument %d: %w", argNum, err)
+		}
+		return reflect.ValueOf(goArg), nil
+	}
+
+	return func(ctx context.Context, L *lua.LState) ([]lua.LValue, error) {
+		args := make([]reflect.Value, fixedArgs, totalArgs)
 		luaIndex := 1 // Lua stack index starts at 1
 
 		// Set context if needed
-		if hasContext {
+		if contextOffset == 1 {
 			args[0] = reflect.ValueOf(ctx)
 		}
 
 		// Convert arguments
-		for i := contextOffset; i < totalArgs; i++ {
-			paramType := ft.In(i)
-			luaArg := L.Get(luaIndex)
-
-			// Handle nil values
-			if luaArg == lua.LNil {
-				args[i] = reflect.Zero(paramType)
-				luaIndex++
-				continue
-			}
-
-			goArg, err := c.luaToGo(luaArg, paramType)
+		for i := contextOffset; i < fixedArgs; i++ {
+			arg, err := convertArg(L, luaIndex, paramTypes[i], i+1)
 			if err != nil {
-				return nil, fmt.Errorf("argument %d: %w", i+1, err)
+				return nil, err
 			}
-			args[i] = reflect.ValueOf(goArg)
+			args[i] = arg
 			luaIndex++
 		}
+		if variadicType != nil {
+			for i := fixedArgs; luaIndex <= L.GetTop(); i++ {
+				arg, err := convertArg(L, luaIndex, variadicType, i+1)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				luaIndex++
+			}
+		}
 
 		// Call function
 		results := val.Call(args)
 
 		// Convert results
 		luaResults := make([]lua.LValue, 0, len(results))
-		for _, result := range results {
+		for i, result := range results {
 			// Special handling for error type
-			if result.Type().Implements(reflect.TypeOf((*error)(nil)).Elem()) {
+			if isError[i] {
 				if !result.IsNil() {
 					return nil, result.Interface().(error)
 				}
@@ -669,7 +1946,22 @@ func (c *Config) wrapGoFunction(fn interface{}) (LuaFunction, error) {
 	}, nil
 }
 
-func (c *Config) validateValue(lv lua.LValue, t reflect.Type) error {
+// validateValue checks that lv can be decoded into t. path is the dotted
+// location of lv, used to point errors at the source line that set it.
+func (c *Config) validateValue(lv lua.LValue, t reflect.Type, path string) error {
+	return c.validateValueWith(lv, t, path, c.newDecoder())
+}
+
+// validateValueWith checks lv like validateValue, with the tag name and weak
+// typing of d
+func (c *Config) validateValueWith(lv lua.LValue, t reflect.Type, path string, d *decoder) error {
+	if t.Kind() == reflect.String {
+		s, err := c.metaString(lv)
+		if err != nil {
+			return c.withSourcePosition(path, err)
+		}
+		lv = s
+	}
 
 	// Handle nil values
 	if lv == lua.LNil {
@@ -683,61 +1975,114 @@ func (c *Config) validateValue(lv lua.LValue, t reflect.Type) error {
 		}
 	}
 
+	if s, ok := lv.(lua.LString); ok && t == durationType {
+		if _, err := parseDuration(s); err != nil {
+			return c.withSourcePosition(path, err)
+		}
+		return nil
+	}
+	if t == timeType {
+		switch v := lv.(type) {
+		case lua.LString:
+			if _, err := parseTime(v); err != nil {
+				return c.withSourcePosition(path, err)
+			}
+			return nil
+		case lua.LNumber:
+			return nil
+		}
+	}
+	if t == bigIntType || t == bigFloatType {
+		if lv.Type() != lua.LTString && lv.Type() != lua.LTNumber {
+			return c.withSourcePosition(path, fmt.Errorf("expected string or number, got %s", lv.Type()))
+		}
+		return nil
+	}
+
+	if d.opts.WeaklyTyped {
+		coerced, err := weakScalar(lv, t.Kind())
+		if err != nil {
+			return c.withSourcePosition(path, fmt.Errorf("cannot coerce %s to %s: %w", lv.Type(), t.Kind(), err))
+		}
+		lv = coerced
+	}
+
 	switch t.Kind() {
 	case reflect.Struct:
 		if lv.Type() != lua.LTTable {
-			return fmt.Errorf("expected table for struct, got %s", lv.Type())
+			return c.withSourcePosition(path, fmt.Errorf("expected table for struct, got %s", lv.Type()))
 		}
 		table := lv.(*lua.LTable)
+		var errs ValidationErrors
 		for i := 0; i < t.NumField(); i++ {
 			field := t.Field(i)
+			if isInlined(field, d.tagName()) {
+				if err := c.validateValueWith(table, field.Type, path, d); err != nil {
+					errs = errs.add(path, err, "")
+				}
+				continue
+			}
 			if field.PkgPath != "" { // Skip unexported fields
 				continue
 			}
-			name := field.Tag.Get("lua")
-			if name == "" {
-				name = strings.ToLower(field.Name)
+			name, ok := d.fieldKey(field)
+			if !ok {
+				continue
+			}
+			fieldPath := path + "." + name
+			fieldValue, err := c.getTableField(table, name)
+			if err == nil {
+				err = c.validateValueWith(fieldValue, field.Type, fieldPath, d)
 			}
-			fieldValue := table.RawGetString(name)
-			if err := c.validateValue(fieldValue, field.Type); err != nil {
-				return fmt.Errorf("field %s: %w", name, err)
+			if err != nil {
+				errs = errs.add(fieldPath, err, "field "+name+": ")
 			}
 		}
+		return errs.orNil()
 	case reflect.Slice:
 		if lv == lua.LNil {
 			return nil // Allow nil slices
 		}
 		if lv.Type() != lua.LTTable {
-			return fmt.Errorf("expected table for slice, got %s", lv.Type())
+			return c.withSourcePosition(path, fmt.Errorf("expected table for slice, got %s", lv.Type()))
 		}
 	case reflect.Map:
 		if lv == lua.LNil {
 			return nil // Allow nil maps
 		}
 		if lv.Type() != lua.LTTable {
-			return fmt.Errorf("expected table for map, got %s", lv.Type())
+			return c.withSourcePosition(path, fmt.Errorf("expected table for map, got %s", lv.Type()))
 		}
 	case reflect.String:
 		if lv.Type() != lua.LTString && lv.Type() != lua.LTNil {
-			return fmt.Errorf("expected string, got %s", lv.Type())
+			return c.withSourcePosition(path, fmt.Errorf("expected string, got %s", lv.Type()))
 		}
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		if lv.Type() != lua.LTNumber && lv.Type() != lua.LTNil {
-			return fmt.Errorf("expected number, got %s", lv.Type())
+			return c.withSourcePosition(path, fmt.Errorf("expected number, got %s", lv.Type()))
 		}
 	case reflect.Float32, reflect.Float64:
 		if lv.Type() != lua.LTNumber && lv.Type() != lua.LTNil {
-			return fmt.Errorf("expected number, got %s", lv.Type())
+			return c.withSourcePosition(path, fmt.Errorf("expected number, got %s", lv.Type()))
 		}
 	case reflect.Bool:
 		if lv.Type() != lua.LTBool && lv.Type() != lua.LTNil {
-			return fmt.Errorf("expected boolean, got %s", lv.Type())
+			return c.withSourcePosition(path, fmt.Errorf("expected boolean, got %s", lv.Type()))
 		}
+	case reflect.Ptr:
+		return c.validateValueWith(lv, t.Elem(), path, d)
 	}
 	return nil
 }
 
 func (c *Config) luaToStruct(lv lua.LValue, target interface{}) error {
+	return c.luaToStructWith(lv, target, nil)
+}
+
+// luaToStructWith decodes lv into target using the options and cycle
+// tracking of d, as in luaToGoWith.
+func (c *Config) luaToStructWith(lv lua.LValue, target interface{}, d *decoder) error {
 	val := reflect.ValueOf(target)
 	if val.Kind() != reflect.Ptr {
 		return fmt.Errorf("target must be a pointer")
@@ -748,38 +2093,192 @@ func (c *Config) luaToStruct(lv lua.LValue, target interface{}) error {
 		return fmt.Errorf("target must be a pointer to struct")
 	}
 
-	table, ok := lv.(*lua.LTable)
-	if !ok {
-		return fmt.Errorf("expected table, got %T", lv)
+	table, ok := lv.(*lua.LTable)
+	if !ok {
+		return fmt.Errorf("expected table, got %T", lv)
+	}
+
+	if d == nil {
+		d = c.newDecoder()
+	}
+	if d.seen == nil {
+		d.seen = make(map[*lua.LTable]bool)
+	}
+	if !d.seen[table] {
+		d.seen[table] = true
+		defer delete(d.seen, table)
+	}
+
+	if d.opts.DisallowUnknownKeys {
+		if err := d.checkUnknownKeys(table, val.Type()); err != nil {
+			return err
+		}
 	}
 
+	_, err := c.decodeStructFields(table, val, d)
+	return err
+}
+
+// decodeStructFields decodes the fields of the struct val from table,
+// including those of untagged embedded structs, and reports whether any
+// field was set
+func (c *Config) decodeStructFields(table *lua.LTable, val reflect.Value, d *decoder) (bool, error) {
 	typ := val.Type()
+	set := false
 	for i := 0; i < val.NumField(); i++ {
 		field := typ.Field(i)
+
+		if isInlined(field, d.tagName()) {
+			fv := val.Field(i)
+			if fv.Kind() != reflect.Ptr {
+				embeddedSet, err := c.decodeStructFields(table, fv, d)
+				if err != nil {
+					return false, err
+				}
+				set = set || embeddedSet
+				continue
+			}
+
+			// Only allocate an embedded pointer when one of its fields is set
+			target := fv
+			if fv.IsNil() {
+				target = reflect.New(field.Type.Elem())
+			}
+			embeddedSet, err := c.decodeStructFields(table, target.Elem(), d)
+			if err != nil {
+				return false, err
+			}
+			if embeddedSet {
+				fv.Set(target)
+				set = true
+			}
+			continue
+		}
+
 		if field.PkgPath != "" { // Skip unexported fields
 			continue
 		}
 
-		// Get field name from tag or use field name
-		name := field.Tag.Get("lua")
-		if name == "" {
-			name = strings.ToLower(field.Name)
+		name, ok := d.fieldKey(field)
+		if !ok {
+			continue
 		}
 
-		lval := table.RawGetString(name)
+		lval, err := c.getTableField(table, name)
+		if err != nil {
+			return false, fmt.Errorf("field %s: %w", name, err)
+		}
+		// Lua tables cannot hold nil, so an absent key and one assigned nil
+		// look the same; both leave the field untouched (nil for pointers)
 		if lval == lua.LNil {
 			continue
 		}
 
-		goval, err := c.luaToGo(lval, field.Type)
+		goval, err := c.luaToGoWith(lval, field.Type, d)
 		if err != nil {
-			return fmt.Errorf("field %s: %w", name, err)
+			return false, fmt.Errorf("field %s: %w", name, err)
 		}
 
-		val.Field(i).Set(reflect.ValueOf(goval))
+		rv, err := assignableValue(goval, field.Type)
+		if err != nil {
+			return false, fmt.Errorf("field %s: %w", name, err)
+		}
+		val.Field(i).Set(rv)
+		set = true
 	}
 
-	return nil
+	return set, nil
+}
+
+// assignableValue returns v as a reflect.Value that can be assigned to a
+// value of type t, or an error instead of letting reflect panic
+func assignableValue(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("cannot assign %s to %v", rv.Type(), t)
+	}
+	return rv, nil
+}
+
+// metaString returns the result of lv's __tostring metamethod, or lv itself
+// when it has none or WithToStringMetamethods is not enabled. The caller must
+// hold the write lock, see readLock.
+func (c *Config) metaString(lv lua.LValue) (lua.LValue, error) {
+	if !c.toStringMeta || (lv.Type() != lua.LTTable && lv.Type() != lua.LTUserData) {
+		return lv, nil
+	}
+	fn, ok := c.L.GetMetaField(lv, "__tostring").(*lua.LFunction)
+	if !ok {
+		return lv, nil
+	}
+
+	ctx := c.L.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, restore := c.bindExecContext(ctx, c.maxExecutionTime())
+	err := c.L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, lv)
+	restore()
+	if err != nil {
+		return nil, fmt.Errorf("__tostring failed: %w", err)
+	}
+	result := c.L.Get(-1)
+	c.L.Pop(1)
+	if _, ok := result.(lua.LString); !ok {
+		return nil, fmt.Errorf("__tostring returned %s, not a string", result.Type())
+	}
+	return result, nil
+}
+
+// readLock locks c for a method that decodes or exports values and returns
+// the function that unlocks it. It takes the write lock when
+// WithToStringMetamethods is enabled, since running a metamethod changes the
+// Lua state that other readers would share.
+func (c *Config) readLock() func() {
+	if c.toStringMeta {
+		c.mu.Lock()
+		return c.mu.Unlock
+	}
+	c.mu.RLock()
+	return c.mu.RUnlock
+}
+
+// maxIndexChain bounds __index lookups to guard against metatable cycles
+const maxIndexChain = 100
+
+// getTableField reads a field from a table, consulting the metatable's
+// __index when metatable resolution is enabled and the raw value is nil
+func (c *Config) getTableField(table *lua.LTable, name string) (lua.LValue, error) {
+	lv := table.RawGetString(name)
+	if lv != lua.LNil || !c.resolveMeta {
+		return lv, nil
+	}
+
+	current := table
+	for i := 0; i < maxIndexChain; i++ {
+		index := c.L.GetMetaField(current, "__index")
+		switch idx := index.(type) {
+		case *lua.LTable:
+			if lv := idx.RawGetString(name); lv != lua.LNil {
+				return lv, nil
+			}
+			current = idx
+		case *lua.LFunction:
+			if err := c.L.CallByParam(lua.P{Fn: idx, NRet: 1, Protect: true}, current, lua.LString(name)); err != nil {
+				return nil, fmt.Errorf("__index failed: %w", err)
+			}
+			lv := c.L.Get(-1)
+			c.L.Pop(1)
+			return lv, nil
+		default:
+			return lua.LNil, nil
+		}
+	}
+
+	return nil, fmt.Errorf("__index chain too long")
 }
 
 func (c *Config) goToLua(v interface{}) (lua.LValue, error) {
@@ -838,15 +2337,93 @@ func (c *Config) goToLua(v interface{}) (lua.LValue, error) {
 	}
 }
 
+// maxDecodeDepth bounds how deeply nested tables may be when decoding
+const maxDecodeDepth = 100
+
 func (c *Config) luaToGo(lv lua.LValue, t reflect.Type) (interface{}, error) {
+	return c.luaToGoWith(lv, t, nil)
+}
+
+// luaToGoWith converts lv to a value of type t using the options of d, which
+// may be nil for the defaults. d also tracks the tables on the path currently
+// being decoded to reject cyclic and excessively deep tables. Malformed input
+// yields an error, never a panic.
+func (c *Config) luaToGoWith(lv lua.LValue, t reflect.Type, d *decoder) (interface{}, error) {
 	if lv == lua.LNil {
 		return reflect.Zero(t).Interface(), nil
 	}
+	if d == nil {
+		d = c.newDecoder()
+	}
+	if t.Kind() == reflect.String {
+		s, err := c.metaString(lv)
+		if err != nil {
+			return nil, err
+		}
+		lv = s
+	}
+
+	// Exact numerics are written as strings, which keep every digit, or as
+	// numbers
+	switch t {
+	case reflect.PointerTo(bigIntType):
+		return parseBigInt(lv)
+	case reflect.PointerTo(bigFloatType):
+		return parseBigFloat(lv)
+	}
+
+	// Pointers are allocated for any present value, including false, 0 and
+	// empty strings, so pointer fields can tell an unset key from a zero value
+	if t.Kind() == reflect.Ptr {
+		elem, err := c.luaToGoWith(lv, t.Elem(), d)
+		if err != nil {
+			return nil, err
+		}
+		rv, err := assignableValue(elem, t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(rv)
+		return ptr.Interface(), nil
+	}
+
+	// Durations are written either as strings such as "30s" or "1m30s", or as
+	// numbers of nanoseconds
+	if s, ok := lv.(lua.LString); ok && t == durationType {
+		return parseDuration(s)
+	}
+
+	// Times are written as RFC 3339 strings, Unix timestamps in seconds, or
+	// tables of date components
+	if t == timeType {
+		switch v := lv.(type) {
+		case lua.LString:
+			return parseTime(v)
+		case lua.LNumber:
+			sec, frac := math.Modf(float64(v))
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+	}
+
+	if d.opts.WeaklyTyped {
+		coerced, err := weakScalar(lv, t.Kind())
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %s to %v: %w", lv.Type(), t, err)
+		}
+		lv = coerced
+	}
+
+	// Only the empty interface can hold every decoded value
+	if t.Kind() == reflect.Interface && t.NumMethod() > 0 {
+		return nil, fmt.Errorf("cannot convert %s to %v", lv.Type(), t)
+	}
 
 	switch lv.Type() {
 	case lua.LTBool:
+		// Conversions to t keep named types such as `type Flag bool` intact
 		if t.Kind() == reflect.Bool {
-			return bool(lv.(lua.LBool)), nil
+			return reflect.ValueOf(bool(lv.(lua.LBool))).Convert(t).Interface(), nil
 		}
 		if t.Kind() == reflect.Interface {
 			return bool(lv.(lua.LBool)), nil
@@ -857,162 +2434,627 @@ func (c *Config) luaToGo(lv lua.LValue, t reflect.Type) (interface{}, error) {
 		n := float64(lv.(lua.LNumber))
 		switch t.Kind() {
 		case reflect.Float64:
-			return n, nil
+			return reflect.ValueOf(n).Convert(t).Interface(), nil
 		case reflect.Float32:
-			return float32(n), nil
-		case reflect.Int:
-			return int(n), nil
-		case reflect.Int64:
-			return int64(n), nil
-		case reflect.Int32:
-			return int32(n), nil
+			return reflect.ValueOf(float32(n)).Convert(t).Interface(), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			// The negated comparison also rejects NaN
+			if !(n >= math.MinInt64 && n < math.MaxInt64) || reflect.Zero(t).OverflowInt(int64(n)) {
+				return nil, fmt.Errorf("number %v overflows %v", n, t)
+			}
+			return reflect.ValueOf(int64(n)).Convert(t).Interface(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if n < 0 {
+				return nil, fmt.Errorf("cannot convert negative number %v to %v", n, t)
+			}
+			if !(n < math.MaxUint64) || reflect.Zero(t).OverflowUint(uint64(n)) {
+				return nil, fmt.Errorf("number %v overflows %v", n, t)
+			}
+			return reflect.ValueOf(uint64(n)).Convert(t).Interface(), nil
 		case reflect.Interface:
 			return n, nil
 		default:
 			return nil, fmt.Errorf("cannot convert number to %v", t)
 		}
 
-	case lua.LTString:
-		if t.Kind() != reflect.String && t.Kind() != reflect.Interface {
-			return nil, fmt.Errorf("cannot convert string to %v", t)
+	case lua.LTString:
+		s := string(lv.(lua.LString))
+		if d.opts.InternStrings {
+			s = unique.Make(s).Value()
+		}
+		if t.Kind() == reflect.String {
+			return reflect.ValueOf(s).Convert(t).Interface(), nil
+		}
+		if t.Kind() != reflect.Interface {
+			return nil, fmt.Errorf("cannot convert string to %v", t)
+		}
+		return s, nil
+
+	case lua.LTTable:
+		table := lv.(*lua.LTable)
+
+		if d.seen == nil {
+			d.seen = make(map[*lua.LTable]bool)
+		}
+		if d.seen[table] {
+			return nil, fmt.Errorf("cannot convert cyclic table to %v", t)
+		}
+		if len(d.seen) >= maxDecodeDepth {
+			return nil, fmt.Errorf("table nesting exceeds %d levels", maxDecodeDepth)
+		}
+		d.seen[table] = true
+		defer delete(d.seen, table)
+
+		// Check if table is array-like (sequential numeric keys starting from
+		// 1, or from 0 for zero-based arrays)
+		first, maxn := 1, table.MaxN()
+		hasZero := table.RawGet(lua.LNumber(0)) != lua.LNil
+		if hasZero && d.opts.ZeroBasedArrays {
+			first = 0
+		}
+		isArray := maxn >= first
+		for i := first; i <= maxn && isArray; i++ {
+			isArray = table.RawGet(lua.LNumber(i)) != lua.LNil
+		}
+		if isArray && hasZero && first == 1 {
+			// Decoding from index 1 would drop element 0
+			switch {
+			case t.Kind() != reflect.Slice:
+				isArray = false // decode as a map, keeping every index
+			case !d.opts.Lenient:
+				return nil, fmt.Errorf("table has an element at index 0; decode with zero-based arrays to keep it")
+			}
+		}
+
+		switch t.Kind() {
+		case reflect.Slice:
+			slice := reflect.MakeSlice(t, 0, table.Len())
+			appendElem := func(k, v lua.LValue) error {
+				val, err := c.luaToGoWith(v, t.Elem(), d)
+				if err == nil {
+					var rv reflect.Value
+					if rv, err = assignableValue(val, t.Elem()); err == nil {
+						slice = reflect.Append(slice, rv)
+						return nil
+					}
+				}
+				if d.opts.Lenient {
+					return nil
+				}
+				return fmt.Errorf("element %s: %w", k, err)
+			}
+			var firstErr error
+			if isArray {
+				for i := first; i <= maxn && firstErr == nil; i++ {
+					firstErr = appendElem(lua.LNumber(i), table.RawGet(lua.LNumber(i)))
+				}
+			} else {
+				table.ForEach(func(k lua.LValue, v lua.LValue) {
+					if firstErr == nil {
+						firstErr = appendElem(k, v)
+					}
+				})
+			}
+			if firstErr != nil {
+				return nil, firstErr
+			}
+			return slice.Interface(), nil
+
+		case reflect.Map:
+			m := reflect.MakeMap(t)
+			setEntry := func(k, v lua.LValue) error {
+				key, err := c.luaToGoWith(k, t.Key(), d)
+				if err != nil || key == nil {
+					return err
+				}
+				val, err := c.luaToGoWith(v, t.Elem(), d)
+				if err != nil {
+					return err
+				}
+				rk, err := assignableValue(key, t.Key())
+				if err != nil {
+					return err
+				}
+				rv, err := assignableValue(val, t.Elem())
+				if err != nil {
+					return err
+				}
+				m.SetMapIndex(rk, rv)
+				return nil
+			}
+			var firstErr error
+			table.ForEach(func(k, v lua.LValue) {
+				if firstErr != nil {
+					return
+				}
+				if err := setEntry(k, v); err != nil && !d.opts.Lenient {
+					firstErr = fmt.Errorf("key %s: %w", k, err)
+				}
+			})
+			if firstErr != nil {
+				return nil, firstErr
+			}
+			return m.Interface(), nil
+
+		case reflect.Struct:
+			if t == reflect.TypeOf(time.Time{}) {
+				return c.luaTableToTime(table)
+			}
+			ptr := reflect.New(t)
+			if err := c.luaToStructWith(table, ptr.Interface(), d); err != nil {
+				return nil, err
+			}
+			return ptr.Elem().Interface(), nil
+
+		case reflect.Interface:
+			// If it's an array-like table, convert to slice
+			// Values with no Go counterpart, such as functions, are left out
+			// as ExportLua leaves them out. In an array they, and elements
+			// that fail to convert under lenient decoding, become nil so the
+			// elements after them keep their indexes.
+			if isArray {
+				result := make([]interface{}, 0, maxn-first+1)
+				for i := first; i <= maxn; i++ {
+					elem := table.RawGet(lua.LNumber(i))
+					if !exportable(elem) {
+						result = append(result, nil)
+						continue
+					}
+					val, err := c.luaToGoWith(elem, t, d)
+					if err != nil && !d.opts.Lenient {
+						return nil, fmt.Errorf("element %d: %w", i, err)
+					}
+					result = append(result, val)
+				}
+				return result, nil
+			}
+
+			// Otherwise convert to map
+			result := make(map[string]interface{})
+			var firstErr error
+			table.ForEach(func(k, v lua.LValue) {
+				if firstErr != nil || !exportable(v) {
+					return
+				}
+				val, err := c.luaToGoWith(v, t, d)
+				if err != nil {
+					if !d.opts.Lenient {
+						firstErr = fmt.Errorf("key %s: %w", k, err)
+					}
+					return
+				}
+				result[k.String()] = val
+			})
+			if firstErr != nil {
+				return nil, firstErr
+			}
+			return result, nil
+
+		default:
+			return nil, fmt.Errorf("cannot convert table to %v", t)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Lua type: %s", lv.Type())
+	}
+}
+
+// Simple helper methods for common operations
+func (c *Config) DoString(script string) error {
+	return c.runScript(func() error {
+		return c.L.DoString(script)
+	})
+}
+
+func (c *Config) DoFile(filename string) error {
+	return c.runScript(func() error {
+		return c.L.DoFile(filename)
+	})
+}
+
+// DoStringWithEnv runs src with env as its only globals, so the snippet sees
+// the given names plus the built-ins a sandboxed load allows, and whatever it
+// assigns stays out of the main state. The string, table and math libraries
+// are copied, so changes to them do not leak either. Use it to evaluate
+// user-supplied snippets that must not touch the configuration.
+func (c *Config) DoStringWithEnv(src string, env map[string]lua.LValue) error {
+	envTable := c.isolatedEnv()
+	for name, value := range env {
+		envTable.RawSetString(name, value)
+	}
+
+	return c.runScript(func() error {
+		fn, err := c.L.LoadString(src)
+		if err != nil {
+			return err
+		}
+		fn.Env = envTable
+		c.L.Push(fn)
+		return c.L.PCall(0, 0, nil)
+	})
+}
+
+// isolatedEnv returns a fresh environment holding the safe built-ins, with
+// copies of the safe libraries
+func (c *Config) isolatedEnv() *lua.LTable {
+	env := c.L.NewTable()
+	c.addSafeBuiltins(env)
+	for _, name := range safeLibraries {
+		lib := c.L.NewTable()
+		c.builtins[name].(*lua.LTable).ForEach(func(k, v lua.LValue) {
+			lib.RawSet(k, v)
+		})
+		env.RawSetString(name, lib)
+	}
+	return env
+}
+
+// GetGlobal retrieves a global variable with type conversion
+func (c *Config) GetGlobal(name string, target interface{}) error {
+	lv := c.L.GetGlobal(name)
+	if lv == lua.LNil {
+		return &Error{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("global variable '%s' not found", name),
+		}
+	}
+
+	val := reflect.ValueOf(target)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return fmt.Errorf("target must be a pointer")
+	}
+
+	converted, err := c.luaToGo(lv, val.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	rv, err := assignableValue(converted, val.Elem().Type())
+	if err != nil {
+		return err
+	}
+	val.Elem().Set(rv)
+	return nil
+}
+
+// GetRaw retrieves the raw Lua value at a dotted path (e.g. "server.tls")
+// without converting it to a Go value
+func (c *Config) GetRaw(path string) (lua.LValue, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	lv := c.lookupPath(path)
+	if lv == lua.LNil {
+		return nil, &Error{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("value '%s' not found", path),
+		}
+	}
+
+	return lv, nil
+}
+
+// lookupPath resolves a dotted path starting at the globals, returning
+// lua.LNil if any part of the path is missing or not a table
+func (c *Config) lookupPath(path string) lua.LValue {
+	parts := strings.Split(path, ".")
+	lv := c.L.GetGlobal(parts[0])
+	for _, part := range parts[1:] {
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return lua.LNil
+		}
+		lv = table.RawGetString(part)
+	}
+	return lv
+}
+
+// checkNameFree returns an error if strict registration is enabled and the
+// dotted path is already defined. The caller must hold c.mu.
+func (c *Config) checkNameFree(path string) error {
+	if !c.strictNames || c.lookupPath(path) == lua.LNil {
+		return nil
+	}
+	return &Error{
+		Code:    ErrInvalidType,
+		Message: fmt.Sprintf("'%s' is already defined", path),
+	}
+}
+
+// builtinGlobals lists globals provided by gopher-lua's standard libraries and
+// names used internally by lugo. They are excluded from ListGlobals.
+var builtinGlobals = map[string]bool{
+	// Base library
+	"_G": true, "_VERSION": true, "_GOPHER_LUA_VERSION": true, "_printregs": true,
+	"assert": true, "collectgarbage": true, "dofile": true, "error": true,
+	"getfenv": true, "getmetatable": true, "ipairs": true, "load": true,
+	"loadfile": true, "loadstring": true, "module": true, "newproxy": true,
+	"next": true, "pairs": true, "pcall": true, "print": true, "rawequal": true,
+	"rawget": true, "rawset": true, "require": true, "select": true,
+	"setfenv": true, "setmetatable": true, "tonumber": true, "tostring": true,
+	"type": true, "unpack": true, "xpcall": true,
+
+	// Standard libraries
+	"channel": true, "coroutine": true, "debug": true, "io": true, "math": true,
+	"os": true, "package": true, "string": true, "table": true,
+
+	// Lugo internals
+	"__eval_result": true,
+}
+
+// globalTables returns the tables holding global variables: the globals
+// table and, once WatchGlobal has been used, the shadow table the watched
+// globals are moved into
+func (c *Config) globalTables() []*lua.LTable {
+	if c.watchedGlobals == nil {
+		return []*lua.LTable{c.L.G.Global}
+	}
+	return []*lua.LTable{c.L.G.Global, c.watchedGlobals}
+}
+
+// forEachGlobal calls fn for each global variable, including watched ones
+func (c *Config) forEachGlobal(fn func(k, v lua.LValue)) {
+	for _, table := range c.globalTables() {
+		table.ForEach(fn)
+	}
+}
+
+// ListGlobals returns the sorted names of user-defined globals, excluding Lua
+// built-ins and lugo internals
+func (c *Config) ListGlobals() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var names []string
+	c.forEachGlobal(func(k, v lua.LValue) {
+		key, ok := k.(lua.LString)
+		if !ok || builtinGlobals[string(key)] {
+			return
 		}
-		return string(lv.(lua.LString)), nil
+		names = append(names, string(key))
+	})
 
-	case lua.LTTable:
-		table := lv.(*lua.LTable)
+	sort.Strings(names)
+	return names
+}
 
-		// Check if table is array-like (sequential numeric keys starting from 1)
-		isArray := true
-		maxn := table.MaxN()
-		if maxn > 0 {
-			for i := 1; i <= maxn; i++ {
-				if table.RawGetInt(i) == lua.LNil {
-					isArray = false
-					break
-				}
-			}
-		} else {
-			isArray = false
+// GetAll returns every user-defined global keyed by dotted path, e.g.
+// "database.password". Tables with only string keys are walked; other tables,
+// such as arrays, are returned whole. Built-ins and values without a Go
+// representation, such as functions, are omitted.
+func (c *Config) GetAll() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	all := make(map[string]interface{})
+	c.forEachGlobal(func(k, v lua.LValue) {
+		key, ok := k.(lua.LString)
+		if !ok || builtinGlobals[string(key)] {
+			return
 		}
+		c.collectValues(string(key), v, all, make(map[*lua.LTable]bool))
+	})
+	return all
+}
 
-		switch t.Kind() {
-		case reflect.Slice:
-			slice := reflect.MakeSlice(t, 0, table.Len())
-			if isArray {
-				for i := 1; i <= maxn; i++ {
-					val, err := c.luaToGo(table.RawGetInt(i), t.Elem())
-					if err == nil {
-						slice = reflect.Append(slice, reflect.ValueOf(val))
-					}
-				}
-			} else {
-				table.ForEach(func(_ lua.LValue, v lua.LValue) {
-					val, err := c.luaToGo(v, t.Elem())
-					if err == nil {
-						slice = reflect.Append(slice, reflect.ValueOf(val))
-					}
-				})
+// collectValues adds v to all under path, descending into tables keyed only
+// by strings. onPath holds the tables being walked so cycles terminate.
+func (c *Config) collectValues(path string, v lua.LValue, all map[string]interface{}, onPath map[*lua.LTable]bool) {
+	table, ok := v.(*lua.LTable)
+	if ok && !onPath[table] && table.Len() == 0 {
+		nested := true
+		empty := true
+		table.ForEach(func(k, _ lua.LValue) {
+			empty = false
+			if key, ok := k.(lua.LString); !ok || key == "" || strings.Contains(string(key), ".") {
+				nested = false
 			}
-			return slice.Interface(), nil
-
-		case reflect.Map:
-			m := reflect.MakeMap(t)
-			table.ForEach(func(k, v lua.LValue) {
-				key, err := c.luaToGo(k, t.Key())
-				if err != nil {
-					return
-				}
-				val, err := c.luaToGo(v, t.Elem())
-				if err != nil {
-					return
-				}
-				m.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(val))
+		})
+		if nested && !empty {
+			onPath[table] = true
+			defer delete(onPath, table)
+			table.ForEach(func(k, child lua.LValue) {
+				c.collectValues(path+"."+string(k.(lua.LString)), child, all, onPath)
 			})
-			return m.Interface(), nil
+			return
+		}
+	}
 
-		case reflect.Struct:
-			if t == reflect.TypeOf(time.Time{}) {
-				return c.luaTableToTime(table)
-			}
-			ptr := reflect.New(t)
-			if err := c.luaToStruct(table, ptr.Interface()); err != nil {
-				return nil, err
-			}
-			return ptr.Elem().Interface(), nil
+	goVal, err := c.luaToGo(v, interfaceType)
+	if err != nil {
+		return
+	}
+	all[path] = goVal
+}
 
-		case reflect.Interface:
-			// If it's an array-like table, convert to slice
-			if isArray {
-				result := make([]interface{}, 0, maxn)
-				for i := 1; i <= maxn; i++ {
-					val, err := c.luaToGo(table.RawGetInt(i), reflect.TypeOf((*interface{})(nil)).Elem())
-					if err == nil {
-						result = append(result, val)
-					}
-				}
-				return result, nil
+// Set assigns value at a dotted path such as "database.password", creating
+// intermediate tables as needed. Assignments go through metatables, so
+// watched globals are notified and read-only tables reject the write.
+func (c *Config) Set(name string, value interface{}) error {
+	parts, err := splitPath(name)
+	if err != nil {
+		return err
+	}
+
+	lv, err := c.goToLua(value)
+	if err != nil {
+		return err
+	}
+
+	return c.setPath(parts, lv)
+}
+
+// splitPath splits a dotted path into its segments, rejecting empty ones
+func splitPath(name string) ([]string, error) {
+	parts := strings.Split(name, ".")
+	for _, part := range parts {
+		if part == "" {
+			return nil, &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("invalid path '%s'", name),
 			}
+		}
+	}
+	return parts, nil
+}
 
-			// Otherwise convert to map
-			result := make(map[string]interface{})
-			table.ForEach(func(k, v lua.LValue) {
-				key := k.String()
-				val, err := c.luaToGo(v, reflect.TypeOf((*interface{})(nil)).Elem())
-				if err == nil {
-					result[key] = val
-				}
-			})
-			return result, nil
+// setPath assigns lv at the path given by parts, as Set does
+func (c *Config) setPath(parts []string, lv lua.LValue) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.changed()
 
-		default:
-			return nil, fmt.Errorf("cannot convert table to %v", t)
+	var parent lua.LValue = c.L.G.Global
+	for i, part := range parts[:len(parts)-1] {
+		next := c.L.GetField(parent, part)
+		if next == lua.LNil {
+			table := c.L.NewTable()
+			if err := c.setField(parent, part, table); err != nil {
+				return err
+			}
+			next = table
 		}
-	default:
-		return nil, fmt.Errorf("unsupported Lua type: %s", lv.Type())
+		if _, ok := next.(*lua.LTable); !ok {
+			return &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("'%s' is a %s, not a table", strings.Join(parts[:i+1], "."), next.Type()),
+			}
+		}
+		parent = next
 	}
+
+	return c.setField(parent, parts[len(parts)-1], lv)
 }
 
-// Simple helper methods for common operations
-func (c *Config) DoString(script string) error {
-	err := c.L.DoString(script)
-	if err != nil {
+// setField assigns table[key] = value honoring metatables, returning errors
+// raised by __newindex instead of panicking
+func (c *Config) setField(table lua.LValue, key string, value lua.LValue) error {
+	fn := c.L.NewFunction(func(L *lua.LState) int {
+		L.SetField(table, key, value)
+		return 0
+	})
+	if err := c.L.CallByParam(lua.P{Fn: fn, Protect: true}); err != nil {
 		return WrapLuaError(c.L, err)
 	}
 	return nil
 }
 
-func (c *Config) DoFile(filename string) error {
-	err := c.L.DoFile(filename)
+// EqualGlobals reports whether globals a and b hold structurally equal
+// values. Both are converted with the same rules as Get into untyped Go
+// values, so table key order does not matter but sequence order does.
+func (c *Config) EqualGlobals(a, b string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	left, err := c.canonicalGlobal(a)
 	if err != nil {
-		return WrapLuaError(c.L, err)
+		return false, err
 	}
-	return nil
+	right, err := c.canonicalGlobal(b)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(left, right), nil
 }
 
-// GetGlobal retrieves a global variable with type conversion
-func (c *Config) GetGlobal(name string, target interface{}) error {
+// canonicalGlobal converts the named global to an untyped Go value
+func (c *Config) canonicalGlobal(name string) (interface{}, error) {
 	lv := c.L.GetGlobal(name)
 	if lv == lua.LNil {
-		return &Error{
+		return nil, &Error{
 			Code:    ErrNotFound,
 			Message: fmt.Sprintf("global variable '%s' not found", name),
 		}
 	}
 
-	val := reflect.ValueOf(target)
-	if val.Kind() != reflect.Ptr {
-		return fmt.Errorf("target must be a pointer")
+	val, err := c.luaToGo(lv, interfaceType)
+	if err != nil {
+		return nil, &Error{
+			Code:    ErrConversion,
+			Message: fmt.Sprintf("failed to convert global '%s'", name),
+			Cause:   err,
+		}
 	}
+	return val, nil
+}
 
-	converted, err := c.luaToGo(lv, val.Elem().Type())
-	if err != nil {
-		return err
+// Prune recursively removes empty sub-tables from the named global table, so
+// it can be exported or hashed in a canonical form. Keys set to nil are already
+// absent in Lua; empty tables inside a sequence are removed and the remaining
+// elements shifted down so the sequence stays contiguous.
+func (c *Config) Prune(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.changed()
+
+	lv := c.L.GetGlobal(name)
+	if lv == lua.LNil {
+		return &Error{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("configuration '%s' not found", name),
+		}
+	}
+
+	table, ok := lv.(*lua.LTable)
+	if !ok {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("configuration '%s' is not a table", name),
+		}
 	}
 
-	val.Elem().Set(reflect.ValueOf(converted))
+	pruneTable(table, make(map[*lua.LTable]bool))
 	return nil
 }
 
+// pruneTable removes empty sub-tables from table and reports whether table is
+// empty afterwards. seen records results for tables that were already visited,
+// which handles shared references and cycles.
+func pruneTable(table *lua.LTable, seen map[*lua.LTable]bool) bool {
+	if empty, ok := seen[table]; ok {
+		return empty
+	}
+	seen[table] = false
+
+	maxn := table.MaxN()
+	isSequence := true
+	for i := 1; i <= maxn; i++ {
+		if table.RawGetInt(i) == lua.LNil {
+			isSequence = false
+			break
+		}
+	}
+
+	var removeKeys []lua.LValue
+	var removeIndexes []int
+	table.ForEach(func(k, v lua.LValue) {
+		child, ok := v.(*lua.LTable)
+		if !ok || !pruneTable(child, seen) {
+			return
+		}
+		if n, ok := k.(lua.LNumber); ok && isSequence && int(n) >= 1 && int(n) <= maxn && float64(int(n)) == float64(n) {
+			removeIndexes = append(removeIndexes, int(n))
+			return
+		}
+		removeKeys = append(removeKeys, k)
+	})
+
+	for _, k := range removeKeys {
+		table.RawSet(k, lua.LNil)
+	}
+
+	// Remove from the end so earlier indexes stay valid while shifting
+	sort.Sort(sort.Reverse(sort.IntSlice(removeIndexes)))
+	for _, i := range removeIndexes {
+		table.Remove(i)
+	}
+
+	key, _ := table.Next(lua.LNil)
+	empty := key == lua.LNil
+	seen[table] = empty
+	return empty
+}
+
 // SetGlobal sets a global variable with type conversion
 func (c *Config) SetGlobal(name string, value interface{}) error {
 	lv, err := c.goToLua(value)
@@ -1020,11 +3062,29 @@ func (c *Config) SetGlobal(name string, value interface{}) error {
 		return err
 	}
 	c.L.SetGlobal(name, lv)
+	c.changed()
 	return nil
 }
 
 // Call invokes a Lua function with automatic type conversion
 func (c *Config) Call(funcName string, args ...interface{}) ([]interface{}, error) {
+	return c.CallContext(context.Background(), funcName, args...)
+}
+
+// CallContext invokes a Lua function like Call, aborting it with ErrCanceled
+// when ctx is cancelled or ErrTimeout when its deadline or the sandbox
+// execution time limit passes. Go functions called by it receive ctx.
+func (c *Config) CallContext(ctx context.Context, funcName string, args ...interface{}) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &Error{
+			Code:    ErrCanceled,
+			Message: fmt.Sprintf("context canceled before calling '%s'", funcName),
+			Cause:   err,
+		}
+	}
+
+	defer c.lockPrimary()()
+
 	fn := c.L.GetGlobal(funcName)
 	if fn == lua.LNil {
 		return nil, NewLuaError(c.L, ErrNotFound, fmt.Sprintf("function '%s' not found", funcName), nil)
@@ -1039,13 +3099,18 @@ func (c *Config) Call(funcName string, args ...interface{}) ([]interface{}, erro
 		luaArgs[i] = lv
 	}
 
+	callCtx, restore := c.bindExecContext(ctx, c.maxExecutionTime())
 	err := c.L.CallByParam(lua.P{
 		Fn:      fn,
 		NRet:    lua.MultRet,
 		Protect: true,
 	}, luaArgs...)
+	restore()
 
 	if err != nil {
+		if ctxErr := contextError(callCtx, fmt.Sprintf("calling '%s'", funcName), err); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, WrapLuaError(c.L, err)
 	}
 
@@ -1060,64 +3125,218 @@ func (c *Config) Call(funcName string, args ...interface{}) ([]interface{}, erro
 			table := val.(*lua.LTable)
 			maxn := table.MaxN()
 
-			if maxn > 0 {
-				// It's an array-like table
-				slice := make([]interface{}, maxn)
-				for j := 1; j <= maxn; j++ {
-					elem := table.RawGetInt(j)
-					if elem != lua.LNil {
-						converted, err := c.luaToGo(elem, reflect.TypeOf((*interface{})(nil)).Elem())
-						if err == nil {
-							slice[j-1] = converted
-						}
-					}
-				}
-				result[i-1] = slice
-			} else {
-				// It's a regular table
-				converted, err := c.luaToGo(val, reflect.TypeOf((*interface{})(nil)).Elem())
-				if err != nil {
-					return nil, err
+			if maxn > 0 && table.RawGet(lua.LNumber(0)) == lua.LNil {
+				// It's an array-like table
+				slice := make([]interface{}, maxn)
+				for j := 1; j <= maxn; j++ {
+					elem := table.RawGetInt(j)
+					if elem != lua.LNil {
+						converted, err := c.luaToGo(elem, reflect.TypeOf((*interface{})(nil)).Elem())
+						if err == nil {
+							slice[j-1] = converted
+						}
+					}
+				}
+				result[i-1] = slice
+			} else {
+				// It's a regular table
+				converted, err := c.luaToGo(val, reflect.TypeOf((*interface{})(nil)).Elem())
+				if err != nil {
+					return nil, err
+				}
+				result[i-1] = converted
+			}
+		} else {
+			converted, err := c.luaToGo(val, reflect.TypeOf((*interface{})(nil)).Elem())
+			if err != nil {
+				return nil, err
+			}
+			result[i-1] = converted
+		}
+	}
+
+	c.L.SetTop(0) // Clear the stack
+	return result, nil
+}
+
+// RegisterConstants registers multiple constants at once
+func (c *Config) RegisterConstants(constants map[string]interface{}) error {
+	for name, value := range constants {
+		if err := c.SetGlobal(name, value); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.recordConstant(name)
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// recordConstant notes name as a registered constant for Describe. The
+// caller must hold c.mu.
+func (c *Config) recordConstant(name string) {
+	if c.constants == nil {
+		c.constants = make(map[string]bool)
+	}
+	c.constants[name] = true
+}
+
+// RegisterConstantTable registers constants under a read-only namespace,
+// e.g. RegisterConstantTable("http", ...) exposes http.OK. Assigning to a
+// field of the namespace, or of a nested table inside it, raises a Lua error.
+// The namespace is a proxy over the values, so pairs() does not enumerate it.
+func (c *Config) RegisterConstantTable(name string, constants map[string]interface{}) error {
+	if name == "" {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "constant table name cannot be empty",
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.changed()
+
+	values := c.L.NewTable()
+	for key, value := range constants {
+		lv, err := c.goToLua(value)
+		if err != nil {
+			return &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("failed to convert constant %s.%s", name, key),
+				Cause:   err,
+			}
+		}
+		values.RawSetString(key, lv)
+	}
+
+	c.L.SetGlobal(name, c.freezeTable(name, values))
+	c.recordConstant(name)
+	return nil
+}
+
+// freezeTable returns a read-only proxy for table, freezing nested tables too
+func (c *Config) freezeTable(path string, table *lua.LTable) *lua.LTable {
+	table.ForEach(func(k, v lua.LValue) {
+		if nested, ok := v.(*lua.LTable); ok {
+			table.RawSet(k, c.freezeTable(path+"."+k.String(), nested))
+		}
+	})
+
+	mt := c.L.NewTable()
+	mt.RawSetString("__index", table)
+	mt.RawSetString("__newindex", c.L.NewFunction(func(L *lua.LState) int {
+		L.RaiseError("cannot assign to read-only constant %s.%s", path, L.Get(2).String())
+		return 0
+	}))
+	mt.RawSetString("__metatable", lua.LString("read-only"))
+
+	proxy := c.L.NewTable()
+	c.L.SetMetatable(proxy, mt)
+	return proxy
+}
+
+// LoadDirectory loads all .lua files in dir in lexical order of their names,
+// so later files can override globals set by earlier ones. Subdirectories
+// are skipped.
+func (c *Config) LoadDirectory(dir string) error {
+	return c.LoadDirectoryWithOptions(context.Background(), dir, LoadDirectoryOptions{})
+}
+
+// LoadDirectoryOptions configures LoadDirectoryWithOptions
+type LoadDirectoryOptions struct {
+	// Recursive descends into subdirectories, depth-first: a subdirectory is
+	// loaded in full at the point its name sorts among the files
+	Recursive bool
+	// Pattern is a filepath.Match pattern that file names must match. It
+	// defaults to "*.lua".
+	Pattern string
+}
+
+// LoadDirectoryWithOptions loads the files in dir matching opts.Pattern in
+// lexical order of their names, like LoadDirectory. Each file is loaded as
+// LoadFile does.
+func (c *Config) LoadDirectoryWithOptions(ctx context.Context, dir string, opts LoadDirectoryOptions) error {
+	if opts.Pattern == "" {
+		opts.Pattern = "*.lua"
+	}
+	if _, err := filepath.Match(opts.Pattern, ""); err != nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("invalid pattern %q", opts.Pattern),
+			Cause:   err,
+		}
+	}
+
+	return c.loadDirectory(ctx, dir, opts)
+}
+
+// loadDirectory loads the matching files of dir, and of its subdirectories
+// when opts.Recursive is set
+func (c *Config) loadDirectory(ctx context.Context, dir string, opts LoadDirectoryOptions) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return &Error{
+			Code:    ErrIO,
+			Message: fmt.Sprintf("failed to read %s", dir),
+			Cause:   err,
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if opts.Recursive {
+				if err := c.loadDirectory(ctx, path, opts); err != nil {
+					return err
 				}
-				result[i-1] = converted
 			}
-		} else {
-			converted, err := c.luaToGo(val, reflect.TypeOf((*interface{})(nil)).Elem())
-			if err != nil {
-				return nil, err
+			continue
+		}
+		if matched, _ := filepath.Match(opts.Pattern, entry.Name()); !matched {
+			continue
+		}
+		if err := c.LoadFile(ctx, path); err != nil {
+			return &Error{
+				Code:    ErrExecution,
+				Message: fmt.Sprintf("failed to load %s", path),
+				Cause:   err,
 			}
-			result[i-1] = converted
 		}
 	}
-
-	c.L.SetTop(0) // Clear the stack
-	return result, nil
+	return nil
 }
 
-// RegisterConstants registers multiple constants at once
-func (c *Config) RegisterConstants(constants map[string]interface{}) error {
-	for name, value := range constants {
-		if err := c.SetGlobal(name, value); err != nil {
-			return err
+// LoadFileFS loads and executes the Lua file name from fsys, such as an
+// embed.FS, exactly as LoadFile does for files on disk
+func (c *Config) LoadFileFS(ctx context.Context, fsys fs.FS, name string) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return &Error{
+			Code:    ErrIO,
+			Message: fmt.Sprintf("failed to read %s", name),
+			Cause:   err,
 		}
 	}
-	return nil
+	return c.LoadBytes(ctx, name, data)
 }
 
-// LoadDirectory loads all .lua files from a directory
-func (c *Config) LoadDirectory(dir string) error {
-	entries, err := os.ReadDir(dir)
+// LoadDirectoryFS loads all .lua files in dir of fsys, in name order, each
+// as LoadFileFS does
+func (c *Config) LoadDirectoryFS(ctx context.Context, fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		return err
 	}
 
 	for _, entry := range entries {
 		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".lua") {
-			path := filepath.Join(dir, entry.Name())
-			if err := c.L.DoFile(path); err != nil {
+			name := path.Join(dir, entry.Name())
+			if err := c.LoadFileFS(ctx, fsys, name); err != nil {
 				return &Error{
 					Code:    ErrExecution,
-					Message: fmt.Sprintf("failed to load %s", path),
+					Message: fmt.Sprintf("failed to load %s", name),
 					Cause:   err,
 				}
 			}
@@ -1128,6 +3347,8 @@ func (c *Config) LoadDirectory(dir string) error {
 
 // Eval evaluates a Lua expression and returns the result
 func (c *Config) Eval(expr string) (interface{}, error) {
+	defer c.lockPrimary()()
+
 	err := c.L.DoString(fmt.Sprintf("__eval_result = %s", expr))
 	if err != nil {
 		return nil, err
@@ -1139,16 +3360,251 @@ func (c *Config) Eval(expr string) (interface{}, error) {
 	return c.luaToGo(result, reflect.TypeOf((*interface{})(nil)).Elem())
 }
 
+// Must variants panic instead of returning an error. They are intended for
+// program startup, where a configuration failure should abort the process;
+// do not use them on reload paths or anywhere a failure is recoverable.
+
+// MustGet is like Get but panics with the *Error on failure
+func (c *Config) MustGet(ctx context.Context, name string, target interface{}) {
+	mustSucceed(c.Get(ctx, name, target))
+}
+
+// MustLoadFile is like LoadFile but panics with the *Error on failure
+func (c *Config) MustLoadFile(ctx context.Context, filename string) {
+	mustSucceed(c.LoadFile(ctx, filename))
+}
+
+// MustCall is like Call but panics with the *Error on failure
+func (c *Config) MustCall(funcName string, args ...interface{}) []interface{} {
+	result, err := c.Call(funcName, args...)
+	mustSucceed(err)
+	return result
+}
+
+// mustSucceed panics with err as a *Error if it is non-nil
+func mustSucceed(err error) {
+	if err == nil {
+		return
+	}
+
+	var lugoErr *Error
+	if errors.As(err, &lugoErr) {
+		panic(lugoErr)
+	}
+	panic(WrapError(ErrExecution, "operation failed", err))
+}
+
+// parseDuration parses a duration string as time.ParseDuration does
+func parseDuration(s lua.LString) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(string(s)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", string(s), err)
+	}
+	return d, nil
+}
+
+// parseTime parses an RFC 3339 time string, with or without fractional
+// seconds
+func parseTime(s lua.LString) (time.Time, error) {
+	tm, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(s)))
+	if err != nil {
+		return time.Time{}, &Error{
+			Code:    ErrConversion,
+			Message: fmt.Sprintf("invalid RFC 3339 time %q", string(s)),
+			Cause:   err,
+		}
+	}
+	return tm, nil
+}
+
+// parseBigInt converts a decimal or prefixed ("0x", "0b") integer string, or
+// a whole number, to a *big.Int. Strings are parsed without passing through
+// float64, so no digits are lost.
+func parseBigInt(lv lua.LValue) (*big.Int, error) {
+	switch v := lv.(type) {
+	case lua.LString:
+		n, ok := new(big.Int).SetString(strings.TrimSpace(string(v)), 0)
+		if !ok {
+			return nil, &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("invalid integer %q", string(v)),
+			}
+		}
+		return n, nil
+	case lua.LNumber:
+		f := float64(v)
+		if math.IsInf(f, 0) || f != math.Trunc(f) {
+			return nil, &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("%v is not an integer", f),
+			}
+		}
+		n, _ := big.NewFloat(f).Int(nil)
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to *big.Int", lv.Type())
+}
+
+// parseBigFloat converts a number string, or a number, to a *big.Float. A
+// string gets enough precision to hold all of its digits.
+func parseBigFloat(lv lua.LValue) (*big.Float, error) {
+	switch v := lv.(type) {
+	case lua.LString:
+		s := strings.TrimSpace(string(v))
+		prec := uint(64)
+		if p := uint(len(s)) * 4; p > prec {
+			prec = p
+		}
+		f, _, err := big.ParseFloat(s, 0, prec, big.ToNearestEven)
+		if err != nil {
+			return nil, &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("invalid number %q", string(v)),
+				Cause:   err,
+			}
+		}
+		return f, nil
+	case lua.LNumber:
+		if math.IsNaN(float64(v)) {
+			return nil, &Error{
+				Code:    ErrConversion,
+				Message: "NaN cannot be converted to *big.Float",
+			}
+		}
+		return big.NewFloat(float64(v)), nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to *big.Float", lv.Type())
+}
+
 // Helper function to convert Lua table to time.Time
 func (c *Config) luaTableToTime(table *lua.LTable) (time.Time, error) {
-	year := int(table.RawGetString("year").(lua.LNumber))
-	month := int(table.RawGetString("month").(lua.LNumber))
-	day := int(table.RawGetString("day").(lua.LNumber))
-	hour := int(table.RawGetString("hour").(lua.LNumber))
-	min := int(table.RawGetString("min").(lua.LNumber))
-	sec := int(table.RawGetString("sec").(lua.LNumber))
+	// year, month and day are required; the time of day defaults to midnight
+	// and the zone to UTC
+	fields := []struct {
+		name     string
+		required bool
+	}{
+		{"year", true}, {"month", true}, {"day", true},
+		{"hour", false}, {"min", false}, {"sec", false},
+	}
+
+	var parts [6]int
+	for i, field := range fields {
+		switch v := table.RawGetString(field.name).(type) {
+		case lua.LNumber:
+			parts[i] = int(v)
+		case *lua.LNilType:
+			if field.required {
+				return time.Time{}, &Error{
+					Code:    ErrConversion,
+					Message: fmt.Sprintf("time table is missing field %s", field.name),
+				}
+			}
+		default:
+			return time.Time{}, &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("time field %s must be a number, got %s", field.name, v.Type()),
+			}
+		}
+	}
 
-	return time.Date(year, time.Month(month), day, hour, min, sec, 0, time.Local), nil
+	loc, err := luaTimeLocation(table)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, loc), nil
+}
+
+// luaTimeLocation resolves the zone of a time table from at most one of:
+// tz, an IANA name such as "Europe/Paris" or an offset such as "+05:30";
+// offset, seconds east of UTC; or utc = true. Without any of them the time is
+// UTC, so configs decode the same regardless of the server's local zone.
+func luaTimeLocation(table *lua.LTable) (*time.Location, error) {
+	tz := table.RawGetString("tz")
+	offset := table.RawGetString("offset")
+	utc := table.RawGetString("utc")
+
+	set := 0
+	for _, v := range []lua.LValue{tz, offset, utc} {
+		if v != lua.LNil {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, &Error{
+			Code:    ErrConversion,
+			Message: "time table may set only one of tz, offset and utc",
+		}
+	}
+
+	switch {
+	case tz != lua.LNil:
+		name, ok := tz.(lua.LString)
+		if !ok {
+			return nil, &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("time field tz must be a string, got %s", tz.Type()),
+			}
+		}
+		return parseTimeZone(string(name))
+	case offset != lua.LNil:
+		secs, ok := offset.(lua.LNumber)
+		if !ok {
+			return nil, &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("time field offset must be a number, got %s", offset.Type()),
+			}
+		}
+		return time.FixedZone("", int(secs)), nil
+	case utc != lua.LNil:
+		if _, ok := utc.(lua.LBool); !ok {
+			return nil, &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("time field utc must be a boolean, got %s", utc.Type()),
+			}
+		}
+		if utc == lua.LFalse {
+			return time.Local, nil
+		}
+	}
+	return time.UTC, nil
+}
+
+var zoneOffsetRegex = regexp.MustCompile(`^([+-])([01]\d|2[0-3]):?([0-5]\d)?$`)
+
+// parseTimeZone accepts an IANA zone name, "Z", or a numeric offset in the
+// forms +hh, +hhmm and +hh:mm
+func parseTimeZone(name string) (*time.Location, error) {
+	if name == "Z" {
+		return time.UTC, nil
+	}
+	if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+		m := zoneOffsetRegex.FindStringSubmatch(name)
+		if m == nil {
+			return nil, &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("invalid time zone offset %q", name),
+			}
+		}
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		secs := hours*3600 + minutes*60
+		if m[1] == "-" {
+			secs = -secs
+		}
+		return time.FixedZone(name, secs), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, &Error{
+			Code:    ErrConversion,
+			Message: fmt.Sprintf("unknown time zone %q", name),
+			Cause:   err,
+		}
+	}
+	return loc, nil
 }
 
 // FunctionMetadata contains information about a registered function
@@ -1206,6 +3662,11 @@ func (c *Config) RegisterLuaFunctionWithOptions(name string, fn func(*lua.LState
 		}
 	}
 
+	qualifiedName := name
+	if opts.Namespace != "" {
+		qualifiedName = opts.Namespace + "." + name
+	}
+
 	// Create the function wrapper with hooks and middleware
 	wrapper := func(L *lua.LState) int {
 		// Run pre-call hook
@@ -1218,9 +3679,14 @@ func (c *Config) RegisterLuaFunctionWithOptions(name string, fn func(*lua.LState
 
 		// Call the function with middleware
 		var err error
+		audit := c.beginAudit(qualifiedName, L)
 		defer func() {
 			if r := recover(); r != nil {
+				if isStructuredError(r) {
+					panic(r)
+				}
 				err = fmt.Errorf("panic in function %s: %v", name, r)
+				audit.finish(nil, err)
 				L.RaiseError("%v", err)
 			}
 
@@ -1238,12 +3704,27 @@ func (c *Config) RegisterLuaFunctionWithOptions(name string, fn func(*lua.LState
 			}
 		}
 
-		return currentFn(L)
+		n := currentFn(L)
+		results := make([]lua.LValue, n)
+		for i := 0; i < n; i++ {
+			results[i] = L.Get(L.GetTop() - n + 1 + i)
+		}
+		audit.finish(results, nil)
+		return n
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	for _, n := range append([]string{name}, opts.Aliases...) {
+		if opts.Namespace != "" {
+			n = opts.Namespace + "." + n
+		}
+		if err := c.checkNameFree(n); err != nil {
+			return err
+		}
+	}
+
 	// Register the function in the specified namespace
 	if opts.Namespace != "" {
 		if err := c.registerInNamespace(opts.Namespace, name, wrapper); err != nil {
@@ -1367,8 +3848,44 @@ func (c *Config) ComposeFunctions(name string, funcs ...string) error {
 	return c.RegisterLuaFunction(name, wrapper)
 }
 
+// RegisterMiddleware registers a named middleware that functions registered
+// with RegisterLuaFunctionWithOptions can list in FunctionOptions.Middleware.
+// Middlewares are applied in the order listed, the first being outermost.
+func (c *Config) RegisterMiddleware(name string, mw func(lua.LGFunction) lua.LGFunction) error {
+	if name == "" {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "middleware name cannot be empty",
+		}
+	}
+	if mw == nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "middleware cannot be nil",
+		}
+	}
+
+	c.middlewareMu.Lock()
+	defer c.middlewareMu.Unlock()
+
+	if _, exists := c.middlewareMap[name]; exists {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("middleware '%s' is already registered", name),
+		}
+	}
+	if c.middlewareMap == nil {
+		c.middlewareMap = make(map[string]func(lua.LGFunction) lua.LGFunction)
+	}
+	c.middlewareMap[name] = mw
+	return nil
+}
+
 // getMiddleware retrieves a middleware by name
 func (c *Config) getMiddleware(name string) (func(lua.LGFunction) lua.LGFunction, bool) {
+	c.middlewareMu.RLock()
+	defer c.middlewareMu.RUnlock()
+
 	if c.middlewareMap == nil {
 		return nil, false
 	}
@@ -1423,6 +3940,23 @@ func (c *Config) RegisterLuaFunctionString(name string, luaCode string) error {
 }
 
 // Stack manipulation methods
+//
+// Stack positions are 1-based and relative to the top of the stack:
+// pos = 1 is the top, pos = 2 is one below the top, and pos = GetStackSize()
+// is the bottom. Any position outside [1, GetStackSize()] returns an *Error
+// with code ErrStack.
+
+// stackIndex converts a top-relative position into an absolute Lua stack index
+func (c *Config) stackIndex(pos int) (int, error) {
+	size := c.GetStackSize()
+	if pos < 1 || pos > size {
+		return 0, &Error{
+			Code:    ErrStack,
+			Message: fmt.Sprintf("invalid stack position %d (stack size %d)", pos, size),
+		}
+	}
+	return size - pos + 1, nil
+}
 
 // PushValue pushes a Go value onto the Lua stack, converting it to a Lua value.
 func (c *Config) PushValue(v interface{}) error {
@@ -1435,14 +3969,14 @@ func (c *Config) PushValue(v interface{}) error {
 }
 
 // PopValue pops a value from the top of the Lua stack and converts it to a Go value.
-// Returns an error if the conversion fails.
+// Returns an ErrStack error if the stack is empty, or an error if the conversion fails.
 func (c *Config) PopValue() (interface{}, error) {
-	top := c.L.GetTop()
-	if top == 0 {
-		return nil, fmt.Errorf("stack is empty")
+	index, err := c.stackIndex(1)
+	if err != nil {
+		return nil, err
 	}
 
-	val := c.L.Get(top)
+	val := c.L.Get(index)
 	c.L.Pop(1)
 
 	goVal, err := c.luaToGo(val, reflect.TypeOf((*interface{})(nil)).Elem())
@@ -1453,16 +3987,99 @@ func (c *Config) PopValue() (interface{}, error) {
 	return goVal, nil
 }
 
-// PeekValue returns the value at the given stack position (1-based index from the top) without removing it.
-// pos = 1 means the top of the stack, pos = 2 means one below the top, and so on.
-// Returns an error if pos is out of range.
+// PushValues pushes several Go values onto the Lua stack in order. If any value
+// fails to convert, the values already pushed by this call are removed.
+func (c *Config) PushValues(values ...interface{}) error {
+	top := c.GetStackSize()
+	for i, v := range values {
+		lv, err := c.goToLua(v)
+		if err != nil {
+			c.L.SetTop(top)
+			return &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("failed to push value %d onto stack", i+1),
+				Cause:   err,
+			}
+		}
+		c.L.Push(lv)
+	}
+	return nil
+}
+
+// PopValues pops the top n values from the Lua stack and converts them to Go values.
+// The result is in push order, so the former top of the stack is the last element.
+// The stack is left untouched if n is out of range or any conversion fails.
+func (c *Config) PopValues(n int) ([]interface{}, error) {
+	if n == 0 {
+		return []interface{}{}, nil
+	}
+
+	bottom, err := c.stackIndex(n)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		goVal, err := c.luaToGo(c.L.Get(bottom+i), reflect.TypeOf((*interface{})(nil)).Elem())
+		if err != nil {
+			return nil, err
+		}
+		result[i] = goVal
+	}
+
+	c.L.Pop(n)
+	return result, nil
+}
+
+// PopInto pops the value at the top of the Lua stack and decodes it into target,
+// which must be a pointer to a struct, slice, map, or scalar.
+func (c *Config) PopInto(target interface{}) error {
+	val := reflect.ValueOf(target)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("target must be a non-nil pointer, got %T", target),
+		}
+	}
+
+	index, err := c.stackIndex(1)
+	if err != nil {
+		return err
+	}
+
+	lv := c.L.Get(index)
+	c.L.Pop(1)
+
+	goVal, err := c.luaToGo(lv, val.Elem().Type())
+	if err != nil {
+		return &Error{
+			Code:    ErrConversion,
+			Message: "failed to decode popped value",
+			Cause:   err,
+		}
+	}
+
+	rv, err := assignableValue(goVal, val.Elem().Type())
+	if err != nil {
+		return &Error{
+			Code:    ErrConversion,
+			Message: "failed to decode popped value",
+			Cause:   err,
+		}
+	}
+	val.Elem().Set(rv)
+	return nil
+}
+
+// PeekValue returns the value at the given top-relative stack position without removing it.
+// Returns an ErrStack error if pos is out of range.
 func (c *Config) PeekValue(pos int) (interface{}, error) {
-	top := c.L.GetTop()
-	if pos < 1 || pos > top {
-		return nil, fmt.Errorf("invalid stack position %d", pos)
+	index, err := c.stackIndex(pos)
+	if err != nil {
+		return nil, err
 	}
 
-	index := top - pos + 1
 	val := c.L.Get(index)
 	goVal, err := c.luaToGo(val, reflect.TypeOf((*interface{})(nil)).Elem())
 	if err != nil {
@@ -1482,14 +4099,13 @@ func (c *Config) ClearStack() {
 	c.L.SetTop(0)
 }
 
-// GetRawLuaValue retrieves the raw lua.LValue at a given stack position.
-// pos = 1 means the top of the stack. Use caution with indexing.
+// GetRawLuaValue retrieves the raw lua.LValue at the given top-relative stack position.
+// Returns an ErrStack error if pos is out of range.
 func (c *Config) GetRawLuaValue(pos int) (lua.LValue, error) {
-	top := c.L.GetTop()
-	if pos < 1 || pos > top {
-		return nil, fmt.Errorf("invalid stack position %d", pos)
+	index, err := c.stackIndex(pos)
+	if err != nil {
+		return nil, err
 	}
-	index := top - pos + 1
 	return c.L.Get(index), nil
 }
 
@@ -1507,6 +4123,20 @@ func (c *Config) Push(value interface{}) error {
 	return nil
 }
 
+// PushStruct pushes a struct (or pointer to struct) onto the Lua stack as a table.
+func (c *Config) PushStruct(v interface{}) error {
+	table, err := c.structToTable(v)
+	if err != nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "failed to push struct onto stack",
+			Cause:   err,
+		}
+	}
+	c.L.Push(table)
+	return nil
+}
+
 // PushLuaValue pushes a raw lua.LValue onto the stack without conversion.
 func (c *Config) PushLuaValue(v lua.LValue) {
 	c.L.Push(v)
@@ -1548,25 +4178,25 @@ func (c *Config) DoStringContext(ctx context.Context, script string) error {
 		}
 	}
 
-	errChan := make(chan error, 1)
-
-	go func() {
-		errChan <- c.L.DoString(script)
-	}()
+	execCtx, restore := c.bindExecContext(ctx, c.maxExecutionTime())
+	err := c.L.DoString(script)
+	restore()
+	c.changed()
 
-	select {
-	case <-ctx.Done():
-		return &Error{
-			Code:    ErrCanceled,
-			Message: "context canceled during execution",
-			Cause:   ctx.Err(),
+	if err != nil {
+		if ctx.Err() != nil {
+			return &Error{
+				Code:    ErrCanceled,
+				Message: "context canceled during execution",
+				Cause:   ctx.Err(),
+			}
 		}
-	case err := <-errChan:
-		if err != nil {
-			return WrapLuaError(c.L, err)
+		if ctxErr := contextError(execCtx, "script", err); ctxErr != nil {
+			return ctxErr
 		}
-		return nil
+		return WrapLuaError(c.L, err)
 	}
+	return nil
 }
 
 // DoFileContext executes a Lua file in the given context.
@@ -1580,19 +4210,23 @@ func (c *Config) DoFileContext(ctx context.Context, path string) error {
 		}
 	}
 
+	execCtx, restore := c.bindExecContext(ctx, c.maxExecutionTime())
 	err := c.L.DoFile(path)
-	if err != nil {
-		return WrapLuaError(c.L, err)
-	}
+	restore()
+	c.changed()
 
-	// If you want to consider context again:
-	if ctx.Err() != nil {
-		return &Error{
-			Code:    ErrCanceled,
-			Message: "context canceled during file execution",
-			Cause:   ctx.Err(),
+	if err != nil {
+		if ctx.Err() != nil {
+			return &Error{
+				Code:    ErrCanceled,
+				Message: "context canceled during file execution",
+				Cause:   ctx.Err(),
+			}
+		}
+		if ctxErr := contextError(execCtx, "script", err); ctxErr != nil {
+			return ctxErr
 		}
+		return WrapLuaError(c.L, err)
 	}
-
 	return nil
 }
@@ -0,0 +1,136 @@
+package lugo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+type fuzzTarget struct {
+	Name   string                 `lua:"name"`
+	Port   int                    `lua:"port"`
+	Ratio  float32                `lua:"ratio"`
+	Debug  *bool                  `lua:"debug"`
+	Tags   []string               `lua:"tags"`
+	Items  []fuzzTarget           `lua:"items"`
+	Nested *fuzzTarget            `lua:"nested"`
+	When   time.Time              `lua:"when"`
+	Wait   time.Duration          `lua:"wait"`
+	Meta   map[string]interface{} `lua:"meta"`
+	Counts map[string]int         `lua:"counts"`
+	Any    interface{}            `lua:"any"`
+}
+
+// fuzzTargetTypes are the decode targets exercised for every generated table
+var fuzzTargetTypes = []reflect.Type{
+	reflect.TypeOf((*interface{})(nil)).Elem(),
+	reflect.TypeOf((*error)(nil)).Elem(),
+	reflect.TypeOf(map[string]interface{}{}),
+	reflect.TypeOf(map[int]string{}),
+	reflect.TypeOf([]interface{}{}),
+	reflect.TypeOf([]string{}),
+	reflect.TypeOf([][]int{}),
+	reflect.TypeOf(time.Time{}),
+	reflect.TypeOf(fuzzTarget{}),
+	reflect.TypeOf(&fuzzTarget{}),
+	reflect.TypeOf(0),
+	reflect.TypeOf(""),
+	reflect.TypeOf(false),
+	reflect.TypeOf([4]int{}),
+	reflect.TypeOf(uint8(0)),
+}
+
+// fuzzKeys are the string keys used when building tables; they overlap with
+// the fields of fuzzTarget and time tables so decoding takes interesting paths
+var fuzzKeys = []string{
+	"name", "port", "ratio", "debug", "tags", "items", "nested", "when", "wait",
+	"meta", "counts", "any", "year", "month", "day", "hour", "min", "sec",
+	"", "0", strings.Repeat("k", 4096),
+}
+
+// buildFuzzTable interprets data as a program that builds a Lua table,
+// including nested, self-referencing and wrongly-typed values
+func buildFuzzTable(L *lua.LState, data []byte) *lua.LTable {
+	root := L.NewTable()
+	stack := []*lua.LTable{root}
+
+	for i := 0; i+1 < len(data); i += 2 {
+		op, arg := data[i], data[i+1]
+		current := stack[len(stack)-1]
+		key := lua.LString(fuzzKeys[int(arg)%len(fuzzKeys)])
+
+		switch op % 10 {
+		case 0:
+			current.RawSet(key, lua.LNumber(float64(arg)-128.5))
+		case 1:
+			current.RawSet(key, lua.LString(strings.Repeat("x", int(arg))))
+		case 2:
+			current.RawSet(key, lua.LBool(arg%2 == 0))
+		case 3:
+			child := L.NewTable()
+			current.RawSet(key, child)
+			stack = append(stack, child)
+		case 4:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case 5:
+			// Reference an ancestor to create a cycle
+			current.RawSet(key, stack[int(arg)%len(stack)])
+		case 6:
+			current.Append(lua.LNumber(arg))
+		case 7:
+			current.RawSetInt(int(arg)-64, lua.LString("sparse"))
+		case 8:
+			current.RawSet(key, L.NewFunction(func(L *lua.LState) int { return 0 }))
+		case 9:
+			current.RawSet(lua.LNumber(float64(arg)/3), current)
+		}
+	}
+	return root
+}
+
+func FuzzLuaToGo(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 1, 1, 2, 2, 3})
+	f.Add([]byte{3, 15, 0, 12, 1, 13, 0, 14, 4, 0})                   // time table
+	f.Add([]byte{3, 15, 1, 12, 4, 0})                                 // non-numeric year
+	f.Add([]byte{5, 0, 3, 6, 5, 1, 9, 7})                             // cycles
+	f.Add([]byte{3, 6, 3, 6, 3, 6, 3, 6, 3, 6, 3, 6, 0, 1})           // deep nesting
+	f.Add([]byte{6, 1, 6, 2, 7, 100, 1, 20, 8, 3, 1, 1})              // mixed arrays
+	f.Add([]byte{1, 20, 3, 6, 6, 1, 6, 2, 4, 0, 3, 5, 5, 0, 0, 1, 2}) // struct-like
+
+	cfg := New()
+	defer cfg.Close()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > 512 {
+			return
+		}
+		table := buildFuzzTable(cfg.L, data)
+
+		for _, typ := range fuzzTargetTypes {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("luaToGo panicked decoding into %v: %v", typ, r)
+					}
+				}()
+				_, _ = cfg.luaToGo(table, typ)
+			}()
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("luaToStruct panicked: %v", r)
+				}
+			}()
+			var target fuzzTarget
+			_ = cfg.luaToStruct(table, &target)
+		}()
+	})
+}
@@ -217,6 +217,98 @@ func TestStackErrorHandling(t *testing.T) {
 	assert.Error(t, err, "Expected error pushing unsupported type")
 }
 
+func TestStackBounds(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.PushValue("alpha"))
+	require.NoError(t, cfg.PushValue("beta"))
+	size := cfg.GetStackSize()
+
+	// The bottom of the stack is still valid
+	_, err := cfg.PeekValue(size)
+	require.NoError(t, err)
+	_, err = cfg.GetRawLuaValue(size)
+	require.NoError(t, err)
+
+	// One past the bottom is rejected consistently
+	_, err = cfg.PeekValue(size + 1)
+	assert.True(t, IsErrorCode(err, ErrStack), "PeekValue should return ErrStack")
+
+	_, err = cfg.GetRawLuaValue(size + 1)
+	assert.True(t, IsErrorCode(err, ErrStack), "GetRawLuaValue should return ErrStack")
+
+	_, err = cfg.PeekValue(0)
+	assert.True(t, IsErrorCode(err, ErrStack), "position 0 should return ErrStack")
+
+	// PopValue always reads position 1, so an empty stack is size+1
+	cfg.ClearStack()
+	_, err = cfg.PopValue()
+	assert.True(t, IsErrorCode(err, ErrStack), "PopValue should return ErrStack")
+	assert.Equal(t, 0, cfg.GetStackSize())
+}
+
+func TestPushStructPopInto(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	type Server struct {
+		Host  string   `lua:"host"`
+		Port  int      `lua:"port"`
+		Tags  []string `lua:"tags"`
+		Debug bool     `lua:"debug"`
+	}
+
+	in := Server{Host: "localhost", Port: 8080, Tags: []string{"a", "b"}, Debug: true}
+	require.NoError(t, cfg.PushStruct(&in))
+	assert.Equal(t, 1, cfg.GetStackSize())
+
+	var out Server
+	require.NoError(t, cfg.PopInto(&out))
+	assert.Equal(t, in, out)
+	assert.Equal(t, 0, cfg.GetStackSize())
+
+	// Decoding into a slice
+	require.NoError(t, cfg.Push([]int{1, 2, 3}))
+	var nums []int
+	require.NoError(t, cfg.PopInto(&nums))
+	assert.Equal(t, []int{1, 2, 3}, nums)
+
+	// Error cases
+	assert.Error(t, cfg.PushStruct("not a struct"))
+	assert.True(t, IsErrorCode(cfg.PopInto(&out), ErrStack))
+	require.NoError(t, cfg.PushString("x"))
+	assert.True(t, IsErrorCode(cfg.PopInto(out), ErrInvalidType))
+}
+
+func TestPushPopValues(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.PushValues("one", 2, true, 4.5, "five"))
+	assert.Equal(t, 5, cfg.GetStackSize())
+
+	vals, err := cfg.PopValues(3)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{true, 4.5, "five"}, vals)
+	assert.Equal(t, 2, cfg.GetStackSize())
+
+	// Popping more than is available leaves the stack alone
+	_, err = cfg.PopValues(3)
+	assert.True(t, IsErrorCode(err, ErrStack))
+	assert.Equal(t, 2, cfg.GetStackSize())
+
+	// A conversion failure mid-push rolls back the whole batch
+	type unsupported struct{}
+	err = cfg.PushValues("a", "b", unsupported{})
+	require.Error(t, err)
+	assert.Equal(t, 2, cfg.GetStackSize())
+
+	vals, err = cfg.PopValues(2)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"one", float64(2)}, vals)
+}
+
 func TestPushMethods(t *testing.T) {
 	cfg := New()
 	defer cfg.Close()
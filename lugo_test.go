@@ -7,15 +7,19 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	lua "github.com/yuin/gopher-lua"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 // Test structures
@@ -103,6 +107,46 @@ func TestBasicInitialization(t *testing.T) {
 	}
 }
 
+// TestCloseIdempotent tests that Close can be called more than once
+func TestCloseIdempotent(t *testing.T) {
+	cfg := New()
+	assert.NotPanics(t, func() {
+		cfg.Close()
+		cfg.Close()
+	})
+
+	var nilCfg *Config
+	assert.NotPanics(t, nilCfg.Close)
+
+	cfg = New()
+	defer cfg.Close()
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.lua")
+	require.NoError(t, os.WriteFile(configPath, []byte(`x = 1`), 0644))
+
+	watcher, err := cfg.NewWatcher(WatcherConfig{Paths: []string{configPath}})
+	require.NoError(t, err)
+	assert.NoError(t, watcher.Close())
+	assert.NotPanics(t, func() { _ = watcher.Close() })
+
+	pluginDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(pluginDir, "hello.lua"), []byte(`
+		metadata = { name = "hello", version = "1.0.0", description = "test plugin" }
+		exports = { greet = function(name) return "hello " .. name end }
+	`), 0644))
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	require.NoError(t, pm.LoadPlugins(context.Background(), pluginDir))
+	_, ok := pm.GetPlugin("hello")
+	require.True(t, ok)
+
+	assert.NoError(t, pm.Close())
+	assert.NotPanics(t, func() { _ = pm.Close() })
+	_, ok = pm.GetPlugin("hello")
+	assert.False(t, ok)
+}
+
 // TestTypeRegistration tests the registration and validation of Go types
 func TestTypeRegistration(t *testing.T) {
 	tests := []struct {
@@ -390,6 +434,114 @@ func TestFunctionRegistration(t *testing.T) {
 	}
 }
 
+// TestRegisterFunctionWithOptions tests namespacing and aliasing Go functions
+func TestRegisterFunctionWithOptions(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	err := cfg.RegisterFunctionWithOptions(context.Background(), "get", func(ctx context.Context, url string) (string, error) {
+		if url == "" {
+			return "", errors.New("empty url")
+		}
+		return "GET " + url, nil
+	}, FunctionOptions{
+		Namespace: "http.client",
+		Aliases:   []string{"fetch"},
+		Metadata:  &FunctionMetadata{Description: "Performs a GET request"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cfg.DoString(`
+		assert(http.client.get("/health") == "GET /health")
+		assert(http.client.fetch("/ready") == "GET /ready")
+		assert(get == nil)
+	`))
+	assert.Equal(t, "Performs a GET request", cfg.functionMetadata["get"].Description)
+
+	err = cfg.DoString(`http.client.get("")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "empty url")
+
+	err = cfg.RegisterFunctionWithOptions(context.Background(), "bad", 42, FunctionOptions{})
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+}
+
+// TestRegisterSimpleFunc tests registering a closure without reflection
+func TestRegisterSimpleFunc(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	err := cfg.RegisterSimpleFunc("describe", func(args []interface{}) ([]interface{}, error) {
+		if len(args) == 0 {
+			return nil, errors.New("no arguments")
+		}
+		return []interface{}{len(args), fmt.Sprintf("%v", args[0])}, nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cfg.DoString(`
+		local n, first = describe("hello", 2, true)
+		assert(n == 3)
+		assert(first == "hello")
+	`))
+
+	err = cfg.DoString(`describe()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no arguments")
+
+	assert.Error(t, cfg.RegisterSimpleFunc("", nil))
+	assert.Error(t, cfg.RegisterSimpleFunc("nilfn", nil))
+}
+
+// TestReplaceFunction tests hot-swapping a registered function
+func TestReplaceFunction(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.RegisterFunction(context.Background(), "version", func() string {
+		return "v1"
+	}))
+	require.NoError(t, cfg.DoString(`assert(version() == "v1")`))
+
+	require.NoError(t, cfg.ReplaceFunction("version", func() string {
+		return "v2"
+	}))
+	require.NoError(t, cfg.DoString(`assert(version() == "v2")`))
+
+	// Namespaced functions keep their metadata with refreshed types
+	require.NoError(t, cfg.RegisterLuaFunctionWithOptions("scale", func(L *lua.LState) int {
+		L.Push(L.Get(1))
+		return 1
+	}, FunctionOptions{
+		Namespace: "math2",
+		Metadata: &FunctionMetadata{
+			Description: "Scales a number",
+			Params:      []ParamMetadata{{Name: "x", Type: "number"}},
+		},
+	}))
+
+	require.NoError(t, cfg.ReplaceFunction("math2.scale", func(x float64, factor float64) float64 {
+		return x * factor
+	}))
+	require.NoError(t, cfg.DoString(`assert(math2.scale(3, 2) == 6)`))
+
+	metadata := cfg.functionMetadata["scale"]
+	require.NotNil(t, metadata)
+	assert.Equal(t, "Scales a number", metadata.Description)
+	require.Len(t, metadata.Params, 2)
+	assert.Equal(t, "x", metadata.Params[0].Name)
+	assert.Equal(t, "float64", metadata.Params[0].Type)
+	assert.Equal(t, "arg2", metadata.Params[1].Name)
+	require.Len(t, metadata.Returns, 1)
+	assert.Equal(t, "float64", metadata.Returns[0].Type)
+
+	// Unknown functions cannot be replaced
+	err := cfg.ReplaceFunction("missing", func() {})
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+	err = cfg.ReplaceFunction("math2.missing", func() {})
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+}
+
 // TestSandbox tests the sandbox security features
 func TestSandbox(t *testing.T) {
 	tests := []struct {
@@ -454,6 +606,76 @@ func TestSandbox(t *testing.T) {
 	}
 }
 
+// TestAllowedRequireModules tests that only allowlisted modules can be required
+func TestAllowedRequireModules(t *testing.T) {
+	cfg := New(WithAllowedRequireModules("allowed"))
+	defer cfg.Close()
+
+	loader := func(L *lua.LState) int {
+		mod := L.NewTable()
+		mod.RawSetString("value", lua.LNumber(42))
+		L.Push(mod)
+		return 1
+	}
+	cfg.L.PreloadModule("allowed", loader)
+	cfg.L.PreloadModule("denied", loader)
+
+	dir := t.TempDir()
+	allowedFile := filepath.Join(dir, "allowed.lua")
+	require.NoError(t, os.WriteFile(allowedFile, []byte(`
+		local m = require("allowed")
+		result = m.value
+	`), 0644))
+
+	deniedFile := filepath.Join(dir, "denied.lua")
+	require.NoError(t, os.WriteFile(deniedFile, []byte(`
+		local m = require("denied")
+	`), 0644))
+
+	require.NoError(t, cfg.LoadFile(context.Background(), allowedFile))
+	var result int
+	require.NoError(t, cfg.GetGlobal("result", &result))
+	assert.Equal(t, 42, result)
+
+	err := cfg.LoadFile(context.Background(), deniedFile)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "module 'denied' is not allowed")
+
+	// The allowlist applies from the start, outside LoadFile and in pooled states
+	for _, opts := range [][]Option{nil, {WithStatePool(1)}} {
+		fresh := New(append(opts, WithAllowedRequireModules("allowed"))...)
+		err = fresh.DoString(`require("os")`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "module 'os' is not allowed")
+		_, err = fresh.Eval(`require("os")`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "module 'os' is not allowed")
+		fresh.Close()
+	}
+
+	// Nor can other modules be reached through the package tables
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.lua"), []byte(`return { value = 7 }`), 0644))
+	require.NoError(t, cfg.DoString(`package.path = "`+filepath.Join(dir, "?.lua")+`"`))
+	routes := map[string]string{
+		"package.loaded.io":      `type(package.loaded.io)`,
+		"package.loaded.os":      `type(package.loaded.os)`,
+		"package.preload.denied": `type(package.preload.denied)`,
+		"preload searcher":       `type(package.loaders[1]("denied"))`,
+		"file searcher":          `type(package.loaders[2]("secret"))`,
+		"metatable":              `type(getmetatable(package.loaded))`,
+	}
+	for route, expr := range routes {
+		kind, err := cfg.Eval(expr)
+		require.NoError(t, err, route)
+		assert.Contains(t, []interface{}{"nil", "string"}, kind, route)
+	}
+
+	// Allowed modules are still reachable
+	sum, err := cfg.Eval(`package.loaded.allowed.value + package.preload.allowed().value`)
+	require.NoError(t, err)
+	assert.Equal(t, float64(84), sum)
+}
+
 func TestConcurrentMiddleware(t *testing.T) {
 	var (
 		callCount int32
@@ -875,6 +1097,187 @@ func TestTypeConversion(t *testing.T) {
 	}
 }
 
+// TestMetatableResolution tests decoding computed fields from OO-style config objects
+func TestMetatableResolution(t *testing.T) {
+	type Person struct {
+		First    string `lua:"first"`
+		Last     string `lua:"last"`
+		FullName string `lua:"full_name"`
+		Role     string `lua:"role"`
+	}
+
+	script := `
+		local Base = { role = "member" }
+		local Person = setmetatable({}, { __index = Base })
+		Person.__index = function(self, key)
+			if key == "full_name" then
+				return self.first .. " " .. self.last
+			end
+			return Person[key]
+		end
+
+		person = setmetatable({ first = "Ada", last = "Lovelace" }, Person)
+	`
+
+	t.Run("enabled", func(t *testing.T) {
+		cfg := New(WithMetatableResolution(true))
+		defer cfg.Close()
+
+		require.NoError(t, cfg.DoString(script))
+
+		var p Person
+		require.NoError(t, cfg.Get(context.Background(), "person", &p))
+		assert.Equal(t, "Ada", p.First)
+		assert.Equal(t, "Ada Lovelace", p.FullName)
+		assert.Equal(t, "member", p.Role)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := New()
+		defer cfg.Close()
+
+		require.NoError(t, cfg.DoString(script))
+
+		var p Person
+		require.NoError(t, cfg.Get(context.Background(), "person", &p))
+		assert.Equal(t, "Ada", p.First)
+		assert.Empty(t, p.FullName)
+		assert.Empty(t, p.Role)
+	})
+
+	t.Run("index error", func(t *testing.T) {
+		cfg := New(WithMetatableResolution(true))
+		defer cfg.Close()
+
+		require.NoError(t, cfg.DoString(`
+			person = setmetatable({}, { __index = function() error("boom") end })
+		`))
+
+		var p Person
+		err := cfg.Get(context.Background(), "person", &p)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "boom")
+	})
+}
+
+// TestUTF8Conversion tests that non-ASCII strings survive load -> Get and Go -> Lua
+func TestUTF8Conversion(t *testing.T) {
+	type Localized struct {
+		Title string            `lua:"title"`
+		Tags  []string          `lua:"tags"`
+		Names map[string]string `lua:"names"`
+	}
+
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		localized = {
+			title = "日本語のタイトル 🎉",
+			tags = { "中文", "한국어", "🚀" },
+			names = { ["名前"] = "太郎", emoji = "👩‍💻" }
+		}
+	`))
+
+	var loc Localized
+	require.NoError(t, cfg.Get(context.Background(), "localized", &loc))
+	assert.Equal(t, "日本語のタイトル 🎉", loc.Title)
+	assert.Equal(t, []string{"中文", "한국어", "🚀"}, loc.Tags)
+	assert.Equal(t, "太郎", loc.Names["名前"])
+	assert.Equal(t, "👩‍💻", loc.Names["emoji"])
+
+	// Go -> Lua -> Go
+	require.NoError(t, cfg.SetGlobal("copy", loc))
+	require.NoError(t, cfg.DoString(`assert(copy.title == "日本語のタイトル 🎉")`))
+
+	var back Localized
+	require.NoError(t, cfg.Get(context.Background(), "copy", &back))
+	assert.Equal(t, loc, back)
+}
+
+// TestValidationErrorSourcePosition tests that type mismatch errors point
+// at the file and line that assigned the value
+func TestValidationErrorSourcePosition(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	path := filepath.Join(t.TempDir(), "config.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`config = {
+	name = "app",
+	server = {
+		host = "localhost",
+		port = "eighty",
+	},
+}
+config.debug = "yes"
+`), 0644))
+	require.NoError(t, cfg.LoadFile(context.Background(), path))
+
+	type Config struct {
+		Name   string `lua:"name"`
+		Server struct {
+			Host string `lua:"host"`
+			Port int    `lua:"port"`
+		} `lua:"server"`
+	}
+	var c Config
+	err := cfg.Get(context.Background(), "config", &c)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field server: field port: expected number, got string")
+	assert.Contains(t, err.Error(), path+":5")
+
+	// Assignments outside the table constructor are tracked too
+	type WithDebug struct {
+		Debug bool `lua:"debug"`
+	}
+	var d WithDebug
+	err = cfg.Get(context.Background(), "config", &d)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), path+":8")
+}
+
+// TestValidatePath tests validating a single changed path
+func TestValidatePath(t *testing.T) {
+	type DynamicConfig struct {
+		Features struct {
+			EnableCache bool `lua:"enable_cache"`
+			CacheTTL    int  `lua:"cache_ttl"`
+		} `lua:"features"`
+		Limits struct {
+			MaxConnections int `lua:"max_connections"`
+		} `lua:"limits"`
+	}
+
+	cfg := New()
+	defer cfg.Close()
+
+	// limits.max_connections is invalid, but unrelated to the changed path
+	require.NoError(t, cfg.DoString(`
+		config = {
+			features = { enable_cache = true, cache_ttl = 60 },
+			limits = { max_connections = "lots" },
+		}
+	`))
+
+	var full DynamicConfig
+	assert.True(t, IsErrorCode(cfg.Get(context.Background(), "config", &full), ErrValidation))
+
+	err := cfg.ValidatePath(context.Background(), "config", "features.enable_cache", DynamicConfig{})
+	assert.NoError(t, err)
+
+	require.NoError(t, cfg.DoString(`config.features.enable_cache = "yes"`))
+	err = cfg.ValidatePath(context.Background(), "config", "features.enable_cache", &DynamicConfig{})
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrValidation))
+	assert.Contains(t, err.Error(), "features.enable_cache")
+
+	err = cfg.ValidatePath(context.Background(), "config", "features.unknown", DynamicConfig{})
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+
+	err = cfg.ValidatePath(context.Background(), "missing", "features", DynamicConfig{})
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+}
+
 // Benchmark tests
 func BenchmarkLuaExecution(b *testing.B) {
 	cfg := New()
@@ -957,6 +1360,52 @@ func BenchmarkConcurrentAccess(b *testing.B) {
 	})
 }
 
+func BenchmarkRegisteredFunctionCall(b *testing.B) {
+	cfg := New()
+	defer cfg.Close()
+
+	err := cfg.RegisterFunction(context.Background(), "scale", func(ctx context.Context, x int, factor float64) (float64, error) {
+		return float64(x) * factor, nil
+	})
+	require.NoError(b, err)
+	require.NoError(b, cfg.L.DoString(`
+		function hot()
+			local total = 0
+			for i = 1, 100 do
+				total = total + scale(i, 1.5)
+			end
+			return total
+		end
+	`))
+	hot := cfg.L.GetGlobal("hot")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cfg.L.CallByParam(lua.P{Fn: hot, NRet: 1, Protect: true}); err != nil {
+			b.Fatal(err)
+		}
+		cfg.L.Pop(1)
+	}
+}
+
+func TestRegisterFunctionVariadic(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	err := cfg.RegisterFunction(context.Background(), "join", func(sep string, parts ...string) string {
+		return strings.Join(parts, sep)
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, cfg.L.DoString(`all = join("-", "a", "b", "c"); none = join("-")`))
+	assert.Equal(t, "a-b-c", cfg.L.GetGlobal("all").String())
+	assert.Equal(t, "", cfg.L.GetGlobal("none").String())
+
+	require.NoError(t, cfg.L.DoString(`ok, err = pcall(join, "-", "a", {})`))
+	assert.Equal(t, lua.LFalse, cfg.L.GetGlobal("ok"))
+	assert.Contains(t, cfg.L.GetGlobal("err").(*lua.LTable).RawGetString("message").String(), "argument 3")
+}
+
 func TestTypeRegistrationErrors(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -1096,6 +1545,242 @@ func TestSimpleAPI(t *testing.T) {
 	}
 }
 
+func TestGetRaw(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		server = {
+			host = "localhost",
+			tls = { enabled = true, cert = "/path/to/cert" }
+		}
+	`))
+
+	lv, err := cfg.GetRaw("server.tls")
+	require.NoError(t, err)
+	table, ok := lv.(*lua.LTable)
+	require.True(t, ok, "expected raw table")
+	assert.Equal(t, lua.LTrue, table.RawGetString("enabled"))
+	assert.Equal(t, lua.LString("/path/to/cert"), table.RawGetString("cert"))
+
+	lv, err = cfg.GetRaw("server.host")
+	require.NoError(t, err)
+	assert.Equal(t, lua.LString("localhost"), lv)
+
+	_, err = cfg.GetRaw("server.missing")
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+
+	_, err = cfg.GetRaw("server.host.nested")
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+}
+
+func TestMustVariants(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.lua")
+	require.NoError(t, os.WriteFile(good, []byte(`
+		app = { name = "must" }
+		function add(a, b) return a + b end
+	`), 0644))
+
+	assert.NotPanics(t, func() {
+		cfg.MustLoadFile(context.Background(), good)
+	})
+
+	var app struct {
+		Name string `lua:"name"`
+	}
+	assert.NotPanics(t, func() {
+		cfg.MustGet(context.Background(), "app", &app)
+	})
+	assert.Equal(t, "must", app.Name)
+
+	var result []interface{}
+	assert.NotPanics(t, func() {
+		result = cfg.MustCall("add", 1, 2)
+	})
+	assert.Equal(t, []interface{}{float64(3)}, result)
+
+	panicCode := func(fn func()) (code ErrorCode) {
+		defer func() {
+			r := recover()
+			require.NotNil(t, r, "expected panic")
+			e, ok := r.(*Error)
+			require.True(t, ok, "expected *Error panic value, got %T", r)
+			code = e.Code
+		}()
+		fn()
+		return
+	}
+
+	assert.Equal(t, ErrNotFound, panicCode(func() {
+		cfg.MustGet(context.Background(), "missing", &app)
+	}))
+	assert.Equal(t, ErrExecution, panicCode(func() {
+		cfg.MustLoadFile(context.Background(), filepath.Join(dir, "missing.lua"))
+	}))
+	assert.Equal(t, ErrNotFound, panicCode(func() {
+		cfg.MustCall("missing")
+	}))
+}
+
+func TestLoadFileIfExists(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	dir := t.TempDir()
+
+	// Missing file is not an error
+	err := cfg.LoadFileIfExists(context.Background(), filepath.Join(dir, "missing.lua"))
+	assert.NoError(t, err)
+
+	// Present file is loaded
+	good := filepath.Join(dir, "good.lua")
+	require.NoError(t, os.WriteFile(good, []byte(`loaded = true`), 0644))
+	require.NoError(t, cfg.LoadFileIfExists(context.Background(), good))
+	var loaded bool
+	require.NoError(t, cfg.GetGlobal("loaded", &loaded))
+	assert.True(t, loaded)
+
+	// Present but broken file surfaces the error
+	broken := filepath.Join(dir, "broken.lua")
+	require.NoError(t, os.WriteFile(broken, []byte(`this is not lua`), 0644))
+	err = cfg.LoadFileIfExists(context.Background(), broken)
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrExecution))
+}
+
+func TestLoadBytesAndReader(t *testing.T) {
+	type Server struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+	ctx := context.Background()
+
+	var loaded []string
+	cfg.RegisterHook(AfterLoad, func(ctx context.Context, event HookEvent) error {
+		loaded = append(loaded, event.Name)
+		return nil
+	})
+
+	require.NoError(t, cfg.LoadBytes(ctx, "embedded.lua", []byte(`server = { host = "localhost", port = 8080 }`)))
+	var server Server
+	require.NoError(t, cfg.Get(ctx, "server", &server))
+	assert.Equal(t, Server{Host: "localhost", Port: 8080}, server)
+
+	require.NoError(t, cfg.LoadReader(ctx, "remote.lua", strings.NewReader(`server.port = 9090`)))
+	require.NoError(t, cfg.Get(ctx, "server", &server))
+	assert.Equal(t, 9090, server.Port)
+	assert.Equal(t, []string{"embedded.lua", "remote.lua"}, loaded)
+
+	// The name is used as the chunk name in errors
+	err := cfg.LoadBytes(ctx, "broken.lua", []byte("server = {\n  port = ,\n}"))
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrExecution))
+	assert.Contains(t, err.Error(), "broken.lua")
+
+	// The sandbox applies as it does to files
+	err = cfg.LoadBytes(ctx, "escape.lua", []byte(`io.open("/etc/passwd")`))
+	require.Error(t, err)
+}
+
+func TestTimeoutPerLoad(t *testing.T) {
+	cfg := New(WithTimeoutPerLoad(50 * time.Millisecond))
+	defer cfg.Close()
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.lua")
+	require.NoError(t, os.WriteFile(base, []byte(`name = "base"`), 0644))
+	require.NoError(t, cfg.LoadFile(context.Background(), base))
+
+	slow := filepath.Join(dir, "slow.lua")
+	require.NoError(t, os.WriteFile(slow, []byte(`
+		name = "partial"
+		server = { host = "localhost" }
+		while true do end
+	`), 0644))
+
+	err := cfg.LoadFile(context.Background(), slow)
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrTimeout))
+
+	// Nothing from the timed-out load survives
+	assert.Equal(t, lua.LNil, cfg.L.GetGlobal("server"))
+	var name string
+	require.NoError(t, cfg.GetGlobal("name", &name))
+	assert.Equal(t, "base", name)
+
+	// The state is still usable for later loads
+	fast := filepath.Join(dir, "fast.lua")
+	require.NoError(t, os.WriteFile(fast, []byte(`name = "fast"`), 0644))
+	require.NoError(t, cfg.LoadFile(context.Background(), fast))
+	require.NoError(t, cfg.GetGlobal("name", &name))
+	assert.Equal(t, "fast", name)
+}
+
+func TestListGlobals(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		app = { name = "test" }
+		port = 8080
+		function handler() end
+	`))
+	_, err := cfg.Eval("1 + 1")
+	require.NoError(t, err)
+
+	globals := cfg.ListGlobals()
+	assert.Equal(t, []string{"app", "handler", "port"}, globals)
+
+	for _, builtin := range []string{"_G", "string", "table", "math", "print", "__eval_result"} {
+		assert.NotContains(t, globals, builtin)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		config = {
+			name = "app",
+			empty = {},
+			removed = nil,
+			nested = {
+				keep = 1,
+				deep = { deeper = {} },
+			},
+			only_empty = { a = {}, b = { c = {} } },
+			list = { {}, "a", {}, "b" },
+		}
+		config.cleared = "temporary"
+		config.cleared = nil
+	`))
+
+	require.NoError(t, cfg.Prune("config"))
+
+	var result map[string]interface{}
+	require.NoError(t, cfg.GetGlobal("config", &result))
+	assert.Equal(t, map[string]interface{}{
+		"name":   "app",
+		"nested": map[string]interface{}{"keep": float64(1)},
+		"list":   []interface{}{"a", "b"},
+	}, result)
+
+	err := cfg.Prune("missing")
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+
+	require.NoError(t, cfg.DoString(`scalar = 1`))
+	err = cfg.Prune("scalar")
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+}
+
 func TestLoadDirectory(t *testing.T) {
 	// Create temporary directory with test files
 	dir := t.TempDir()
@@ -1123,6 +1808,133 @@ func TestLoadDirectory(t *testing.T) {
 	assert.Equal(t, 2, y)
 }
 
+func TestLoadDirectoryWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"20-base.lua":                "base",
+		"10-services/web.lua":        "services/web",
+		"10-services/db/primary.lua": "services/db/primary",
+		"10-services/db/replica.lua": "services/db/replica",
+		"10-services/a-first.lua":    "services/a-first",
+		"30-local.lua":               "local",
+		"30-local.lua.bak":           "backup",
+		"notes.txt":                  "notes",
+	}
+	for name, label := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		script := fmt.Sprintf("order = order or {}; table.insert(order, %q)", label)
+		require.NoError(t, os.WriteFile(path, []byte(script), 0644))
+	}
+
+	loadOrder := func(cfg *Config) []string {
+		v, err := cfg.Eval(`table.concat(order or {}, ",")`)
+		require.NoError(t, err)
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v.(string), ",")
+	}
+
+	// Subdirectories are loaded depth-first where their names sort
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.LoadDirectoryWithOptions(context.Background(), dir, LoadDirectoryOptions{Recursive: true}))
+	assert.Equal(t, []string{
+		"services/a-first",
+		"services/db/primary",
+		"services/db/replica",
+		"services/web",
+		"base",
+		"local",
+	}, loadOrder(cfg))
+
+	// Without Recursive, subdirectories are skipped
+	flat := New()
+	defer flat.Close()
+	require.NoError(t, flat.LoadDirectory(dir))
+	assert.Equal(t, []string{"base", "local"}, loadOrder(flat))
+
+	// A pattern filters files at every level
+	filtered := New()
+	defer filtered.Close()
+	require.NoError(t, filtered.LoadDirectoryWithOptions(context.Background(), dir, LoadDirectoryOptions{Recursive: true, Pattern: "[^0-9]*.lua"}))
+	assert.Equal(t, []string{"services/a-first", "services/db/primary", "services/db/replica", "services/web"}, loadOrder(filtered))
+
+	err := filtered.LoadDirectoryWithOptions(context.Background(), dir, LoadDirectoryOptions{Pattern: "[bad"})
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+
+	err = filtered.LoadDirectoryWithOptions(context.Background(), filepath.Join(dir, "missing"), LoadDirectoryOptions{})
+	assert.True(t, IsErrorCode(err, ErrIO))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadDirectoryUsesLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.lua"), []byte(`x = 1`), 0644))
+	escape := filepath.Join(t.TempDir(), "escape.txt")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.lua"), []byte(fmt.Sprintf(`io.open(%q, "w")`, escape)), 0644))
+
+	cfg := New(WithSandbox(&Sandbox{}))
+	defer cfg.Close()
+
+	var loaded []string
+	cfg.RegisterHook(BeforeLoad, func(ctx context.Context, event HookEvent) error {
+		loaded = append(loaded, filepath.Base(event.Name))
+		return nil
+	})
+
+	// Each file runs the load hooks and the sandbox
+	err := cfg.LoadDirectory(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b.lua")
+	assert.Equal(t, []string{"a.lua", "b.lua"}, loaded)
+
+	var x int
+	require.NoError(t, cfg.GetGlobal("x", &x))
+	assert.Equal(t, 1, x)
+	_, err = os.Stat(escape)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config/base.lua":     {Data: []byte(`server = { host = "localhost", port = 8080 }`)},
+		"config/override.lua": {Data: []byte(`server.port = 9090`)},
+		"config/README.md":    {Data: []byte(`not a lua file`)},
+		"defaults.lua":        {Data: []byte(`debug = false`)},
+		"broken.lua":          {Data: []byte(`server = {`)},
+	}
+
+	cfg := New()
+	defer cfg.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cfg.LoadFileFS(ctx, fsys, "defaults.lua"))
+	var debug bool
+	require.NoError(t, cfg.GetGlobal("debug", &debug))
+	assert.False(t, debug)
+
+	// Files load in name order, so the override wins
+	require.NoError(t, cfg.LoadDirectoryFS(ctx, fsys, "config"))
+	port, err := cfg.GetRaw("server.port")
+	require.NoError(t, err)
+	assert.Equal(t, "9090", port.String())
+
+	err = cfg.LoadFileFS(ctx, fsys, "missing.lua")
+	assert.True(t, IsErrorCode(err, ErrIO))
+	err = cfg.LoadFileFS(ctx, fsys, "broken.lua")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken.lua")
+	assert.Error(t, cfg.LoadDirectoryFS(ctx, fsys, "missing"))
+
+	// The context reaches every file in the directory
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = cfg.LoadDirectoryFS(canceled, fsys, "config")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestDoStringContext(t *testing.T) {
 	cfg := New()
 	defer cfg.Close()
@@ -1150,6 +1962,57 @@ func TestDoStringContext(t *testing.T) {
 	assert.Contains(t, err.Error(), "context canceled")
 }
 
+func TestDoStringWithEnv(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`app = { name = "main" }`))
+
+	results := cfg.L.NewTable()
+	err := cfg.DoStringWithEnv(`
+		leaked = true
+		app = "shadowed"
+		string.leaked = true
+		out.total = math.max(price * qty, 10)
+		out.label = string.upper(tostring(qty))
+		out.print = type(print)
+	`, map[string]lua.LValue{
+		"price": lua.LNumber(2.5),
+		"qty":   lua.LNumber(8),
+		"out":   results,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, lua.LNumber(20), results.RawGetString("total"))
+	assert.Equal(t, lua.LString("8"), results.RawGetString("label"))
+	assert.Equal(t, lua.LString("nil"), results.RawGetString("print"), "only whitelisted built-ins are visible")
+
+	// Nothing the snippet assigned leaks into the main state
+	assert.Equal(t, lua.LNil, cfg.L.GetGlobal("leaked"))
+	assert.Equal(t, lua.LNil, cfg.L.GetField(cfg.L.GetGlobal("string"), "leaked"))
+	name, err := cfg.GetRaw("app.name")
+	require.NoError(t, err)
+	assert.Equal(t, "main", name.String())
+
+	// Globals of the main state are not visible
+	err = cfg.DoStringWithEnv(`assert(app == nil, "app visible")`, nil)
+	assert.NoError(t, err)
+
+	// Built-ins come from the state as created, whatever the config reassigns
+	require.NoError(t, cfg.DoString(`type = "web"; string = "text"`))
+	err = cfg.DoStringWithEnv(`
+		local n = 0
+		for _, v in ipairs({ 1, 2 }) do n = n + v end
+		for _, v in pairs({ a = 3 }) do n = n + v end
+		out.kind = type(n) .. string.upper("!") .. n
+	`, map[string]lua.LValue{"out": results})
+	require.NoError(t, err)
+	assert.Equal(t, lua.LString("number!6"), results.RawGetString("kind"))
+
+	// So do those of the sandboxed environment used by loads
+	require.NoError(t, cfg.LoadBytes(context.Background(), "more.lua", []byte(`more = 1`)))
+}
+
 func TestDoFileContext(t *testing.T) {
 	cfg := New()
 	defer cfg.Close()
@@ -1183,3 +2046,739 @@ func TestDoFileContext(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "context canceled during file execution")
 }
+
+func TestPointerFieldsDistinguishAbsent(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		features = {
+			cache = false,
+			retries = 0,
+			prefix = "",
+			tls = { enabled = true },
+			removed = nil,
+		}
+	`))
+
+	type TLS struct {
+		Enabled bool `lua:"enabled"`
+	}
+	type Features struct {
+		Cache   *bool   `lua:"cache"`
+		Metrics *bool   `lua:"metrics"`
+		Removed *bool   `lua:"removed"`
+		Retries *int    `lua:"retries"`
+		Prefix  *string `lua:"prefix"`
+		TLS     *TLS    `lua:"tls"`
+		Proxy   *TLS    `lua:"proxy"`
+	}
+
+	var f Features
+	require.NoError(t, cfg.Get(context.Background(), "features", &f))
+
+	// Present zero values are set
+	require.NotNil(t, f.Cache)
+	assert.False(t, *f.Cache)
+	require.NotNil(t, f.Retries)
+	assert.Equal(t, 0, *f.Retries)
+	require.NotNil(t, f.Prefix)
+	assert.Equal(t, "", *f.Prefix)
+	require.NotNil(t, f.TLS)
+	assert.True(t, f.TLS.Enabled)
+
+	// Absent keys, and keys assigned nil, stay nil
+	assert.Nil(t, f.Metrics)
+	assert.Nil(t, f.Removed)
+	assert.Nil(t, f.Proxy)
+
+	// Pointer fields are still type checked
+	require.NoError(t, cfg.DoString(`features.cache = "no"`))
+	err := cfg.Get(context.Background(), "features", &f)
+	assert.True(t, IsErrorCode(err, ErrValidation))
+}
+
+func TestPointerFieldsNested(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		app = {
+			cache = { ttl = 60, backend = { host = "redis" } },
+			weights = { 1, 2 },
+			pools = { primary = { size = 10 } },
+			depth = 3,
+		}
+	`))
+
+	type Backend struct {
+		Host string `lua:"host"`
+		Port *int   `lua:"port"`
+	}
+	type Cache struct {
+		TTL     *int     `lua:"ttl"`
+		Backend *Backend `lua:"backend"`
+	}
+	type Pool struct {
+		Size *int `lua:"size"`
+	}
+	type App struct {
+		Cache   *Cache           `lua:"cache"`
+		Queue   *Cache           `lua:"queue"`
+		Weights []*int           `lua:"weights"`
+		Pools   map[string]*Pool `lua:"pools"`
+		Depth   **int            `lua:"depth"`
+	}
+
+	for name, get := range map[string]func(*App) error{
+		"Get":       func(a *App) error { return cfg.Get(context.Background(), "app", a) },
+		"GetInto":   func(a *App) error { return cfg.GetInto(context.Background(), "app", a, DecodeOptions{}) },
+		"GetGlobal": func(a *App) error { return cfg.GetGlobal("app", a) },
+	} {
+		var app App
+		require.NoError(t, get(&app), name)
+
+		require.NotNil(t, app.Cache, name)
+		require.NotNil(t, app.Cache.TTL, name)
+		assert.Equal(t, 60, *app.Cache.TTL, name)
+		require.NotNil(t, app.Cache.Backend, name)
+		assert.Equal(t, "redis", app.Cache.Backend.Host, name)
+		assert.Nil(t, app.Cache.Backend.Port, name)
+		assert.Nil(t, app.Queue, name)
+
+		require.Len(t, app.Weights, 2, name)
+		assert.Equal(t, 2, *app.Weights[1], name)
+		require.NotNil(t, app.Pools["primary"], name)
+		assert.Equal(t, 10, *app.Pools["primary"].Size, name)
+		require.NotNil(t, app.Depth, name)
+		assert.Equal(t, 3, **app.Depth, name)
+	}
+}
+
+func TestEqualGlobals(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		a = { name = "app", server = { host = "localhost", port = 8080 }, tags = { "x", "y" } }
+		b = { tags = { "x", "y" }, server = { port = 8080, host = "localhost" }, name = "app" }
+		c = { name = "app", server = { host = "localhost", port = 8080 }, tags = { "y", "x" } }
+	`))
+
+	equal, err := cfg.EqualGlobals("a", "b")
+	require.NoError(t, err)
+	assert.True(t, equal)
+
+	// Sequence order is significant
+	equal, err = cfg.EqualGlobals("a", "c")
+	require.NoError(t, err)
+	assert.False(t, equal)
+
+	_, err = cfg.EqualGlobals("a", "missing")
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+}
+
+func TestRegisterConstantTable(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.RegisterConstantTable("http", map[string]interface{}{
+		"OK":       200,
+		"NotFound": 404,
+		"Redirect": map[string]interface{}{"Found": 302},
+	}))
+
+	require.NoError(t, cfg.DoString(`
+		status = http.OK
+		found = http.Redirect.Found
+	`))
+	var status, found int
+	require.NoError(t, cfg.GetGlobal("status", &status))
+	require.NoError(t, cfg.GetGlobal("found", &found))
+	assert.Equal(t, 200, status)
+	assert.Equal(t, 302, found)
+
+	err := cfg.DoString(`http.OK = 201`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read-only constant http.OK")
+
+	err = cfg.DoString(`http.Redirect.Found = 303`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read-only constant http.Redirect.Found")
+
+	err = cfg.DoString(`setmetatable(http, nil)`)
+	assert.Error(t, err)
+
+	require.NoError(t, cfg.DoString(`status = http.OK`))
+	require.NoError(t, cfg.GetGlobal("status", &status))
+	assert.Equal(t, 200, status)
+
+	assert.Error(t, cfg.RegisterConstantTable("", nil))
+}
+
+func TestLuaTableToTimeMalformed(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	type Event struct {
+		At time.Time `lua:"at"`
+	}
+
+	// A missing time of day defaults to zero
+	require.NoError(t, cfg.DoString(`event = { at = { year = 2024, month = 3, day = 9, hour = 14, min = 30 } }`))
+	var ev Event
+	require.NoError(t, cfg.GetGlobal("event", &ev))
+	assert.Equal(t, time.Date(2024, time.March, 9, 14, 30, 0, 0, time.UTC), ev.At)
+
+	// Non-numeric components are conversion errors rather than panics
+	require.NoError(t, cfg.DoString(`event = { at = { year = "2024", month = 3, day = 9 } }`))
+	err := cfg.GetGlobal("event", &ev)
+	assert.True(t, IsErrorCode(err, ErrConversion), "got %v", err)
+	assert.Contains(t, err.Error(), "year")
+
+	require.NoError(t, cfg.DoString(`event = { at = { month = 3, day = 9 } }`))
+	err = cfg.GetGlobal("event", &ev)
+	assert.True(t, IsErrorCode(err, ErrConversion), "got %v", err)
+}
+
+func TestLuaTableToTimeZone(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	type Event struct {
+		At time.Time `lua:"at"`
+	}
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		zone   string
+		want   time.Time
+		offset int
+	}{
+		{"default is UTC", ``, time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC), 0},
+		{"IANA name", `tz = "Europe/Paris"`, time.Date(2024, time.July, 1, 12, 0, 0, 0, paris), 2 * 3600},
+		{"offset string", `tz = "+05:30"`, time.Date(2024, time.July, 1, 6, 30, 0, 0, time.UTC), 5*3600 + 30*60},
+		{"offset seconds", `offset = -3600`, time.Date(2024, time.July, 1, 13, 0, 0, 0, time.UTC), -3600},
+		{"explicit utc", `utc = true`, time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, cfg.DoString(`event = { at = { year = 2024, month = 7, day = 1, hour = 12, `+tt.zone+` } }`))
+			var ev Event
+			require.NoError(t, cfg.GetGlobal("event", &ev))
+			assert.True(t, tt.want.Equal(ev.At), "want %v, got %v", tt.want, ev.At)
+			_, offset := ev.At.Zone()
+			assert.Equal(t, tt.offset, offset)
+		})
+	}
+
+	for _, zone := range []string{`tz = "Mars/Olympus"`, `tz = "+25:00"`, `tz = 5`, `tz = "UTC", utc = true`} {
+		require.NoError(t, cfg.DoString(`event = { at = { year = 2024, month = 7, day = 1, `+zone+` } }`))
+		var ev Event
+		err := cfg.GetGlobal("event", &ev)
+		assert.True(t, IsErrorCode(err, ErrConversion), "%s: got %v", zone, err)
+	}
+}
+
+func TestTimeFromStringsAndNumbers(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	type Event struct {
+		At time.Time `lua:"at"`
+	}
+	get := func(at string) (time.Time, error) {
+		require.NoError(t, cfg.DoString(`event = { at = `+at+` }`))
+		var ev Event
+		err := cfg.Get(context.Background(), "event", &ev)
+		return ev.At, err
+	}
+
+	at, err := get(`"2024-03-09T14:30:00+01:00"`)
+	require.NoError(t, err)
+	assert.True(t, at.Equal(time.Date(2024, time.March, 9, 13, 30, 0, 0, time.UTC)), "got %v", at)
+
+	at, err = get(`"2024-03-09T14:30:00.25Z"`)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.March, 9, 14, 30, 0, 250e6, time.UTC), at)
+
+	// Numbers are Unix timestamps in seconds
+	at, err = get(`1710000000.5`)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1710000000, 500e6).UTC(), at)
+
+	// A partial table defaults the time of day
+	at, err = get(`{ year = 2024, month = 3, day = 9 }`)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.March, 9, 0, 0, 0, 0, time.UTC), at)
+
+	for _, malformed := range []string{`"09/03/2024"`, `"2024-03-09"`, `{ year = 2024, day = 9 }`, `{ year = 2024, month = "March", day = 9 }`} {
+		_, err = get(malformed)
+		assert.Error(t, err, malformed)
+	}
+
+	require.NoError(t, cfg.DoString(`event = { at = "yesterday" }`))
+	err = cfg.GetGlobal("event", &Event{})
+	assert.True(t, IsErrorCode(err, ErrConversion), "got %v", err)
+	assert.Contains(t, err.Error(), `invalid RFC 3339 time "yesterday"`)
+}
+
+func TestIntegerWidths(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	type Widths struct {
+		Int    int      `lua:"int"`
+		Int8   int8     `lua:"int8"`
+		Int16  int16    `lua:"int16"`
+		Int32  int32    `lua:"int32"`
+		Int64  int64    `lua:"int64"`
+		Uint   uint     `lua:"uint"`
+		Uint8  uint8    `lua:"uint8"`
+		Uint16 uint16   `lua:"uint16"`
+		Uint32 uint32   `lua:"uint32"`
+		Uint64 uint64   `lua:"uint64"`
+		Ports  []uint16 `lua:"ports"`
+	}
+
+	require.NoError(t, cfg.DoString(`widths = {
+		int = -1, int8 = -128, int16 = 32767, int32 = -2147483648, int64 = 9007199254740992,
+		uint = 1, uint8 = 255, uint16 = 65535, uint32 = 4294967295, uint64 = 9007199254740992,
+		ports = { 80, 443 },
+	}`))
+
+	var w Widths
+	require.NoError(t, cfg.Get(context.Background(), "widths", &w))
+	assert.Equal(t, Widths{
+		Int: -1, Int8: -128, Int16: 32767, Int32: -2147483648, Int64: 1 << 53,
+		Uint: 1, Uint8: 255, Uint16: 65535, Uint32: 4294967295, Uint64: 1 << 53,
+		Ports: []uint16{80, 443},
+	}, w)
+
+	for field, value := range map[string]string{
+		"uint":   "-1",
+		"uint8":  "256",
+		"int8":   "128",
+		"int16":  "-32769",
+		"uint32": "4294967296",
+		"int64":  "0/0",
+	} {
+		require.NoError(t, cfg.DoString(fmt.Sprintf(`widths.%s = %s`, field, value)))
+		err := cfg.Get(context.Background(), "widths", &Widths{})
+		assert.Error(t, err, "%s = %s", field, value)
+		require.NoError(t, cfg.DoString(fmt.Sprintf(`widths.%s = 1`, field)))
+	}
+}
+
+func TestDurationFields(t *testing.T) {
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+
+	type Server struct {
+		ReadTimeout  time.Duration  `lua:"read_timeout" validate:"min=1s,max=1m"`
+		IdleTimeout  time.Duration  `lua:"idle_timeout"`
+		ShutdownWait *time.Duration `lua:"shutdown_wait"`
+	}
+
+	// Strings are parsed with time.ParseDuration, numbers are nanoseconds
+	require.NoError(t, cfg.DoString(`server = { read_timeout = "30s", idle_timeout = 2e9, shutdown_wait = " 1m30s " }`))
+	var s Server
+	require.NoError(t, cfg.Get(context.Background(), "server", &s))
+	assert.Equal(t, 30*time.Second, s.ReadTimeout)
+	assert.Equal(t, 2*time.Second, s.IdleTimeout)
+	require.NotNil(t, s.ShutdownWait)
+	assert.Equal(t, 90*time.Second, *s.ShutdownWait)
+
+	// Validation bounds apply to parsed strings
+	require.NoError(t, cfg.DoString(`server.read_timeout = "2m"`))
+	err := cfg.Get(context.Background(), "server", &s)
+	assert.True(t, IsErrorCode(err, ErrValidation))
+
+	require.NoError(t, cfg.DoString(`server.read_timeout = "thirty seconds"`))
+	err = cfg.Get(context.Background(), "server", &s)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid duration "thirty seconds"`)
+}
+
+func TestGetAllAndSet(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`
+		name = "svc"
+		database = { host = "db", password = "hunter2", replicas = { "a", "b" } }
+		function helper() end
+	`))
+
+	require.NoError(t, cfg.Set("database.password", "****"))
+	require.NoError(t, cfg.Set("cache.redis.port", 6379))
+	require.NoError(t, cfg.Set("verbose", true))
+
+	all := cfg.GetAll()
+	assert.Equal(t, map[string]interface{}{
+		"name":              "svc",
+		"verbose":           true,
+		"database.host":     "db",
+		"database.password": "****",
+		"database.replicas": []interface{}{"a", "b"},
+		"cache.redis.port":  float64(6379),
+	}, all)
+
+	password, err := cfg.GetRaw("database.password")
+	require.NoError(t, err)
+	assert.Equal(t, lua.LString("****"), password)
+
+	// Paths through non-tables and read-only tables are rejected
+	err = cfg.Set("name.first", "x")
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+	assert.Error(t, cfg.Set("", 1))
+
+	require.NoError(t, cfg.RegisterConstantTable("limits", map[string]interface{}{"max": 10}))
+	assert.Error(t, cfg.Set("limits.max", 20))
+}
+
+func TestSandboxMaxExecutionTime(t *testing.T) {
+	cfg := New(WithSandbox(&Sandbox{MaxExecutionTime: 100 * time.Millisecond}))
+	defer cfg.Close()
+
+	start := time.Now()
+	err := cfg.DoString(`while true do end`)
+	assert.True(t, IsErrorCode(err, ErrTimeout), "got %v", err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	path := filepath.Join(t.TempDir(), "loop.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`partial = true
+while true do end`), 0644))
+
+	start = time.Now()
+	err = cfg.LoadFile(context.Background(), path)
+	assert.True(t, IsErrorCode(err, ErrTimeout), "got %v", err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, lua.LNil, cfg.L.GetGlobal("partial"))
+
+	// A context deadline shortens the limit for a single load
+	long := New(WithSandbox(&Sandbox{MaxExecutionTime: time.Hour}))
+	defer long.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = long.LoadFile(ctx, path)
+	assert.True(t, IsErrorCode(err, ErrTimeout), "got %v", err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// The state is usable again afterwards
+	require.NoError(t, cfg.DoString(`x = 1`))
+}
+
+func TestContextCancellation(t *testing.T) {
+	type ctxKey struct{}
+
+	cfg := New()
+	defer cfg.Close()
+
+	// Registered functions see the context of the running load
+	var seen interface{}
+	require.NoError(t, cfg.RegisterFunction(context.Background(), "capture", func(ctx context.Context) {
+		seen = ctx.Value(ctxKey{})
+	}))
+
+	path := filepath.Join(t.TempDir(), "capture.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`capture()`), 0644))
+	require.NoError(t, cfg.LoadFile(context.WithValue(context.Background(), ctxKey{}, "load-1"), path))
+	assert.Equal(t, "load-1", seen)
+
+	cancelSoon := func() context.Context {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		return ctx
+	}
+
+	loopPath := filepath.Join(t.TempDir(), "loop.lua")
+	require.NoError(t, os.WriteFile(loopPath, []byte(`while true do end`), 0644))
+	err := cfg.LoadFile(cancelSoon(), loopPath)
+	assert.True(t, IsErrorCode(err, ErrCanceled), "LoadFile: got %v", err)
+
+	require.NoError(t, cfg.DoString(`function spin() while true do end end`))
+	_, err = cfg.CallContext(cancelSoon(), "spin")
+	assert.True(t, IsErrorCode(err, ErrCanceled), "CallContext: got %v", err)
+
+	err = cfg.DoStringContext(cancelSoon(), `while true do end`)
+	assert.True(t, IsErrorCode(err, ErrCanceled), "DoStringContext: got %v", err)
+
+	// The state keeps working once the context is released
+	results, err := cfg.Call("tostring", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"1"}, results)
+
+	// Ordinary script errors are not reported as cancellations
+	err = cfg.DoString(`error("boom")`)
+	assert.False(t, IsErrorCode(err, ErrCanceled), "DoString: got %v", err)
+	_, err = cfg.Call("error", "boom")
+	assert.False(t, IsErrorCode(err, ErrCanceled), "Call: got %v", err)
+}
+
+func TestGetWithFallbackChain(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	cfg := New(WithLogger(zap.New(core)))
+	defer cfg.Close()
+
+	type Server struct {
+		Port int `lua:"port"`
+	}
+
+	// Only the old name is defined
+	require.NoError(t, cfg.DoString(`server = { port = 8080 }`))
+	var s Server
+	require.NoError(t, cfg.GetWithFallbackChain(context.Background(), &s, "http_server", "server"))
+	assert.Equal(t, 8080, s.Port)
+
+	entries := logs.FilterMessage("configuration uses a deprecated name").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "server", entries[0].ContextMap()["name"])
+	assert.Equal(t, "http_server", entries[0].ContextMap()["preferred"])
+
+	// The new name wins without a warning
+	require.NoError(t, cfg.DoString(`http_server = { port = 9090 }`))
+	require.NoError(t, cfg.GetWithFallbackChain(context.Background(), &s, "http_server", "server"))
+	assert.Equal(t, 9090, s.Port)
+	assert.Equal(t, 1, logs.Len())
+
+	err := cfg.GetWithFallbackChain(context.Background(), &s, "missing", "also_missing")
+	assert.True(t, IsErrorCode(err, ErrNotFound))
+	assert.Error(t, cfg.GetWithFallbackChain(context.Background(), &s))
+}
+
+func TestGetTopLevelCollections(t *testing.T) {
+	type ServerConfig struct {
+		Host string `lua:"host" validate:"required"`
+		Port int    `lua:"port"`
+	}
+
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cfg.DoString(`
+		servers = {
+			{ host = "a.internal", port = 8080 },
+			{ host = "b.internal", port = 8081 },
+		}
+		regions = {
+			eu = { host = "eu.internal", port = 443 },
+		}
+		broken = { { port = 1 } }
+	`))
+
+	var servers []ServerConfig
+	require.NoError(t, cfg.Get(ctx, "servers", &servers))
+	assert.Equal(t, []ServerConfig{
+		{Host: "a.internal", Port: 8080},
+		{Host: "b.internal", Port: 8081},
+	}, servers)
+
+	var regions map[string]ServerConfig
+	require.NoError(t, cfg.Get(ctx, "regions", &regions))
+	assert.Equal(t, map[string]ServerConfig{"eu": {Host: "eu.internal", Port: 443}}, regions)
+
+	// Elements are validated with their index in the path
+	err := cfg.Get(ctx, "broken", &servers)
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrValidation))
+	assert.Contains(t, err.Error(), "0.host")
+
+	var port int
+	assert.Error(t, cfg.Get(ctx, "servers", &port))
+}
+
+func TestGetInterfaceTarget(t *testing.T) {
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cfg.DoString(`
+		config = {
+			name = "api",
+			port = 8080,
+			tags = { "a", "b" },
+			tls = { enabled = true },
+		}
+		version = "1.2.0"
+	`))
+
+	var v interface{}
+	require.NoError(t, cfg.Get(ctx, "config", &v))
+	require.IsType(t, map[string]interface{}{}, v)
+	assert.Equal(t, map[string]interface{}{
+		"name": "api",
+		"port": float64(8080),
+		"tags": []interface{}{"a", "b"},
+		"tls":  map[string]interface{}{"enabled": true},
+	}, v)
+
+	require.NoError(t, cfg.Get(ctx, "version", &v))
+	assert.Equal(t, "1.2.0", v)
+}
+
+func TestSandboxScopedToLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`
+		loads = (loads or 0) + 1
+		io_during_load = io ~= nil
+		dofile_during_load = dofile ~= nil
+	`), 0644))
+
+	cfg := New(WithSandbox(&Sandbox{MaxExecutionTime: time.Second}))
+	defer cfg.Close()
+
+	require.NoError(t, cfg.LoadFile(context.Background(), path))
+
+	var ioDuringLoad, dofileDuringLoad bool
+	require.NoError(t, cfg.GetGlobal("io_during_load", &ioDuringLoad))
+	require.NoError(t, cfg.GetGlobal("dofile_during_load", &dofileDuringLoad))
+	assert.False(t, ioDuringLoad)
+	assert.False(t, dofileDuringLoad)
+
+	// The real globals are back once the load finishes
+	result, err := cfg.Eval(`type(io) .. " " .. type(dofile) .. " " .. tostring(_G == _G._G)`)
+	require.NoError(t, err)
+	assert.Equal(t, "table function true", result)
+
+	// A second sandboxed load on the same Config behaves like the first
+	require.NoError(t, cfg.LoadFile(context.Background(), path))
+	var loads int
+	require.NoError(t, cfg.GetGlobal("loads", &loads))
+	assert.Equal(t, 2, loads)
+	require.NoError(t, cfg.GetGlobal("io_during_load", &ioDuringLoad))
+	assert.False(t, ioDuringLoad)
+
+	// Other configs are unaffected
+	other := New()
+	defer other.Close()
+	now, err := other.Eval(`os.time()`)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(time.Now().Unix()), now, 5)
+
+	now, err = cfg.Eval(`os.time()`)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(time.Now().Unix()), now, 5)
+}
+
+func TestSandboxEscapeRoutes(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "pwned")
+	keep := filepath.Join(dir, "keep")
+	require.NoError(t, os.WriteFile(keep, []byte("keep"), 0644))
+
+	routes := map[string]string{
+		"os":              `os.execute("touch ` + marker + `")`,
+		"os.remove":       `os.remove("` + keep + `")`,
+		"require":         `require("os").execute("touch ` + marker + `")`,
+		"package.loaded":  `package.loaded.io.open("` + marker + `", "w"):close()`,
+		"loaded os":       `package.loaded.os.execute("touch ` + marker + `")`,
+		"package.preload": `package.preload.io().open("` + marker + `", "w"):close()`,
+	}
+	for name, script := range routes {
+		t.Run(name, func(t *testing.T) {
+			cfg := New(WithSandbox(&Sandbox{}))
+			defer cfg.Close()
+			io := cfg.L.GetGlobal("io")
+			cfg.L.PreloadModule("io", func(L *lua.LState) int {
+				L.Push(io)
+				return 1
+			})
+
+			assert.Error(t, cfg.LoadBytes(context.Background(), "escape.lua", []byte(script)))
+			assert.NoFileExists(t, marker)
+			assert.FileExists(t, keep)
+
+			// The libraries are back once the load finishes
+			result, err := cfg.Eval(`type(os.execute) .. " " .. type(require("os").remove) .. " " .. type(package.loaded.io.open) .. " " .. type(package.preload.io)`)
+			require.NoError(t, err)
+			assert.Equal(t, "function function function function", result)
+		})
+	}
+}
+
+func TestSetSandbox(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "hosts.txt")
+	require.NoError(t, os.WriteFile(data, []byte("db.internal"), 0644))
+
+	trusted := filepath.Join(dir, "base.lua")
+	require.NoError(t, os.WriteFile(trusted, []byte(`
+		local f = assert(io.open(HOSTS))
+		db_host = f:read("*a")
+		f:close()
+	`), 0644))
+	untrusted := filepath.Join(dir, "override.lua")
+	require.NoError(t, os.WriteFile(untrusted, []byte(`
+		local f = assert(io.open(HOSTS))
+		db_host = f:read("*a") .. ".attacker"
+	`), 0644))
+
+	cfg := New(WithSandbox(&Sandbox{EnableFileIO: true}))
+	defer cfg.Close()
+	require.NoError(t, cfg.SetGlobal("HOSTS", data))
+	require.NoError(t, cfg.LoadFile(context.Background(), trusted))
+
+	require.NoError(t, cfg.SetSandbox(&Sandbox{MaxExecutionTime: time.Second}))
+	err := cfg.LoadFile(context.Background(), untrusted)
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrExecution))
+
+	// Globals from the trusted load are kept
+	var host string
+	require.NoError(t, cfg.GetGlobal("db_host", &host))
+	assert.Equal(t, "db.internal", host)
+
+	assert.True(t, IsErrorCode(cfg.SetSandbox(nil), ErrSandbox))
+	assert.True(t, IsErrorCode(cfg.SetSandbox(&Sandbox{MaxMemory: 1024}), ErrSandbox))
+}
+
+func TestStrictRegistration(t *testing.T) {
+	ctx := context.Background()
+	double := func(x int) int { return x * 2 }
+
+	cfg := New(WithStrictRegistration(true))
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(`math_utils = { pi = 3.14 }; helper = "config value"`))
+
+	err := cfg.RegisterFunction(ctx, "helper", double)
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+	assert.Contains(t, err.Error(), "'helper' is already defined")
+
+	assert.Error(t, cfg.RegisterFunctionTable(ctx, "math_utils", map[string]interface{}{"double": double}))
+	assert.Error(t, cfg.RegisterSimpleFunc("helper", func(args []interface{}) ([]interface{}, error) { return nil, nil }))
+	assert.Error(t, cfg.RegisterLuaFunctionWithOptions("log", func(L *lua.LState) int { return 0 }, FunctionOptions{
+		Aliases: []string{"helper"},
+	}))
+	assert.Error(t, cfg.RegisterLuaFunctionWithOptions("pi", func(L *lua.LState) int { return 0 }, FunctionOptions{
+		Namespace: "math_utils",
+	}))
+
+	// The existing values are untouched
+	v, err := cfg.Eval("helper")
+	require.NoError(t, err)
+	assert.Equal(t, "config value", v)
+	assert.NotContains(t, cfg.ListGlobals(), "log")
+
+	// New names still register, and ReplaceFunction still overwrites
+	require.NoError(t, cfg.RegisterFunction(ctx, "double", double))
+	require.NoError(t, cfg.ReplaceFunction("double", func(x int) int { return x * 3 }))
+	assert.Error(t, cfg.RegisterFunction(ctx, "double", double))
+
+	// Without the option a collision replaces the global
+	loose := New()
+	defer loose.Close()
+	require.NoError(t, loose.DoString(`helper = "config value"`))
+	require.NoError(t, loose.RegisterFunction(ctx, "helper", double))
+	result, err := loose.Call("helper", 21)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{float64(42)}, result)
+}
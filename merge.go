@@ -0,0 +1,148 @@
+package lugo
+
+import (
+	"context"
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ArrayMergeMode controls how MergeTable combines two arrays
+type ArrayMergeMode int
+
+const (
+	// ArrayReplace replaces the base array with the override array
+	ArrayReplace ArrayMergeMode = iota
+	// ArrayAppend appends the elements of the override array to the base array
+	ArrayAppend
+)
+
+// MergeOptions configures Merge and MergeTable
+type MergeOptions struct {
+	// Arrays controls how an array in the override combines with an array
+	// at the same key in the base. It defaults to ArrayReplace.
+	Arrays ArrayMergeMode
+}
+
+// Merge deep-merges the table at the dotted path src into the table at the
+// dotted path dst, so defaults, environment and local overrides can be
+// layered from Go, e.g. Merge(ctx, "config", "overrides.local"). See
+// MergeTable for the rules.
+func (c *Config) Merge(ctx context.Context, dst, src string) error {
+	return c.MergeWithOptions(ctx, dst, src, MergeOptions{})
+}
+
+// MergeWithOptions merges like Merge with the given options
+func (c *Config) MergeWithOptions(ctx context.Context, dst, src string, opts MergeOptions) error {
+	if err := contextError(ctx, "merge", ctx.Err()); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.changed()
+
+	tables := make([]*lua.LTable, 2)
+	for i, path := range []string{dst, src} {
+		lv := c.lookupPath(path)
+		if lv == lua.LNil {
+			return &Error{
+				Code:    ErrNotFound,
+				Message: fmt.Sprintf("configuration '%s' not found", path),
+			}
+		}
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("configuration '%s' is not a table", path),
+			}
+		}
+		tables[i] = table
+	}
+
+	return c.MergeTable(tables[0], tables[1], opts)
+}
+
+// MergeTable recursively merges override into base. Scalars and functions in
+// override replace those in base, tables present in both are merged key by
+// key, and arrays present in both are combined as opts.Arrays says. Tables
+// copied from override are copied deeply, so later changes to override do
+// not show through base. A cyclic override is an error.
+func (c *Config) MergeTable(base, override *lua.LTable, opts MergeOptions) error {
+	return c.mergeTable(base, override, opts, "", make(map[*lua.LTable]bool))
+}
+
+// mergeTable merges override into base. path names the table being merged
+// for errors, and onPath holds the override tables being walked.
+func (c *Config) mergeTable(base, override *lua.LTable, opts MergeOptions, path string, onPath map[*lua.LTable]bool) error {
+	if onPath[override] {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("cannot merge cyclic table at '%s'", path),
+		}
+	}
+	onPath[override] = true
+	defer delete(onPath, override)
+
+	if opts.Arrays == ArrayAppend && isArrayTable(base) && isArrayTable(override) {
+		n := override.Len()
+		for i := 1; i <= n; i++ {
+			lv, err := c.copyValue(override.RawGetInt(i), path, onPath)
+			if err != nil {
+				return err
+			}
+			base.Append(lv)
+		}
+		return nil
+	}
+
+	var err error
+	c.forEachKey(override, func(k, v lua.LValue) {
+		if err != nil {
+			return
+		}
+		keyPath := k.String()
+		if path != "" {
+			keyPath = path + "." + keyPath
+		}
+
+		src, isTable := v.(*lua.LTable)
+		dst, baseIsTable := base.RawGet(k).(*lua.LTable)
+		if isTable && baseIsTable && !(isArrayTable(src) && isArrayTable(dst) && opts.Arrays == ArrayReplace) {
+			err = c.mergeTable(dst, src, opts, keyPath, onPath)
+			return
+		}
+
+		var lv lua.LValue
+		if lv, err = c.copyValue(v, keyPath, onPath); err == nil {
+			base.RawSet(k, lv)
+		}
+	})
+	return err
+}
+
+// copyValue returns lv, with tables copied deeply
+func (c *Config) copyValue(lv lua.LValue, path string, onPath map[*lua.LTable]bool) (lua.LValue, error) {
+	table, ok := lv.(*lua.LTable)
+	if !ok {
+		return lv, nil
+	}
+	copied := c.L.NewTable()
+	if err := c.mergeTable(copied, table, MergeOptions{}, path, onPath); err != nil {
+		return nil, err
+	}
+	copied.Metatable = table.Metatable
+	return copied, nil
+}
+
+// isArrayTable reports whether t is a non-empty sequence with no other keys
+func isArrayTable(t *lua.LTable) bool {
+	n := t.Len()
+	if n == 0 {
+		return false
+	}
+	count := 0
+	t.ForEach(func(_, _ lua.LValue) { count++ })
+	return count == n
+}
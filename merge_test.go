@@ -0,0 +1,61 @@
+package lugo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(`
+		config = {
+			debug = false,
+			server = { host = "localhost", port = 8080, tls = { enabled = false } },
+			hosts = { "a", "b" },
+		}
+		production = {
+			debug = true,
+			server = { port = 443, tls = { enabled = true, cert = "/etc/cert.pem" } },
+			hosts = { "c" },
+		}
+	`))
+
+	require.NoError(t, cfg.Merge(ctx, "config", "production"))
+
+	// Scalars are overridden and nested tables merged
+	flat, err := cfg.Flatten("config")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"debug":              true,
+		"server.host":        "localhost",
+		"server.port":        float64(443),
+		"server.tls.enabled": true,
+		"server.tls.cert":    "/etc/cert.pem",
+		"hosts.0":            "c",
+	}, flat)
+
+	// Merged tables are copies
+	require.NoError(t, cfg.DoString(`production.server.tls.cert = "changed"`))
+	v, err := cfg.Eval("config.server.tls.cert")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/cert.pem", v)
+
+	// Arrays can be appended instead of replaced
+	require.NoError(t, cfg.DoString(`extra = { hosts = { "d", "e" } }`))
+	require.NoError(t, cfg.MergeWithOptions(ctx, "config", "extra", MergeOptions{Arrays: ArrayAppend}))
+	v, err = cfg.Eval(`table.concat(config.hosts, ",")`)
+	require.NoError(t, err)
+	assert.Equal(t, "c,d,e", v)
+
+	assert.True(t, IsErrorCode(cfg.Merge(ctx, "config", "missing"), ErrNotFound))
+	assert.True(t, IsErrorCode(cfg.Merge(ctx, "config.debug", "production"), ErrInvalidType))
+
+	require.NoError(t, cfg.DoString(`cyclic = {}; cyclic.self = cyclic`))
+	assert.Error(t, cfg.Merge(ctx, "config", "cyclic"))
+}
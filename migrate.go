@@ -0,0 +1,139 @@
+package lugo
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
+)
+
+// MigrationFunc transforms a value moved by a migration. It receives the old
+// value converted with the same rules as Call results and returns the value
+// to store at the new path.
+type MigrationFunc func(value interface{}) (interface{}, error)
+
+// migration moves the value at one dotted path to another
+type migration struct {
+	from string
+	to   string
+	fn   MigrationFunc
+}
+
+// RegisterMigration moves the value at the dotted path from to the dotted
+// path to after every LoadFile, so files written for an older schema keep
+// working, e.g. RegisterMigration("db.url", "database.connection_string").
+// Tables left empty by the move are removed. If the file already sets the
+// new path, its value is kept and the old one is dropped. Migrations run in
+// the order they were registered, before the AfterLoad hooks.
+func (c *Config) RegisterMigration(from, to string) error {
+	return c.RegisterMigrationFunc(from, to, nil)
+}
+
+// RegisterMigrationFunc registers a migration like RegisterMigration that
+// passes the value through fn on its way to the new path
+func (c *Config) RegisterMigrationFunc(from, to string, fn MigrationFunc) error {
+	for _, path := range []string{from, to} {
+		if _, err := splitPath(path); err != nil {
+			return err
+		}
+	}
+	if from == to {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("migration from '%s' to itself", from),
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.migrations = append(c.migrations, migration{from: from, to: to, fn: fn})
+	return nil
+}
+
+// runMigrations applies the registered migrations in order
+func (c *Config) runMigrations() error {
+	c.mu.RLock()
+	migrations := c.migrations
+	c.mu.RUnlock()
+
+	for _, m := range migrations {
+		if err := c.migrate(m); err != nil {
+			return &Error{
+				Code:    ErrExecution,
+				Message: fmt.Sprintf("failed to migrate '%s' to '%s'", m.from, m.to),
+				Cause:   err,
+			}
+		}
+	}
+	return nil
+}
+
+// migrate applies a single migration if its old path is set
+func (c *Config) migrate(m migration) error {
+	c.mu.RLock()
+	lv := c.lookupPath(m.from)
+	existing := c.lookupPath(m.to)
+	c.mu.RUnlock()
+
+	if lv == lua.LNil {
+		return nil
+	}
+
+	c.logger.Warn("configuration uses a deprecated name",
+		zap.String("name", m.from),
+		zap.String("preferred", m.to))
+
+	if existing == lua.LNil {
+		if m.fn != nil {
+			value, err := c.luaToGo(lv, interfaceType)
+			if err != nil {
+				return err
+			}
+			migrated, err := m.fn(value)
+			if err != nil {
+				return err
+			}
+			if lv, err = c.goToLua(migrated); err != nil {
+				return err
+			}
+		}
+		if err := c.setPath(strings.Split(m.to, "."), lv); err != nil {
+			return err
+		}
+	}
+
+	return c.removePath(strings.Split(m.from, "."))
+}
+
+// removePath clears the value at the path given by parts, then removes any
+// parent tables left empty
+func (c *Config) removePath(parts []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.changed()
+
+	tables := []lua.LValue{c.L.G.Global}
+	for _, part := range parts[:len(parts)-1] {
+		tables = append(tables, c.L.GetField(tables[len(tables)-1], part))
+	}
+
+	for i := len(parts) - 1; i >= 0; i-- {
+		if err := c.setField(tables[i], parts[i], lua.LNil); err != nil {
+			return err
+		}
+		if i == 0 {
+			break
+		}
+		if parent, ok := tables[i].(*lua.LTable); !ok || !isEmptyTable(parent) {
+			break
+		}
+	}
+	return nil
+}
+
+// isEmptyTable reports whether t has no keys
+func isEmptyTable(t *lua.LTable) bool {
+	key, _ := t.Next(lua.LNil)
+	return key == lua.LNil
+}
@@ -0,0 +1,60 @@
+package lugo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.RegisterMigration("db.url", "database.connection_string"))
+	require.NoError(t, cfg.RegisterMigrationFunc("db.timeout_ms", "database.timeout", func(v interface{}) (interface{}, error) {
+		ms, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %T", v)
+		}
+		return fmt.Sprintf("%gms", ms), nil
+	}))
+	require.NoError(t, cfg.RegisterMigration("log_level", "logging.level"))
+
+	assert.True(t, IsErrorCode(cfg.RegisterMigration("db..url", "database.url"), ErrInvalidType))
+	assert.True(t, IsErrorCode(cfg.RegisterMigration("db.url", "db.url"), ErrInvalidType))
+
+	// An old-format config
+	path := filepath.Join(t.TempDir(), "old.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`
+		db = { url = "postgres://localhost/app", timeout_ms = 250 }
+		log_level = "debug"
+		logging = { level = "info" }
+	`), 0644))
+	require.NoError(t, cfg.LoadFile(context.Background(), path))
+
+	type Database struct {
+		ConnectionString string `lua:"connection_string"`
+		Timeout          string `lua:"timeout"`
+	}
+	var db Database
+	require.NoError(t, cfg.Get(context.Background(), "database", &db))
+	assert.Equal(t, Database{ConnectionString: "postgres://localhost/app", Timeout: "250ms"}, db)
+
+	// Emptied tables are removed, and a value already at the new path wins
+	assert.NotContains(t, cfg.ListGlobals(), "db")
+	assert.NotContains(t, cfg.ListGlobals(), "log_level")
+	level, err := cfg.GetRaw("logging.level")
+	require.NoError(t, err)
+	assert.Equal(t, "info", level.String())
+
+	// Transform errors fail the load
+	require.NoError(t, os.WriteFile(path, []byte(`database = nil; db = { timeout_ms = "soon" }`), 0644))
+	err = cfg.LoadFile(context.Background(), path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to migrate 'db.timeout_ms' to 'database.timeout'")
+}
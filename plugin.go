@@ -10,8 +10,13 @@ import (
 	"sync"
 
 	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
 )
 
+// interfaceType is the reflect type of interface{}, used to decode Lua
+// values without a more specific target
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
 // PluginAPI represents the interface that plugins can use to interact with the host application
 type PluginAPI interface {
 	// RegisterFunction registers a function that can be called from Lua
@@ -22,8 +27,20 @@ type PluginAPI interface {
 	GetConfig() *Config
 	// EmitEvent emits an event that other plugins can listen to
 	EmitEvent(name string, data interface{}) error
+	// CallPlugin calls a function exported by another loaded plugin
+	CallPlugin(name, fn string, args ...interface{}) (interface{}, error)
+	// SetState stores a value in the plugin state store under namespace
+	SetState(namespace, key string, value interface{}) error
+	// GetState reads a value from the plugin state store
+	GetState(namespace, key string) (interface{}, bool)
+	// HTTP returns the allowlisted HTTP client available to plugins
+	HTTP() *PluginHTTPClient
 }
 
+// SharedStateNamespace is the state store namespace visible to every plugin.
+// Other namespaces are private to the plugin with the same name.
+const SharedStateNamespace = "_shared"
+
 // PluginManager handles plugin loading and lifecycle
 type PluginManager struct {
 	cfg           *Config
@@ -32,6 +49,17 @@ type PluginManager struct {
 	mu            sync.RWMutex
 	sandbox       *Sandbox
 	api           PluginAPI
+	logger        *zap.Logger
+	closeOnce     sync.Once
+	running       map[*lua.LState]int
+	retired       map[*lua.LState]bool
+	state         map[string]map[string]interface{}
+	stateMu       sync.RWMutex
+	http          *PluginHTTPClient
+
+	onLoaded   []PluginCallback
+	onUnloaded []PluginCallback
+	onError    []PluginErrorCallback
 }
 
 // Plugin represents a loaded plugin
@@ -39,11 +67,18 @@ type Plugin struct {
 	Name        string
 	Version     string
 	Description string
+	APIVersion  string
 	Path        string
 	Exports     map[string]interface{}
 	State       *lua.LState
 }
 
+// PluginCallback is notified about a plugin lifecycle change
+type PluginCallback func(plugin *Plugin)
+
+// PluginErrorCallback is notified when a plugin file fails to load
+type PluginErrorCallback func(path string, err error)
+
 // EventHandler represents a function that handles plugin events
 type EventHandler func(ctx context.Context, data interface{}) error
 
@@ -53,12 +88,14 @@ type PluginConfig struct {
 	PluginDir string
 	// Plugin-specific sandbox settings
 	Sandbox *Sandbox
-	// Custom API implementation
+	// Custom API implementation. When nil, an API backed by the Config is used.
 	API PluginAPI
 	// Allowed plugin types (e.g., "lua", "so")
 	AllowedTypes []string
 	// Plugin metadata requirements
 	RequiredMetadata []string
+	// HTTP access for plugins. When nil, every plugin HTTP request is denied.
+	HTTP *PluginHTTPConfig
 }
 
 // NewPluginManager creates a new plugin manager
@@ -71,13 +108,79 @@ func (c *Config) NewPluginManager(pcfg PluginConfig) *PluginManager {
 		}
 	}
 
-	return &PluginManager{
+	pm := &PluginManager{
 		cfg:           c,
 		plugins:       make(map[string]*Plugin),
 		eventHandlers: make(map[string][]EventHandler),
+		running:       make(map[*lua.LState]int),
+		retired:       make(map[*lua.LState]bool),
+		state:         make(map[string]map[string]interface{}),
+		http:          newPluginHTTPClient(pcfg.HTTP),
 		sandbox:       pcfg.Sandbox,
 		api:           pcfg.API,
+		logger:        c.logger,
+	}
+	if pm.api == nil {
+		pm.api = &configPluginAPI{pm: pm}
 	}
+	return pm
+}
+
+// API returns the PluginAPI handed to Go plugins during initialization
+func (pm *PluginManager) API() PluginAPI {
+	return pm.api
+}
+
+// configPluginAPI is the default PluginAPI, backed by the manager's Config
+type configPluginAPI struct {
+	pm *PluginManager
+}
+
+// RegisterFunction registers fn as a global Lua function on the Config
+func (a *configPluginAPI) RegisterFunction(name string, fn interface{}) error {
+	return a.pm.cfg.RegisterFunction(context.Background(), name, fn)
+}
+
+// RegisterHook registers hook on the Config
+func (a *configPluginAPI) RegisterHook(hookType HookType, hook Hook) error {
+	if hook == nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "hook cannot be nil",
+		}
+	}
+	a.pm.cfg.RegisterHook(hookType, hook)
+	return nil
+}
+
+// GetConfig returns the Config backing the plugin manager
+func (a *configPluginAPI) GetConfig() *Config {
+	return a.pm.cfg
+}
+
+// EmitEvent emits an event to the plugin manager's event handlers
+func (a *configPluginAPI) EmitEvent(name string, data interface{}) error {
+	return a.pm.EmitEvent(context.Background(), name, data)
+}
+
+// SetState stores a value in the plugin manager's state store
+func (a *configPluginAPI) SetState(namespace, key string, value interface{}) error {
+	return a.pm.SetState(namespace, key, value)
+}
+
+// GetState reads a value from the plugin manager's state store
+func (a *configPluginAPI) GetState(namespace, key string) (interface{}, bool) {
+	return a.pm.GetState(namespace, key)
+}
+
+// HTTP returns the plugin manager's allowlisted HTTP client
+func (a *configPluginAPI) HTTP() *PluginHTTPClient {
+	return a.pm.http
+}
+
+// CallPlugin calls a function exported by another loaded plugin
+func (a *configPluginAPI) CallPlugin(name, fn string, args ...interface{}) (interface{}, error) {
+	return a.pm.CallPlugin(context.Background(), name, fn, args...)
 }
 
 // LoadPlugins loads all plugins from the configured directory
@@ -95,16 +198,27 @@ func (pm *PluginManager) LoadPlugins(ctx context.Context, dir string) error {
 			continue
 		}
 
+		path := filepath.Join(dir, entry.Name())
 		ext := filepath.Ext(entry.Name())
 		switch ext {
 		case ".lua":
-			if err := pm.loadLuaPlugin(ctx, filepath.Join(dir, entry.Name())); err != nil {
+			if err := pm.loadLuaPlugin(ctx, path); err != nil {
+				pm.logger.Warn("failed to load Lua plugin",
+					zap.String("path", path),
+					zap.Error(err))
+				pm.notifyError(path, err)
 				return fmt.Errorf("failed to load Lua plugin %s: %w", entry.Name(), err)
 			}
 		case ".so":
-			if err := pm.loadGoPlugin(ctx, filepath.Join(dir, entry.Name())); err != nil {
+			if err := pm.loadGoPlugin(ctx, path); err != nil {
+				pm.logger.Warn("failed to load Go plugin",
+					zap.String("path", path),
+					zap.Error(err))
+				pm.notifyError(path, err)
 				return fmt.Errorf("failed to load Go plugin %s: %w", entry.Name(), err)
 			}
+		default:
+			pm.logger.Debug("skipping non-plugin file", zap.String("path", path))
 		}
 	}
 
@@ -112,35 +226,83 @@ func (pm *PluginManager) LoadPlugins(ctx context.Context, dir string) error {
 }
 
 func (pm *PluginManager) loadLuaPlugin(ctx context.Context, path string) error {
-	content, err := os.ReadFile(path)
+	plugin, err := pm.newLuaPlugin(ctx, path)
 	if err != nil {
 		return err
 	}
 
-	// Create sandboxed state for plugin
+	pm.mu.Lock()
+	pm.plugins[plugin.Name] = plugin
+	pm.mu.Unlock()
+
+	pm.logger.Debug("plugin loaded",
+		zap.String("name", plugin.Name),
+		zap.String("version", plugin.Version),
+		zap.String("type", "lua"),
+		zap.String("path", path),
+		zap.Int("exports", len(plugin.Exports)))
+
+	pm.notify(&pm.onLoaded, plugin)
+	return nil
+}
+
+// newLuaPlugin executes the Lua plugin at path in a fresh state and returns
+// it without registering it. The caller owns the returned plugin's state.
+func (pm *PluginManager) newLuaPlugin(ctx context.Context, path string) (*Plugin, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create sandboxed state for plugin, closed here if loading fails
 	L := lua.NewState()
-	defer L.Close()
+	loaded := false
+	defer func() {
+		if !loaded {
+			L.Close()
+		}
+	}()
+
+	if err := sandboxState(L, pm.sandbox); err != nil {
+		return nil, &Error{
+			Code:    ErrSandbox,
+			Message: "failed to apply sandbox restrictions",
+			Cause:   err,
+		}
+	}
 
 	// Register plugin API
-	if err := pm.registerPluginAPI(L); err != nil {
-		return err
+	owner := &pluginOwner{}
+	if err := pm.registerPluginAPI(L, owner); err != nil {
+		return nil, err
 	}
 
 	// Execute plugin
 	if err := L.DoString(string(content)); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Extract plugin metadata
 	metadata := pm.extractPluginMetadata(L)
 	if metadata == nil {
-		return fmt.Errorf("plugin %s missing required metadata", path)
+		return nil, fmt.Errorf("plugin %s missing required metadata", path)
+	}
+
+	apiVersion, err := checkPluginAPIVersion(path, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bind the state namespace to the name the plugin loads under
+	if name, _ := metadata["name"].(string); !owner.bind(name) {
+		return nil, fmt.Errorf("plugin %s used state as %s but declares name %s", path, owner.name, name)
 	}
 
 	plugin := &Plugin{
 		Name:        metadata["name"].(string),
 		Version:     metadata["version"].(string),
 		Description: metadata["description"].(string),
+		APIVersion:  apiVersion,
 		Path:        path,
 		Exports:     make(map[string]interface{}),
 		State:       L,
@@ -158,10 +320,57 @@ func (pm *PluginManager) loadLuaPlugin(ctx context.Context, path string) error {
 		}
 	}
 
+	loaded = true
+	return plugin, nil
+}
+
+// ReloadPlugin re-reads and re-executes a loaded Lua plugin from its file.
+// The new version is fully loaded before it replaces the old one, so a
+// failed reload leaves the previous version in place.
+func (pm *PluginManager) ReloadPlugin(ctx context.Context, name string) error {
+	old, ok := pm.GetPlugin(name)
+	if !ok {
+		return fmt.Errorf("plugin %s not found", name)
+	}
+	if old.State == nil {
+		return fmt.Errorf("plugin %s is not a Lua plugin and cannot be reloaded", name)
+	}
+
+	plugin, err := pm.newLuaPlugin(ctx, old.Path)
+	if err != nil {
+		pm.notifyError(old.Path, err)
+		return fmt.Errorf("failed to reload plugin %s: %w", name, err)
+	}
+	if plugin.Name != name {
+		plugin.State.Close()
+		return fmt.Errorf("plugin %s changed its name to %s on reload", name, plugin.Name)
+	}
+
 	pm.mu.Lock()
-	pm.plugins[plugin.Name] = plugin
+	if pm.plugins[name] != old {
+		// Another reload or an unload got there first
+		pm.mu.Unlock()
+		plugin.State.Close()
+		return fmt.Errorf("plugin %s was reloaded or unloaded while reloading", name)
+	}
+	pm.plugins[name] = plugin
+
+	// Drop entries registered through the old state and close it
+	for other, p := range pm.plugins {
+		if p.State == old.State {
+			delete(pm.plugins, other)
+		}
+	}
+	pm.closeState(old.State)
 	pm.mu.Unlock()
 
+	pm.logger.Debug("plugin reloaded",
+		zap.String("name", name),
+		zap.String("version", plugin.Version),
+		zap.String("path", plugin.Path))
+
+	pm.notify(&pm.onUnloaded, old)
+	pm.notify(&pm.onLoaded, plugin)
 	return nil
 }
 
@@ -182,10 +391,17 @@ func (pm *PluginManager) loadGoPlugin(ctx context.Context, path string) error {
 		return fmt.Errorf("plugin %s has invalid Metadata type", path)
 	}
 
+	// Refuse incompatible plugins before running any of their code
+	apiVersion, err := checkPluginAPIVersion(path, *metadata)
+	if err != nil {
+		return err
+	}
+
 	plugin := &Plugin{
 		Name:        (*metadata)["name"].(string),
 		Version:     (*metadata)["version"].(string),
 		Description: (*metadata)["description"].(string),
+		APIVersion:  apiVersion,
 		Path:        path,
 		Exports:     make(map[string]interface{}),
 	}
@@ -209,9 +425,127 @@ func (pm *PluginManager) loadGoPlugin(ctx context.Context, path string) error {
 	pm.plugins[plugin.Name] = plugin
 	pm.mu.Unlock()
 
+	pm.logger.Debug("plugin loaded",
+		zap.String("name", plugin.Name),
+		zap.String("version", plugin.Version),
+		zap.String("type", "go"),
+		zap.String("path", path))
+
+	pm.notify(&pm.onLoaded, plugin)
+	return nil
+}
+
+// Close unloads all plugins and closes their Lua states. It is safe to call more than once.
+func (pm *PluginManager) Close() error {
+	pm.closeOnce.Do(func() {
+		pm.mu.Lock()
+		unloaded := make([]*Plugin, 0, len(pm.plugins))
+		for _, plugin := range pm.plugins {
+			unloaded = append(unloaded, plugin)
+		}
+		pm.plugins = make(map[string]*Plugin)
+
+		// Several plugin entries can share one state, so close each only once
+		closed := make(map[*lua.LState]bool)
+		for _, plugin := range unloaded {
+			if plugin.State != nil && !closed[plugin.State] {
+				pm.closeState(plugin.State)
+				closed[plugin.State] = true
+			}
+		}
+		pm.mu.Unlock()
+
+		for _, plugin := range unloaded {
+			pm.notify(&pm.onUnloaded, plugin)
+		}
+	})
+	return nil
+}
+
+// UnloadPlugin removes a loaded plugin and closes its Lua state once no other
+// plugin entry shares it
+func (pm *PluginManager) UnloadPlugin(name string) error {
+	pm.mu.Lock()
+	plugin, ok := pm.plugins[name]
+	if !ok {
+		pm.mu.Unlock()
+		return fmt.Errorf("plugin %s not found", name)
+	}
+	delete(pm.plugins, name)
+
+	if plugin.State != nil {
+		shared := false
+		for _, other := range pm.plugins {
+			if other.State == plugin.State {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			pm.closeState(plugin.State)
+		}
+	}
+	pm.mu.Unlock()
+
+	pm.logger.Debug("plugin unloaded", zap.String("name", name))
+	pm.notify(&pm.onUnloaded, plugin)
 	return nil
 }
 
+// OnPluginLoaded registers a callback invoked after a plugin loads successfully
+func (pm *PluginManager) OnPluginLoaded(cb PluginCallback) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.onLoaded = append(pm.onLoaded, cb)
+}
+
+// OnPluginUnloaded registers a callback invoked after a plugin is unloaded
+func (pm *PluginManager) OnPluginUnloaded(cb PluginCallback) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.onUnloaded = append(pm.onUnloaded, cb)
+}
+
+// OnPluginError registers a callback invoked when a plugin file fails to load
+func (pm *PluginManager) OnPluginError(cb PluginErrorCallback) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.onError = append(pm.onError, cb)
+}
+
+// notify calls each lifecycle callback in *callbacks with plugin. The list
+// is read under the lock, as callbacks may be registered concurrently.
+func (pm *PluginManager) notify(callbacks *[]PluginCallback, plugin *Plugin) {
+	pm.mu.RLock()
+	cbs := append([]PluginCallback(nil), *callbacks...)
+	pm.mu.RUnlock()
+
+	for _, cb := range cbs {
+		cb(plugin)
+	}
+}
+
+// notifyError calls each error callback
+func (pm *PluginManager) notifyError(path string, err error) {
+	pm.mu.RLock()
+	cbs := append([]PluginErrorCallback(nil), pm.onError...)
+	pm.mu.RUnlock()
+
+	for _, cb := range cbs {
+		cb(path, err)
+	}
+}
+
+// closeState closes a plugin state that is no longer registered, or marks it
+// to be closed by the last call still running in it. pm.mu must be held.
+func (pm *PluginManager) closeState(L *lua.LState) {
+	if pm.running[L] > 0 {
+		pm.retired[L] = true
+		return
+	}
+	L.Close()
+}
+
 // RegisterEventHandler registers a handler for plugin events
 func (pm *PluginManager) RegisterEventHandler(event string, handler EventHandler) {
 	pm.mu.Lock()
@@ -233,6 +567,39 @@ func (pm *PluginManager) EmitEvent(ctx context.Context, event string, data inter
 	return nil
 }
 
+// SetState stores value under key in namespace. Setting a nil value removes
+// the key. Lua plugins can only reach their own namespace and
+// SharedStateNamespace.
+func (pm *PluginManager) SetState(namespace, key string, value interface{}) error {
+	if namespace == "" || key == "" {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "state namespace and key cannot be empty",
+		}
+	}
+
+	pm.stateMu.Lock()
+	defer pm.stateMu.Unlock()
+
+	if value == nil {
+		delete(pm.state[namespace], key)
+		return nil
+	}
+	if pm.state[namespace] == nil {
+		pm.state[namespace] = make(map[string]interface{})
+	}
+	pm.state[namespace][key] = value
+	return nil
+}
+
+// GetState returns the value stored under key in namespace
+func (pm *PluginManager) GetState(namespace, key string) (interface{}, bool) {
+	pm.stateMu.RLock()
+	defer pm.stateMu.RUnlock()
+	value, ok := pm.state[namespace][key]
+	return value, ok
+}
+
 // GetPlugin returns a loaded plugin by name
 func (pm *PluginManager) GetPlugin(name string) (*Plugin, bool) {
 	pm.mu.RLock()
@@ -241,12 +608,128 @@ func (pm *PluginManager) GetPlugin(name string) (*Plugin, bool) {
 	return plugin, ok
 }
 
-// CallPluginFunction calls an exported plugin function
+// CallPluginFunction calls an exported plugin function and returns its first
+// result. Use CallPluginFunctionMulti or CallPluginFunctionInto for functions
+// that return several values.
 func (pm *PluginManager) CallPluginFunction(ctx context.Context, pluginName, funcName string, args ...interface{}) (interface{}, error) {
-	plugin, ok := pm.GetPlugin(pluginName)
+	results, err := pm.callPluginFunction(ctx, pluginName, funcName, false, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pm.firstResult(results)
+}
+
+// CallPluginFunctionMulti calls an exported plugin function and returns all
+// of its results
+func (pm *PluginManager) CallPluginFunctionMulti(ctx context.Context, pluginName, funcName string, args ...interface{}) ([]interface{}, error) {
+	results, err := pm.callPluginFunction(ctx, pluginName, funcName, false, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(results))
+	for i, result := range results {
+		if values[i], err = pm.decodePluginResult(result, interfaceType); err != nil {
+			return nil, fmt.Errorf("failed to decode result %d of %s.%s: %w", i+1, pluginName, funcName, err)
+		}
+	}
+	return values, nil
+}
+
+// CallPluginFunctionInto calls an exported plugin function with args and
+// decodes its results, in order, into targets, which must be pointers.
+// Results without a matching target are discarded and targets without a
+// matching result are set to their zero value.
+func (pm *PluginManager) CallPluginFunctionInto(ctx context.Context, pluginName, funcName string, args []interface{}, targets ...interface{}) error {
+	for i, target := range targets {
+		val := reflect.ValueOf(target)
+		if val.Kind() != reflect.Ptr || val.IsNil() {
+			return &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("target %d must be a non-nil pointer, got %T", i+1, target),
+			}
+		}
+	}
+
+	results, err := pm.callPluginFunction(ctx, pluginName, funcName, false, args...)
+	if err != nil {
+		return err
+	}
+
+	for i, target := range targets {
+		val := reflect.ValueOf(target).Elem()
+		if i >= len(results) {
+			val.Set(reflect.Zero(val.Type()))
+			continue
+		}
+
+		decoded, err := pm.decodePluginResult(results[i], val.Type())
+		if err != nil {
+			return &Error{
+				Code:    ErrConversion,
+				Message: fmt.Sprintf("failed to decode result %d of %s.%s", i+1, pluginName, funcName),
+				Cause:   err,
+			}
+		}
+		if decoded == nil {
+			val.Set(reflect.Zero(val.Type()))
+			continue
+		}
+		rv := reflect.ValueOf(decoded)
+		if !rv.Type().AssignableTo(val.Type()) && rv.Type().ConvertibleTo(val.Type()) {
+			rv = rv.Convert(val.Type())
+		}
+		val.Set(rv)
+	}
+	return nil
+}
+
+// CallPlugin calls a function exported by a plugin on behalf of another
+// plugin. A plugin that is already executing in the chain of calls carried
+// by ctx cannot be called again this way, which rejects call cycles such as
+// A -> B -> A.
+func (pm *PluginManager) CallPlugin(ctx context.Context, pluginName, funcName string, args ...interface{}) (interface{}, error) {
+	results, err := pm.callPluginFunction(ctx, pluginName, funcName, true, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pm.firstResult(results)
+}
+
+// callPluginFunction calls an exported function and returns its raw
+// results: Lua values for Lua plugins and Go values for Go plugins
+func (pm *PluginManager) callPluginFunction(ctx context.Context, pluginName, funcName string, rejectCycles bool, args ...interface{}) ([]interface{}, error) {
+	pm.mu.Lock()
+	plugin, ok := pm.plugins[pluginName]
 	if !ok {
+		pm.mu.Unlock()
 		return nil, fmt.Errorf("plugin %s not found", pluginName)
 	}
+	chain, _ := ctx.Value(pluginCallChainKey{}).(*pluginCallChain)
+	if rejectCycles && chain.contains(pluginName) {
+		pm.mu.Unlock()
+		return nil, fmt.Errorf("cyclic plugin call: plugin %s is already executing", pluginName)
+	}
+	ctx = context.WithValue(ctx, pluginCallChainKey{}, &pluginCallChain{name: pluginName, caller: chain})
+	if plugin.State != nil {
+		pm.running[plugin.State]++
+	}
+	pm.mu.Unlock()
+
+	defer func() {
+		pm.mu.Lock()
+		if plugin.State != nil {
+			pm.running[plugin.State]--
+			if pm.running[plugin.State] == 0 {
+				delete(pm.running, plugin.State)
+				if pm.retired[plugin.State] {
+					delete(pm.retired, plugin.State)
+					plugin.State.Close()
+				}
+			}
+		}
+		pm.mu.Unlock()
+	}()
 
 	fn, ok := plugin.Exports[funcName]
 	if !ok {
@@ -255,32 +738,98 @@ func (pm *PluginManager) CallPluginFunction(ctx context.Context, pluginName, fun
 
 	switch fn := fn.(type) {
 	case *lua.LFunction:
-		return pm.callLuaFunction(plugin.State, fn, args...)
+		return pm.callLuaFunction(ctx, plugin.State, fn, args...)
 	case func(...interface{}) (interface{}, error):
-		return fn(args...)
+		result, err := fn(args...)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{result}, nil
 	default:
 		return nil, fmt.Errorf("unsupported function type: %T", fn)
 	}
 }
 
-func (pm *PluginManager) callLuaFunction(L *lua.LState, fn *lua.LFunction, args ...interface{}) (interface{}, error) {
+// pluginCallChainKey is the context key under which callPluginFunction
+// records the plugins executing in the current chain of calls
+type pluginCallChainKey struct{}
+
+// pluginCallChain is a plugin executing in a chain of calls, linked to the
+// plugin that called it
+type pluginCallChain struct {
+	name   string
+	caller *pluginCallChain
+}
+
+// contains reports whether the plugin name is executing in the chain
+func (c *pluginCallChain) contains(name string) bool {
+	for ; c != nil; c = c.caller {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// callLuaFunction calls fn in L with ctx attached, so calls the function
+// makes through the plugin API continue the same call chain
+func (pm *PluginManager) callLuaFunction(ctx context.Context, L *lua.LState, fn *lua.LFunction, args ...interface{}) ([]interface{}, error) {
+	previous := L.Context()
+	L.SetContext(ctx)
+	defer func() {
+		if previous != nil {
+			L.SetContext(previous)
+		} else {
+			L.RemoveContext()
+		}
+	}()
+
+	top := L.GetTop()
 	L.Push(fn)
 	for _, arg := range args {
 		lv, err := pm.cfg.goToLua(arg)
 		if err != nil {
+			L.SetTop(top)
 			return nil, err
 		}
 		L.Push(lv)
 	}
 
-	if err := L.PCall(len(args), 1, nil); err != nil {
+	if err := L.PCall(len(args), lua.MultRet, nil); err != nil {
 		return nil, err
 	}
 
-	result := L.Get(-1)
-	L.Pop(1)
+	results := make([]interface{}, 0, L.GetTop()-top)
+	for i := top + 1; i <= L.GetTop(); i++ {
+		results = append(results, L.Get(i))
+	}
+	L.SetTop(top)
+	return results, nil
+}
 
-	return pm.cfg.luaToGo(result, reflect.TypeOf(result))
+// firstResult decodes the first raw result of a plugin call, or nil if the
+// call returned nothing
+func (pm *PluginManager) firstResult(results []interface{}) (interface{}, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return pm.decodePluginResult(results[0], interfaceType)
+}
+
+// decodePluginResult converts a raw plugin call result to a value of type t
+func (pm *PluginManager) decodePluginResult(result interface{}, t reflect.Type) (interface{}, error) {
+	lv, ok := result.(lua.LValue)
+	if !ok {
+		// Results from Go plugins are already Go values
+		if result == nil || reflect.TypeOf(result).AssignableTo(t) {
+			return result, nil
+		}
+		var err error
+		if lv, err = pm.cfg.goToLua(result); err != nil {
+			return nil, err
+		}
+	}
+	return pm.cfg.luaToGo(lv, t)
 }
 
 func (pm *PluginManager) extractPluginMetadata(L *lua.LState) map[string]interface{} {
@@ -320,7 +869,42 @@ func (pm *PluginManager) luaValueToGo(v lua.LValue) interface{} {
 	}
 }
 
-func (pm *PluginManager) registerPluginAPI(L *lua.LState) error {
+// pluginOwner holds the name whose private state namespace a Lua plugin
+// state may use. It is bound once, when the plugin loads or first uses its
+// state, so a plugin cannot rename itself later to reach another plugin's
+// namespace.
+type pluginOwner struct {
+	name string
+}
+
+// bind binds name unless another name is already bound, and reports whether
+// name is the bound name
+func (o *pluginOwner) bind(name string) bool {
+	if o.name == "" {
+		o.name = name
+	}
+	return o.name == name
+}
+
+// namespace returns the bound name. A plugin that uses its state while still
+// loading is bound to the name its metadata declares at that point, and a Lua
+// error is raised if it has not declared one.
+func (o *pluginOwner) namespace(L *lua.LState) string {
+	if o.name == "" {
+		metadata, _ := L.GetGlobal("metadata").(*lua.LTable)
+		if metadata == nil {
+			L.RaiseError("plugin state requires metadata.name to be set")
+		}
+		name, ok := metadata.RawGetString("name").(lua.LString)
+		if !ok || name == "" {
+			L.RaiseError("plugin state requires metadata.name to be set")
+		}
+		o.bind(string(name))
+	}
+	return o.name
+}
+
+func (pm *PluginManager) registerPluginAPI(L *lua.LState, owner *pluginOwner) error {
 	api := L.NewTable()
 
 	// Register API functions
@@ -366,6 +950,65 @@ func (pm *PluginManager) registerPluginAPI(L *lua.LState) error {
 		return 0
 	}))
 
+	L.SetField(api, "call_plugin", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		fn := L.CheckString(2)
+		args := make([]interface{}, 0, L.GetTop()-2)
+		for i := 3; i <= L.GetTop(); i++ {
+			args = append(args, pm.luaValueToGo(L.Get(i)))
+		}
+
+		result, err := pm.CallPlugin(pm.luaContext(L), name, fn, args...)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+
+		lv, err := pm.cfg.goToLua(result)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+		L.Push(lv)
+		return 1
+	}))
+
+	// State is stored as Go values so no Lua value is shared between states
+	setState := func(L *lua.LState, namespace string) int {
+		key := L.CheckString(1)
+		if err := pm.SetState(namespace, key, pm.luaValueToGo(L.Get(2))); err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+		return 0
+	}
+	getState := func(L *lua.LState, namespace string) int {
+		value, ok := pm.GetState(namespace, L.CheckString(1))
+		if !ok {
+			L.Push(lua.LNil)
+			return 1
+		}
+		lv, err := pm.cfg.goToLua(value)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+		L.Push(lv)
+		return 1
+	}
+
+	L.SetField(api, "set_state", L.NewFunction(func(L *lua.LState) int {
+		return setState(L, owner.namespace(L))
+	}))
+	L.SetField(api, "get_state", L.NewFunction(func(L *lua.LState) int {
+		return getState(L, owner.namespace(L))
+	}))
+	L.SetField(api, "set_shared", L.NewFunction(func(L *lua.LState) int {
+		return setState(L, SharedStateNamespace)
+	}))
+	L.SetField(api, "get_shared", L.NewFunction(func(L *lua.LState) int {
+		return getState(L, SharedStateNamespace)
+	}))
+
 	L.SetField(api, "get_config", L.NewFunction(func(L *lua.LState) int {
 		name := L.CheckString(1)
 		value := pm.cfg.L.GetGlobal(name)
@@ -373,6 +1016,8 @@ func (pm *PluginManager) registerPluginAPI(L *lua.LState) error {
 		return 1
 	}))
 
+	pm.registerHTTPAPI(L, api)
+
 	// Set the API table as a global
 	L.SetGlobal("api", api)
 	return nil
@@ -0,0 +1,264 @@
+package lugo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// defaultPluginHTTPTimeout bounds a plugin HTTP request when no timeout is configured
+	defaultPluginHTTPTimeout = 10 * time.Second
+	// defaultPluginHTTPMaxBody bounds a plugin HTTP response body when no limit is configured
+	defaultPluginHTTPMaxBody = 1024 * 1024 // 1MB
+)
+
+// PluginHTTPConfig controls the HTTP client offered to plugins. Plugins never
+// get raw socket access; every request goes through the host and is checked
+// against AllowedHosts.
+type PluginHTTPConfig struct {
+	// AllowedHosts lists the hosts plugins may reach. Entries match the
+	// request host with or without its port, and "*.example.com" matches
+	// any subdomain of example.com. An empty list denies every request.
+	AllowedHosts []string
+	// Timeout bounds each request, including redirects and reading the body
+	Timeout time.Duration
+	// MaxResponseSize is the largest response body, in bytes, a plugin may read
+	MaxResponseSize int64
+	// Transport overrides the transport used to send requests
+	Transport http.RoundTripper
+}
+
+// PluginHTTPRequest describes an HTTP request made by a plugin
+type PluginHTTPRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+}
+
+// PluginHTTPResponse is the response returned to a plugin
+type PluginHTTPResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    string
+}
+
+// PluginHTTPClient performs HTTP requests on behalf of plugins
+type PluginHTTPClient struct {
+	allowed []string
+	maxBody int64
+	client  *http.Client
+}
+
+// newPluginHTTPClient creates a client from cfg. A nil cfg yields a client
+// that denies every request.
+func newPluginHTTPClient(cfg *PluginHTTPConfig) *PluginHTTPClient {
+	if cfg == nil {
+		cfg = &PluginHTTPConfig{}
+	}
+
+	hc := &PluginHTTPClient{
+		allowed: make([]string, 0, len(cfg.AllowedHosts)),
+		maxBody: cfg.MaxResponseSize,
+	}
+	for _, host := range cfg.AllowedHosts {
+		hc.allowed = append(hc.allowed, strings.ToLower(host))
+	}
+	if hc.maxBody <= 0 {
+		hc.maxBody = defaultPluginHTTPMaxBody
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultPluginHTTPTimeout
+	}
+
+	hc.client = &http.Client{
+		Transport: cfg.Transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return hc.checkURL(req.URL)
+		},
+	}
+	return hc
+}
+
+// Get performs a GET request
+func (hc *PluginHTTPClient) Get(ctx context.Context, rawURL string) (*PluginHTTPResponse, error) {
+	return hc.Do(ctx, PluginHTTPRequest{Method: http.MethodGet, URL: rawURL})
+}
+
+// Do performs req if its host is allowed
+func (hc *PluginHTTPClient) Do(ctx context.Context, req PluginHTTPRequest) (*PluginHTTPResponse, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, &Error{
+			Code:    ErrValidation,
+			Message: fmt.Sprintf("invalid URL %q", req.URL),
+			Cause:   err,
+		}
+	}
+	if err := hc.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if req.Body != "" {
+		body = strings.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, &Error{
+			Code:    ErrValidation,
+			Message: "invalid HTTP request",
+			Cause:   err,
+		}
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := hc.client.Do(httpReq)
+	if err != nil {
+		if sbErr, ok := unwrapSandboxError(err); ok {
+			return nil, sbErr
+		}
+		return nil, &Error{
+			Code:    ErrIO,
+			Message: fmt.Sprintf("HTTP request to %s failed", u.Host),
+			Cause:   err,
+		}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, hc.maxBody+1))
+	if err != nil {
+		return nil, &Error{
+			Code:    ErrIO,
+			Message: "failed to read HTTP response",
+			Cause:   err,
+		}
+	}
+	if int64(len(data)) > hc.maxBody {
+		return nil, &Error{
+			Code:    ErrSandbox,
+			Message: fmt.Sprintf("HTTP response exceeds %d bytes", hc.maxBody),
+		}
+	}
+
+	headers := make(map[string]string, len(resp.Header))
+	for k := range resp.Header {
+		headers[k] = resp.Header.Get(k)
+	}
+
+	return &PluginHTTPResponse{
+		Status:  resp.StatusCode,
+		Headers: headers,
+		Body:    string(data),
+	}, nil
+}
+
+// checkURL rejects non-HTTP schemes and hosts that are not allowlisted
+func (hc *PluginHTTPClient) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &Error{
+			Code:    ErrSandbox,
+			Message: fmt.Sprintf("URL scheme %q is not allowed", u.Scheme),
+		}
+	}
+
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	for _, allowed := range hc.allowed {
+		switch {
+		case allowed == host || allowed == hostname:
+			return nil
+		case strings.HasPrefix(allowed, "*.") && strings.HasSuffix(hostname, allowed[1:]):
+			return nil
+		}
+	}
+
+	return &Error{
+		Code:    ErrSandbox,
+		Message: fmt.Sprintf("host %s is not allowed", u.Host),
+	}
+}
+
+// unwrapSandboxError finds a sandbox error returned from CheckRedirect
+func unwrapSandboxError(err error) (*Error, bool) {
+	if urlErr, ok := err.(*url.Error); ok {
+		if e, ok := urlErr.Err.(*Error); ok && e.Code == ErrSandbox {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// registerHTTPAPI adds api.http_get and api.http_request to a plugin's API
+// table. Both return a response table, or nil and an error message.
+func (pm *PluginManager) registerHTTPAPI(L *lua.LState, api *lua.LTable) {
+	push := func(L *lua.LState, resp *PluginHTTPResponse, err error) int {
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(err.Error()))
+			return 2
+		}
+
+		headers := L.NewTable()
+		for k, v := range resp.Headers {
+			headers.RawSetString(k, lua.LString(v))
+		}
+		result := L.NewTable()
+		result.RawSetString("status", lua.LNumber(resp.Status))
+		result.RawSetString("headers", headers)
+		result.RawSetString("body", lua.LString(resp.Body))
+		L.Push(result)
+		return 1
+	}
+
+	L.SetField(api, "http_get", L.NewFunction(func(L *lua.LState) int {
+		resp, err := pm.http.Get(pm.luaContext(L), L.CheckString(1))
+		return push(L, resp, err)
+	}))
+
+	L.SetField(api, "http_request", L.NewFunction(func(L *lua.LState) int {
+		opts := L.CheckTable(1)
+		req := PluginHTTPRequest{
+			Method:  lua.LVAsString(opts.RawGetString("method")),
+			URL:     lua.LVAsString(opts.RawGetString("url")),
+			Body:    lua.LVAsString(opts.RawGetString("body")),
+			Headers: make(map[string]string),
+		}
+		if headers, ok := opts.RawGetString("headers").(*lua.LTable); ok {
+			headers.ForEach(func(k, v lua.LValue) {
+				req.Headers[k.String()] = v.String()
+			})
+		}
+
+		resp, err := pm.http.Do(pm.luaContext(L), req)
+		return push(L, resp, err)
+	}))
+}
+
+// luaContext returns the context attached to L, or a background context
+func (pm *PluginManager) luaContext(L *lua.LState) context.Context {
+	if ctx := L.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,96 @@
+package lugo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big":
+			fmt.Fprint(w, strings.Repeat("x", 64))
+		case "/redirect":
+			http.Redirect(w, r, "http://blocked.example.com/", http.StatusFound)
+		default:
+			w.Header().Set("X-Plugin", "yes")
+			fmt.Fprintf(w, "%s %s", r.Method, r.Header.Get("X-Token"))
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	cfg := New()
+	defer cfg.Close()
+
+	pm := cfg.NewPluginManager(PluginConfig{
+		HTTP: &PluginHTTPConfig{
+			AllowedHosts:    []string{serverURL.Host, "*.trusted.test"},
+			MaxResponseSize: 32,
+		},
+	})
+	defer pm.Close()
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "fetch.lua", fmt.Sprintf(`
+		metadata = { name = "fetch", version = "1.0.0", description = "http plugin" }
+		exports = {
+			get = function(path)
+				local resp, err = api.http_get(%q .. path)
+				if not resp then return nil, err end
+				return resp.status, resp.body, resp.headers["X-Plugin"]
+			end,
+			post = function()
+				local resp = api.http_request{ method = "post", url = %q, headers = { ["X-Token"] = "abc" } }
+				return resp.body
+			end,
+			blocked = function()
+				return api.http_get("http://example.com/")
+			end,
+		}
+	`, server.URL, server.URL))
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+	ctx := context.Background()
+
+	values, err := pm.CallPluginFunctionMulti(ctx, "fetch", "get", "/")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{float64(200), "GET ", "yes"}, values)
+
+	body, err := pm.CallPluginFunction(ctx, "fetch", "post")
+	require.NoError(t, err)
+	assert.Equal(t, "POST abc", body)
+
+	// Disallowed hosts are refused without making a request
+	values, err = pm.CallPluginFunctionMulti(ctx, "fetch", "blocked")
+	require.NoError(t, err)
+	require.Len(t, values, 2)
+	assert.Nil(t, values[0])
+	assert.Contains(t, values[1], "host example.com is not allowed")
+
+	// Size limits and redirects to other hosts are enforced
+	values, err = pm.CallPluginFunctionMulti(ctx, "fetch", "get", "/big")
+	require.NoError(t, err)
+	assert.Contains(t, values[1], "exceeds 32 bytes")
+
+	_, err = pm.API().HTTP().Get(ctx, server.URL+"/redirect")
+	assert.True(t, IsErrorCode(err, ErrSandbox))
+
+	_, err = pm.API().HTTP().Get(ctx, "file:///etc/passwd")
+	assert.True(t, IsErrorCode(err, ErrSandbox))
+
+	// Without HTTP configuration every request is denied
+	denied := cfg.NewPluginManager(PluginConfig{})
+	defer denied.Close()
+	_, err = denied.API().HTTP().Get(ctx, server.URL)
+	assert.True(t, IsErrorCode(err, ErrSandbox))
+}
@@ -0,0 +1,531 @@
+package lugo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// writePlugin writes a Lua plugin file into dir
+func writePlugin(t *testing.T, dir, filename, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, filename)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestPluginLogging(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	cfg := New(WithLogger(zap.New(core)))
+	defer cfg.Close()
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "hello.lua", `
+		metadata = { name = "hello", version = "1.2.3", description = "test plugin" }
+		exports = { greet = function(name) return "hello " .. name end }
+	`)
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+
+	entries := logs.FilterMessage("plugin loaded").All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "hello", fields["name"])
+	assert.Equal(t, "1.2.3", fields["version"])
+	assert.Equal(t, "lua", fields["type"])
+}
+
+func TestPluginLifecycleCallbacks(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "hello.lua", `
+		metadata = { name = "hello", version = "1.0.0", description = "lifecycle test" }
+		exports = { ping = function() return "pong" end }
+	`)
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+
+	var loaded, unloaded []string
+	var failed []string
+	pm.OnPluginLoaded(func(p *Plugin) { loaded = append(loaded, p.Name) })
+	pm.OnPluginUnloaded(func(p *Plugin) { unloaded = append(unloaded, p.Name) })
+	pm.OnPluginError(func(path string, err error) {
+		assert.Error(t, err)
+		failed = append(failed, filepath.Base(path))
+	})
+
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+	assert.Equal(t, []string{"hello"}, loaded)
+
+	badDir := t.TempDir()
+	writePlugin(t, badDir, "broken.lua", `this is not lua`)
+	assert.Error(t, pm.LoadPlugins(context.Background(), badDir))
+	assert.Equal(t, []string{"broken.lua"}, failed)
+
+	require.NoError(t, pm.UnloadPlugin("hello"))
+	assert.Equal(t, []string{"hello"}, unloaded)
+	_, ok := pm.GetPlugin("hello")
+	assert.False(t, ok)
+
+	assert.Error(t, pm.UnloadPlugin("hello"))
+}
+
+func TestPluginCallbackRegistrationRace(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "hello.lua", `
+		metadata = { name = "hello", version = "1.0.0", description = "race test" }
+	`)
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+
+	// Registering callbacks while plugins load and unload must not race
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			pm.OnPluginLoaded(func(*Plugin) {})
+			pm.OnPluginUnloaded(func(*Plugin) {})
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+		require.NoError(t, pm.UnloadPlugin("hello"))
+	}
+	wg.Wait()
+}
+
+func TestPluginAPIVersion(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "compatible.lua", `
+		metadata = { name = "compatible", version = "1.0.0", description = "ok", api_version = "^1.0" }
+	`)
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+	p, ok := pm.GetPlugin("compatible")
+	require.True(t, ok)
+	assert.Equal(t, "^1.0", p.APIVersion)
+
+	badDir := t.TempDir()
+	writePlugin(t, badDir, "future.lua", `
+		metadata = { name = "future", version = "1.0.0", description = "too new", api_version = ">=2.0.0 <3.0.0" }
+	`)
+	err := pm.LoadPlugins(context.Background(), badDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "requires plugin API >=2.0.0 <3.0.0")
+	_, ok = pm.GetPlugin("future")
+	assert.False(t, ok)
+
+	tests := []struct {
+		version, constraint string
+		want                bool
+	}{
+		{"1.4.2", "^1.2", true},
+		{"2.0.0", "^1.2", false},
+		{"0.3.0", "^0.2", false},
+		{"1.2.9", "~1.2", true},
+		{"1.3.0", "~1.2", false},
+		{"1.0.0", ">=1.0.0, <2", true},
+		{"1.0.0", "*", true},
+		{"1.0.0", "=1.0.1", false},
+	}
+	for _, tt := range tests {
+		got, err := versionSatisfies(tt.version, tt.constraint)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "%s %s", tt.version, tt.constraint)
+	}
+
+	_, err = versionSatisfies("1.0.0", ">=one")
+	assert.Error(t, err)
+}
+
+func TestDefaultPluginAPI(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+	require.NotNil(t, pm.API())
+	assert.Same(t, cfg, pm.API().GetConfig())
+
+	var received interface{}
+	pm.RegisterEventHandler("ready", func(ctx context.Context, data interface{}) error {
+		received = data
+		return nil
+	})
+
+	// Same shape as the Init function exported by a Go plugin
+	initPlugin := func(api PluginAPI) error {
+		if err := api.RegisterFunction("double", func(n int) int { return n * 2 }); err != nil {
+			return err
+		}
+		return api.EmitEvent("ready", "double")
+	}
+	require.NoError(t, initPlugin(pm.API()))
+	assert.Equal(t, "double", received)
+
+	require.NoError(t, cfg.L.DoString(`result = double(21)`))
+	assert.Equal(t, lua.LNumber(42), cfg.L.GetGlobal("result"))
+
+	assert.Error(t, pm.API().RegisterHook(BeforeExec, nil))
+}
+
+func TestReloadPlugin(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+
+	dir := t.TempDir()
+	path := writePlugin(t, dir, "greeter.lua", `
+		metadata = { name = "greeter", version = "1.0.0", description = "v1" }
+		exports = { greet = function(name) return "hello " .. name end }
+	`)
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+
+	result, err := pm.CallPluginFunction(context.Background(), "greeter", "greet", "lua")
+	require.NoError(t, err)
+	assert.Equal(t, "hello lua", result)
+
+	writePlugin(t, dir, "greeter.lua", `
+		metadata = { name = "greeter", version = "1.1.0", description = "v2" }
+		exports = { greet = function(name) return "hi " .. name end }
+	`)
+	require.NoError(t, pm.ReloadPlugin(context.Background(), "greeter"))
+
+	result, err = pm.CallPluginFunction(context.Background(), "greeter", "greet", "lua")
+	require.NoError(t, err)
+	assert.Equal(t, "hi lua", result)
+	p, _ := pm.GetPlugin("greeter")
+	assert.Equal(t, "1.1.0", p.Version)
+
+	// A broken edit keeps the previous version running
+	require.NoError(t, os.WriteFile(path, []byte("not valid lua"), 0644))
+	assert.Error(t, pm.ReloadPlugin(context.Background(), "greeter"))
+	result, err = pm.CallPluginFunction(context.Background(), "greeter", "greet", "lua")
+	require.NoError(t, err)
+	assert.Equal(t, "hi lua", result)
+
+	assert.Error(t, pm.ReloadPlugin(context.Background(), "missing"))
+}
+
+func TestReloadPluginDuringCall(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+
+	dir := t.TempDir()
+	path := writePlugin(t, dir, "greeter.lua", `
+		metadata = { name = "greeter", version = "1.0.0", description = "v1" }
+		exports = {
+			greet = function()
+				api.emit_event("reload")
+				return string.upper("v1")
+			end,
+		}
+	`)
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+	old, _ := pm.GetPlugin("greeter")
+
+	// A reload while a call is running closes the old state once it returns
+	pm.RegisterEventHandler("reload", func(ctx context.Context, data interface{}) error {
+		writePlugin(t, dir, "greeter.lua", `
+			metadata = { name = "greeter", version = "2.0.0", description = "v2" }
+			exports = { greet = function() return "v2" end }
+		`)
+		require.NoError(t, pm.ReloadPlugin(ctx, "greeter"))
+		assert.False(t, old.State.IsClosed())
+		return nil
+	})
+	result, err := pm.CallPluginFunction(context.Background(), "greeter", "greet")
+	require.NoError(t, err)
+	assert.Equal(t, "V1", result)
+	assert.True(t, old.State.IsClosed())
+
+	result, err = pm.CallPluginFunction(context.Background(), "greeter", "greet")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", result)
+
+	// A plugin unloaded while it was being reloaded stays unloaded
+	pm.RegisterEventHandler("loading", func(ctx context.Context, data interface{}) error {
+		return pm.UnloadPlugin("greeter")
+	})
+	require.NoError(t, os.WriteFile(path, []byte(`
+		metadata = { name = "greeter", version = "3.0.0", description = "v3" }
+		api.emit_event("loading")
+	`), 0644))
+	err = pm.ReloadPlugin(context.Background(), "greeter")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reloaded or unloaded while reloading")
+	_, ok := pm.GetPlugin("greeter")
+	assert.False(t, ok)
+}
+
+func TestCallPluginBetweenPlugins(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "a.lua", `
+		metadata = { name = "a", version = "1.0.0", description = "math" }
+		exports = {
+			add = function(x, y) return x + y end,
+			ping = function() return api.call_plugin("b", "pong") end,
+		}
+	`)
+	writePlugin(t, dir, "b.lua", `
+		metadata = { name = "b", version = "1.0.0", description = "uses a" }
+		exports = {
+			sum3 = function(x, y, z) return api.call_plugin("a", "add", api.call_plugin("a", "add", x, y), z) end,
+			pong = function() return api.call_plugin("a", "ping") end,
+		}
+	`)
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+
+	result, err := pm.CallPluginFunction(context.Background(), "b", "sum3", 1, 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, float64(6), result)
+
+	// a.ping -> b.pong -> a.ping is a cycle
+	_, err = pm.CallPluginFunction(context.Background(), "a", "ping")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cyclic plugin call")
+
+	// The Go-side API reaches the same exports
+	result, err = pm.API().CallPlugin("a", "add", 40, 2)
+	require.NoError(t, err)
+	assert.Equal(t, float64(42), result)
+
+	// A call outside the running chain is not a cycle, even into a plugin
+	// that is executing
+	slowDir := t.TempDir()
+	writePlugin(t, slowDir, "slow.lua", `
+		metadata = { name = "slow", version = "1.0.0", description = "emits while running" }
+		exports = {
+			run = function() api.emit_event("tick"); return "done" end,
+			f = function() return "f" end,
+		}
+	`)
+	require.NoError(t, pm.LoadPlugins(context.Background(), slowDir))
+	pm.RegisterEventHandler("tick", func(ctx context.Context, data interface{}) error {
+		result, err := pm.API().CallPlugin("slow", "f")
+		require.NoError(t, err)
+		assert.Equal(t, "f", result)
+		return nil
+	})
+	result, err = pm.CallPluginFunction(context.Background(), "slow", "run")
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+}
+
+func TestPluginSharedState(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "writer.lua", `
+		metadata = { name = "writer", version = "1.0.0", description = "writes state" }
+		api.set_shared("greeting", "hello")
+		api.set_shared("limits", { max = 10 })
+		api.set_state("secret", "writer-only")
+		exports = { secret = function() return api.get_state("secret") end }
+	`)
+	writePlugin(t, dir, "x_reader.lua", `
+		metadata = { name = "reader", version = "1.0.0", description = "reads state" }
+		exports = {
+			greeting = function() return api.get_shared("greeting") end,
+			max = function() return api.get_shared("limits").max end,
+			secret = function() return api.get_state("secret") end,
+			steal = function()
+				metadata.name = "writer"
+				return api.get_state("secret")
+			end,
+		}
+	`)
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+
+	result, err := pm.CallPluginFunction(context.Background(), "reader", "greeting")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result)
+
+	result, err = pm.CallPluginFunction(context.Background(), "reader", "max")
+	require.NoError(t, err)
+	assert.Equal(t, float64(10), result)
+
+	// Private namespaces are not visible to other plugins
+	result, err = pm.CallPluginFunction(context.Background(), "reader", "secret")
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	// Renaming itself does not give a plugin another plugin's namespace
+	result, err = pm.CallPluginFunction(context.Background(), "reader", "steal")
+	require.NoError(t, err)
+	assert.Nil(t, result)
+
+	renamed := t.TempDir()
+	writePlugin(t, renamed, "renamed.lua", `
+		metadata = { name = "early", version = "1.0.0", description = "renames itself" }
+		api.set_state("key", "value")
+		metadata.name = "writer"
+	`)
+	err = pm.LoadPlugins(context.Background(), renamed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "used state as early but declares name writer")
+
+	result, err = pm.CallPluginFunction(context.Background(), "writer", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "writer-only", result)
+
+	// The host and Go plugins see the same store
+	value, ok := pm.API().GetState("writer", "secret")
+	require.True(t, ok)
+	assert.Equal(t, "writer-only", value)
+
+	require.NoError(t, pm.API().SetState(SharedStateNamespace, "greeting", nil))
+	_, ok = pm.GetState(SharedStateNamespace, "greeting")
+	assert.False(t, ok)
+	assert.Error(t, pm.SetState("", "key", 1))
+}
+
+func TestCallPluginFunctionMultiReturn(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "divmod.lua", `
+		metadata = { name = "divmod", version = "1.0.0", description = "multiple returns" }
+		exports = {
+			divmod = function(a, b) return math.floor(a / b), a % b end,
+			server = function() return { host = "localhost", port = 8080 }, "ok" end,
+		}
+	`)
+	require.NoError(t, pm.LoadPlugins(context.Background(), dir))
+	ctx := context.Background()
+
+	values, err := pm.CallPluginFunctionMulti(ctx, "divmod", "divmod", 17, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{float64(3), float64(2)}, values)
+
+	// The single-value call still returns the first result
+	first, err := pm.CallPluginFunction(ctx, "divmod", "divmod", 17, 5)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), first)
+
+	var quotient, remainder int
+	require.NoError(t, pm.CallPluginFunctionInto(ctx, "divmod", "divmod", []interface{}{17, 5}, &quotient, &remainder))
+	assert.Equal(t, 3, quotient)
+	assert.Equal(t, 2, remainder)
+
+	// Tables decode into structs using the target's type
+	type Server struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+	var server Server
+	var status, extra string
+	require.NoError(t, pm.CallPluginFunctionInto(ctx, "divmod", "server", nil, &server, &status, &extra))
+	assert.Equal(t, Server{Host: "localhost", Port: 8080}, server)
+	assert.Equal(t, "ok", status)
+	assert.Equal(t, "", extra)
+
+	table, err := pm.CallPluginFunction(ctx, "divmod", "server")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"host": "localhost", "port": float64(8080)}, table)
+
+	err = pm.CallPluginFunctionInto(ctx, "divmod", "divmod", []interface{}{1, 1}, quotient)
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+}
+
+func TestPluginSandbox(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	marker := filepath.Join(t.TempDir(), "pwned")
+	ctx := context.Background()
+
+	// A plugin that shells out at load time fails to load
+	loadDir := t.TempDir()
+	writePlugin(t, loadDir, "shell.lua", `
+		metadata = { name = "shell", version = "1.0.0", description = "escapes at load" }
+		os.execute("touch `+marker+`")
+	`)
+	pm := cfg.NewPluginManager(PluginConfig{})
+	defer pm.Close()
+	assert.Error(t, pm.LoadPlugins(ctx, loadDir))
+
+	callDir := t.TempDir()
+	writePlugin(t, callDir, "later.lua", `
+		metadata = { name = "later", version = "1.0.0", description = "escapes when called" }
+		exports = {
+			run = function() return os.execute("touch `+marker+`") end,
+			read = function() return io.open("`+marker+`") end,
+			required = function() return require("os").execute("touch `+marker+`") end,
+			loaded = function() package.loaded.io.open("`+marker+`", "w"):close() return true end,
+			loadedOS = function() return package.loaded.os.execute("touch `+marker+`") end,
+			upper = function() return require("string").upper("ok") end,
+			now = function() return type(os.time()) end,
+		}
+	`)
+	pm = cfg.NewPluginManager(PluginConfig{
+		Sandbox: &Sandbox{EnableSyscalls: true, MaxMemory: 1024 * 1024},
+	})
+	defer pm.Close()
+	require.NoError(t, pm.LoadPlugins(ctx, callDir))
+
+	_, err := pm.CallPluginFunction(ctx, "later", "run")
+	assert.Error(t, err)
+	_, err = pm.CallPluginFunction(ctx, "later", "read")
+	assert.Error(t, err)
+
+	// Nor can the libraries be reached through require or package.loaded
+	for _, fn := range []string{"required", "loaded", "loadedOS"} {
+		_, err = pm.CallPluginFunction(ctx, "later", fn)
+		assert.Error(t, err, fn)
+	}
+	assert.NoFileExists(t, marker)
+
+	upper, err := pm.CallPluginFunction(ctx, "later", "upper")
+	require.NoError(t, err)
+	assert.Equal(t, "OK", upper)
+
+	// Safe os functions stay available when syscalls are enabled
+	now, err := pm.CallPluginFunction(ctx, "later", "now")
+	require.NoError(t, err)
+	assert.Equal(t, "number", now)
+}
@@ -0,0 +1,235 @@
+package lugo
+
+import (
+	"sync"
+	"sync/atomic"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// statePool holds replicas of a Config's Lua state so that Get can run
+// concurrently, each on a state of its own
+type statePool struct {
+	idle    chan *pooledState
+	version atomic.Uint64
+	// primary is held while Call or Eval runs on the primary state
+	primary sync.Mutex
+}
+
+// pooledState is a replica and the version of the primary state it mirrors.
+// cfg is nil until the replica is first used.
+type pooledState struct {
+	cfg     *Config
+	version uint64
+}
+
+// WithStatePool lets up to size calls to Get run at once, each on its own
+// replica of the Lua state rather than sharing the primary one. Further calls
+// wait for a replica to become free.
+//
+// Call and Eval run Lua code that may assign globals, so they run on the
+// primary state, one at a time, and the changes they make are kept. While one
+// runs, Get uses the replica it is given as it is, seeing the globals as they
+// were before the call.
+//
+// A replica is populated on first use by copying the global variables of the
+// primary state, and repopulated after LoadFile, DoString, DoFile, Set,
+// SetGlobal, Call or Eval change them. Other changes are not detected:
+// register types, functions, validators and hooks before the pool is first
+// used, and do not modify L directly afterwards. Lua functions copied into a
+// replica share their upvalues with the primary state. Go functions called
+// from Lua while Call or Eval runs must not call Get on the same Config.
+func WithStatePool(size int) Option {
+	return func(c *Config) {
+		if size <= 0 {
+			c.pool = nil
+			return
+		}
+		c.pool = &statePool{idle: make(chan *pooledState, size)}
+		for i := 0; i < size; i++ {
+			c.pool.idle <- &pooledState{}
+		}
+	}
+}
+
+// invalidate marks every replica as out of date after the primary state changed
+func (p *statePool) invalidate() {
+	if p != nil {
+		p.version.Add(1)
+	}
+}
+
+// close closes the replicas that are not in use
+func (p *statePool) close() {
+	if p == nil {
+		return
+	}
+	var closed []*pooledState
+	for i := 0; i < cap(p.idle); i++ {
+		select {
+		case ps := <-p.idle:
+			if ps.cfg != nil {
+				ps.cfg.Close()
+				ps.cfg = nil
+			}
+			closed = append(closed, ps)
+		default:
+		}
+	}
+	for _, ps := range closed {
+		p.idle <- ps
+	}
+}
+
+// acquireState returns a replica of the Lua state that is current with the
+// primary state, and a function that returns it to the pool. It returns nil
+// when no pool is configured.
+func (c *Config) acquireState() (*Config, func()) {
+	if c.pool == nil {
+		return nil, nil
+	}
+
+	ps := <-c.pool.idle
+	release := func() { c.pool.idle <- ps }
+	if ps.cfg != nil && ps.version == c.pool.version.Load() {
+		return ps.cfg, release
+	}
+
+	// Replicating reads the primary state, which must not be running a Call
+	// or Eval. An out-of-date replica is used as it is until that finishes.
+	if ps.cfg == nil {
+		c.pool.primary.Lock()
+	} else if !c.pool.primary.TryLock() {
+		return ps.cfg, release
+	}
+	defer c.pool.primary.Unlock()
+
+	if ps.cfg != nil {
+		ps.cfg.Close()
+	}
+	ps.version = c.pool.version.Load()
+	ps.cfg = c.replicate()
+	return ps.cfg, release
+}
+
+// lockPrimary serializes Call and Eval on the primary state of a pooled
+// Config, and returns a function that records the change and unlocks it.
+// Without a pool it only records the change.
+func (c *Config) lockPrimary() func() {
+	if c.pool == nil {
+		return c.changed
+	}
+	c.pool.primary.Lock()
+	return func() {
+		c.changed()
+		c.pool.primary.Unlock()
+	}
+}
+
+// replicate returns a Config sharing c's settings and registrations with a
+// fresh Lua state holding a copy of c's global variables
+func (c *Config) replicate() *Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	r := &Config{
+		L:                lua.NewState(),
+		logger:           c.logger,
+		sandbox:          c.sandbox,
+		middlewares:      c.middlewares,
+		hooks:            c.hooks,
+		functionMetadata: c.functionMetadata,
+		middlewareMap:    c.middlewareMap,
+		resolveMeta:      c.resolveMeta,
+		toStringMeta:     c.toStringMeta,
+		auditFn:          c.auditFn,
+		auditRedactor:    c.auditRedactor,
+		sourcePositions:  c.sourcePositions,
+		validation:       c.validation,
+		validators:       c.validators,
+		validatorFuncs:   c.validatorFuncs,
+		environment:      c.environment,
+		weaklyTyped:      c.weaklyTyped,
+		lenientDecoding:  c.lenientDecoding,
+		zeroBased:        c.zeroBased,
+		schemas:          c.schemas,
+		deterministic:    c.deterministic,
+		internStrings:    c.internStrings,
+		allowedModules:   c.allowedModules,
+	}
+	r.captureBuiltins()
+	if r.allowedModules != nil {
+		r.installRequireAllowlist()
+	}
+
+	cp := &stateCopier{
+		L:    r.L,
+		src:  c.L.G.Global,
+		seen: make(map[lua.LValue]lua.LValue),
+	}
+	copyGlobal := func(k, v lua.LValue) {
+		if name, ok := k.(lua.LString); ok && builtinGlobals[string(name)] {
+			return
+		}
+		r.L.G.Global.RawSet(cp.copy(k), cp.copy(v))
+	}
+	c.forEachGlobal(copyGlobal)
+
+	return r
+}
+
+// stateCopier deep-copies Lua values from one state's globals to another's
+type stateCopier struct {
+	L    *lua.LState
+	src  *lua.LTable
+	seen map[lua.LValue]lua.LValue
+}
+
+// copy returns a copy of v for the destination state. Tables are copied
+// recursively, functions whose environment is the source globals are rebound
+// to the destination globals, and values with no meaning outside their state,
+// such as coroutines and channels, become nil.
+func (cp *stateCopier) copy(v lua.LValue) lua.LValue {
+	if v == cp.src {
+		return cp.L.G.Global
+	}
+	if copied, ok := cp.seen[v]; ok {
+		return copied
+	}
+
+	switch x := v.(type) {
+	case *lua.LTable:
+		t := cp.L.NewTable()
+		cp.seen[v] = t
+		x.ForEach(func(k, v lua.LValue) {
+			t.RawSet(cp.copy(k), cp.copy(v))
+		})
+		t.Metatable = cp.copy(x.Metatable)
+		return t
+	case *lua.LFunction:
+		f := &lua.LFunction{
+			IsG:       x.IsG,
+			Proto:     x.Proto,
+			GFunction: x.GFunction,
+			Upvalues:  x.Upvalues,
+		}
+		cp.seen[v] = f
+		if x.Env != nil {
+			f.Env = cp.copy(x.Env).(*lua.LTable)
+		}
+		return f
+	case *lua.LUserData:
+		ud := cp.L.NewUserData()
+		ud.Value = x.Value
+		cp.seen[v] = ud
+		if x.Env != nil {
+			ud.Env = cp.copy(x.Env).(*lua.LTable)
+		}
+		ud.Metatable = cp.copy(x.Metatable)
+		return ud
+	case *lua.LState, lua.LChannel:
+		return lua.LNil
+	default:
+		return v
+	}
+}
@@ -0,0 +1,167 @@
+package lugo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const poolScript = `
+	server = { host = "localhost", port = 8080 }
+	function add(a, b) return a + b + offset(0) end
+`
+
+func newPoolConfig(t testing.TB, opts ...Option) *Config {
+	cfg := New(opts...)
+	require.NoError(t, cfg.RegisterFunction(context.Background(), "offset", func(x int) int {
+		return x
+	}))
+	require.NoError(t, cfg.DoString(poolScript))
+	return cfg
+}
+
+func TestStatePool(t *testing.T) {
+	cfg := newPoolConfig(t, WithStatePool(4))
+	defer cfg.Close()
+
+	type Server struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var s Server
+			if err := cfg.Get(context.Background(), "server", &s); err != nil {
+				errs <- err
+				return
+			}
+			assert.Equal(t, Server{Host: "localhost", Port: 8080}, s)
+
+			result, err := cfg.Call("add", i, 1)
+			if err != nil {
+				errs <- err
+				return
+			}
+			assert.Equal(t, []interface{}{float64(i + 1)}, result)
+
+			v, err := cfg.Eval("server.port + 1")
+			if err != nil {
+				errs <- err
+				return
+			}
+			assert.Equal(t, float64(8081), v)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	// Replicas pick up changes made to the primary state
+	require.NoError(t, cfg.Set("server.port", 9090))
+	v, err := cfg.Eval("server.port")
+	require.NoError(t, err)
+	assert.Equal(t, float64(9090), v)
+
+	require.NoError(t, cfg.DoString(`function add(a, b) return a * b end`))
+	result, err := cfg.Call("add", 3, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{float64(12)}, result)
+}
+
+func BenchmarkCallParallel(b *testing.B) {
+	b.Run("single", func(b *testing.B) {
+		cfg := newPoolConfig(b)
+		defer cfg.Close()
+
+		// A single state must be serialized by the caller
+		var mu sync.Mutex
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				mu.Lock()
+				_, err := cfg.Call("add", 1, 2)
+				mu.Unlock()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		cfg := newPoolConfig(b, WithStatePool(8))
+		defer cfg.Close()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := cfg.Call("add", 1, 2); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func TestStatePoolLoadDirectory(t *testing.T) {
+	cfg := newPoolConfig(t, WithStatePool(2))
+	defer cfg.Close()
+
+	// Fill both replicas before the load
+	for i := 0; i < 2; i++ {
+		v, err := cfg.Eval("server.port")
+		require.NoError(t, err)
+		assert.Equal(t, float64(8080), v)
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "port.lua"), []byte(`server.port = 9090`), 0644))
+	require.NoError(t, cfg.LoadDirectory(dir))
+
+	for i := 0; i < 2; i++ {
+		v, err := cfg.Eval("server.port")
+		require.NoError(t, err)
+		assert.Equal(t, float64(9090), v)
+	}
+}
+
+func TestStatePoolCallKeepsGlobals(t *testing.T) {
+	cfg := newPoolConfig(t, WithStatePool(2))
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(`
+		function bump() server.port = 99 end
+		function move(port) server.port = port end
+	`))
+
+	type Server struct {
+		Port int `lua:"port"`
+	}
+	var s Server
+	require.NoError(t, cfg.Get(context.Background(), "server", &s))
+	assert.Equal(t, 8080, s.Port)
+
+	// Globals assigned by Call and Eval are seen by later calls
+	_, err := cfg.Call("bump")
+	require.NoError(t, err)
+	require.NoError(t, cfg.Get(context.Background(), "server", &s))
+	assert.Equal(t, 99, s.Port)
+
+	_, err = cfg.Eval("move(7)")
+	require.NoError(t, err)
+	v, err := cfg.Eval("server.port")
+	require.NoError(t, err)
+	assert.Equal(t, float64(7), v)
+	require.NoError(t, cfg.Get(context.Background(), "server", &s))
+	assert.Equal(t, 7, s.Port)
+}
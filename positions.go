@@ -0,0 +1,127 @@
+package lugo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// recordSourcePositions parses filename and remembers the line on which each
+// global key is assigned, so validation errors can point at the source.
+// Keys are dotted paths such as "server.port"; array items use their Lua
+// index ("servers.1.host"). gopher-lua has no per-instruction debug hook, so
+// positions come from the syntax tree: assignments at the top level of the
+// chunk and inside do/if blocks, including nested table constructors.
+// Parse errors are ignored here and reported when the file is executed.
+func (c *Config) recordSourcePositions(filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	c.recordChunkPositions(filename, f)
+}
+
+// recordChunkPositions parses the source read from r and remembers where each
+// global it assigns is set, using name as the file name
+func (c *Config) recordChunkPositions(name string, r io.Reader) {
+	chunk, err := parse.Parse(r, name)
+	if err != nil {
+		return
+	}
+
+	positions := make(map[string]string)
+	recordStmts(name, chunk, positions)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sourcePositions == nil {
+		c.sourcePositions = make(map[string]string)
+	}
+	for path, pos := range positions {
+		c.sourcePositions[path] = pos
+	}
+}
+
+// recordStmts records the assignments in stmts
+func recordStmts(filename string, stmts []ast.Stmt, positions map[string]string) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range s.Lhs {
+				path, ok := assignPath(lhs)
+				if !ok || i >= len(s.Rhs) {
+					continue
+				}
+				recordExpr(filename, path, s.Rhs[i], positions)
+			}
+		case *ast.DoBlockStmt:
+			recordStmts(filename, s.Stmts, positions)
+		case *ast.IfStmt:
+			recordStmts(filename, s.Then, positions)
+			recordStmts(filename, s.Else, positions)
+		}
+	}
+}
+
+// recordExpr records the position of expr at path and, for table
+// constructors, of each of its fields
+func recordExpr(filename, path string, expr ast.Expr, positions map[string]string) {
+	positions[path] = fmt.Sprintf("%s:%d", filename, expr.Line())
+
+	table, ok := expr.(*ast.TableExpr)
+	if !ok {
+		return
+	}
+
+	index := 0
+	for _, field := range table.Fields {
+		var key string
+		switch k := field.Key.(type) {
+		case nil:
+			index++
+			key = strconv.Itoa(index)
+		case *ast.StringExpr:
+			key = k.Value
+		case *ast.NumberExpr:
+			key = k.Value
+		default:
+			continue
+		}
+		recordExpr(filename, path+"."+key, field.Value, positions)
+	}
+}
+
+// assignPath returns the dotted path assigned to by a global or field
+// assignment target such as server.tls.enabled
+func assignPath(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		return e.Value, true
+	case *ast.AttrGetExpr:
+		parent, ok := assignPath(e.Object)
+		if !ok {
+			return "", false
+		}
+		switch k := e.Key.(type) {
+		case *ast.StringExpr:
+			return parent + "." + k.Value, true
+		case *ast.NumberExpr:
+			return parent + "." + k.Value, true
+		}
+	}
+	return "", false
+}
+
+// withSourcePosition annotates err with the source location recorded for path
+func (c *Config) withSourcePosition(path string, err error) error {
+	if pos, ok := c.sourcePositions[path]; ok {
+		return fmt.Errorf("%w (set at %s)", err, pos)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package lugo
+
+import "time"
+
+// ProfileReport breaks down where the time of the last LoadFile and Get was
+// spent. LoadFile starts a new report with its parse and execute times; a Get
+// that follows fills in the validate and convert times.
+type ProfileReport struct {
+	// File is the file most recently loaded
+	File string
+	// Global is the global most recently read by Get
+	Global string
+	// Parse is the time spent compiling the file
+	Parse time.Duration
+	// Execute is the time spent running the compiled chunk
+	Execute time.Duration
+	// Validate is the time spent checking types and validate tags in Get
+	Validate time.Duration
+	// Convert is the time spent decoding Lua values into the target in Get
+	Convert time.Duration
+}
+
+// Total returns the time spent across all phases
+func (p ProfileReport) Total() time.Duration {
+	return p.Parse + p.Execute + p.Validate + p.Convert
+}
+
+// WithProfiling records how long LoadFile and Get spend in each phase,
+// reported by LastProfile
+func WithProfiling(enabled bool) Option {
+	return func(c *Config) {
+		c.profiling = enabled
+	}
+}
+
+// LastProfile returns the phase timings of the last LoadFile and Get. It is
+// empty unless profiling was enabled with WithProfiling.
+func (c *Config) LastProfile() ProfileReport {
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+	return c.profile
+}
+
+// recordProfile applies update to the current profile report
+func (c *Config) recordProfile(update func(*ProfileReport)) {
+	c.profileMu.Lock()
+	defer c.profileMu.Unlock()
+	update(&c.profile)
+}
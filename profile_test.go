@@ -0,0 +1,58 @@
+package lugo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`
+		local servers = {}
+		for i = 1, 500 do
+			servers[i] = { host = "host" .. i, port = 8000 + i }
+		end
+		config = { name = "svc", servers = servers }
+	`), 0644))
+
+	type Server struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+	type Config struct {
+		Name    string   `lua:"name"`
+		Servers []Server `lua:"servers"`
+	}
+
+	// Disabled by default
+	plain := New()
+	defer plain.Close()
+	require.NoError(t, plain.LoadFile(context.Background(), path))
+	assert.Equal(t, ProfileReport{}, plain.LastProfile())
+
+	cfg := New(WithProfiling(true))
+	defer cfg.Close()
+
+	require.NoError(t, cfg.LoadFile(context.Background(), path))
+	report := cfg.LastProfile()
+	assert.Equal(t, path, report.File)
+	assert.Positive(t, report.Parse)
+	assert.Positive(t, report.Execute)
+	assert.Zero(t, report.Convert)
+
+	var c Config
+	require.NoError(t, cfg.Get(context.Background(), "config", &c))
+	assert.Len(t, c.Servers, 500)
+
+	report = cfg.LastProfile()
+	assert.Equal(t, "config", report.Global)
+	assert.Positive(t, report.Parse)
+	assert.Positive(t, report.Validate)
+	assert.Positive(t, report.Convert)
+	assert.Equal(t, report.Parse+report.Execute+report.Validate+report.Convert, report.Total())
+}
@@ -0,0 +1,92 @@
+package lugo
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+// GlobalWatcher is called when a watched global variable is assigned a new value
+type GlobalWatcher func(old, new lua.LValue)
+
+// WatchGlobal calls cb whenever the global name is assigned a different value,
+// whether the assignment comes from executed Lua code or from SetGlobal.
+//
+// Lua only consults __newindex for keys that are absent from a table, so the
+// watched value is moved out of the globals table into a shadow table that
+// the globals metatable reads through (__index) and writes through
+// (__newindex). Reads are unaffected; rawget and rawset on _G bypass the watch.
+// Callbacks run synchronously on the Lua state and must not block.
+func (c *Config) WatchGlobal(name string, cb GlobalWatcher) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.globalWatchers == nil {
+		c.installGlobalWatch()
+	}
+
+	if _, watched := c.globalWatchers[name]; !watched {
+		globals := c.L.G.Global
+		c.watchedGlobals.RawSetString(name, globals.RawGetString(name))
+		globals.RawSetString(name, lua.LNil)
+	}
+	c.globalWatchers[name] = append(c.globalWatchers[name], cb)
+}
+
+// installGlobalWatch sets up the shadow table and the globals metatable,
+// chaining to any metatable already installed on the globals table
+func (c *Config) installGlobalWatch() {
+	L := c.L
+	globals := L.G.Global
+
+	c.globalWatchers = make(map[string][]GlobalWatcher)
+	c.watchedGlobals = L.NewTable()
+
+	mt, ok := L.GetMetatable(globals).(*lua.LTable)
+	if !ok {
+		mt = L.NewTable()
+	}
+	prevIndex := mt.RawGetString("__index")
+	prevNewIndex := mt.RawGetString("__newindex")
+
+	// Unwatched lookups fall through the shadow table to the previous __index
+	if prevIndex != lua.LNil {
+		shadowMeta := L.NewTable()
+		shadowMeta.RawSetString("__index", prevIndex)
+		L.SetMetatable(c.watchedGlobals, shadowMeta)
+	}
+	mt.RawSetString("__index", c.watchedGlobals)
+
+	mt.RawSetString("__newindex", L.NewFunction(func(L *lua.LState) int {
+		table := L.CheckTable(1)
+		key := L.Get(2)
+		value := L.Get(3)
+
+		if name, ok := key.(lua.LString); ok {
+			if watchers := c.globalWatchers[string(name)]; len(watchers) > 0 {
+				old := c.watchedGlobals.RawGet(key)
+				c.watchedGlobals.RawSet(key, value)
+				if old != value {
+					for _, watcher := range watchers {
+						watcher(old, value)
+					}
+				}
+				return 0
+			}
+		}
+
+		switch next := prevNewIndex.(type) {
+		case *lua.LFunction:
+			L.Push(next)
+			L.Push(table)
+			L.Push(key)
+			L.Push(value)
+			L.Call(3, 0)
+		case *lua.LTable:
+			L.SetTable(next, key, value)
+		default:
+			table.RawSet(key, value)
+		}
+		return 0
+	}))
+
+	L.SetMetatable(globals, mt)
+}
@@ -0,0 +1,78 @@
+package lugo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestWatchGlobal(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`level = "info"`))
+
+	type change struct{ old, new lua.LValue }
+	var changes []change
+	cfg.WatchGlobal("level", func(old, new lua.LValue) {
+		changes = append(changes, change{old, new})
+	})
+
+	// Reads still see the current value
+	require.NoError(t, cfg.DoString(`assert(level == "info")`))
+
+	require.NoError(t, cfg.DoString(`
+		level = "debug"
+		level = "debug"
+		function quiet() level = "error" end
+		quiet()
+		other = 1
+	`))
+	assert.Equal(t, []change{
+		{lua.LString("info"), lua.LString("debug")},
+		{lua.LString("debug"), lua.LString("error")},
+	}, changes)
+
+	// Go-side reads and writes go through the same path
+	assert.Equal(t, lua.LString("error"), cfg.L.GetGlobal("level"))
+	cfg.L.SetGlobal("level", lua.LString("warn"))
+	require.Len(t, changes, 3)
+	assert.Equal(t, lua.LString("warn"), changes[2].new)
+
+	// Unwatched globals behave as before
+	assert.Equal(t, lua.LNumber(1), cfg.L.GetGlobal("other"))
+
+	// Globals that do not exist yet can be watched too
+	var created lua.LValue
+	cfg.WatchGlobal("later", func(old, new lua.LValue) { created = new })
+	require.NoError(t, cfg.DoString(`later = { enabled = true }`))
+	require.IsType(t, &lua.LTable{}, created)
+}
+
+func TestWatchedGlobalsAreGlobals(t *testing.T) {
+	cfg := New(WithTimeoutPerLoad(50 * time.Millisecond))
+	defer cfg.Close()
+
+	require.NoError(t, cfg.DoString(`app = 1`))
+	var seen []lua.LValue
+	cfg.WatchGlobal("app", func(old, new lua.LValue) { seen = append(seen, new) })
+
+	assert.Equal(t, []string{"app"}, cfg.ListGlobals())
+	exported, err := cfg.ExportLua()
+	require.NoError(t, err)
+	assert.Equal(t, "app = 1\n", exported)
+
+	// A timed-out load rolls back watched globals and tells their watchers
+	path := filepath.Join(t.TempDir(), "spin.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`app = 2; while true do end`), 0644))
+	err = cfg.LoadFile(context.Background(), path)
+	require.True(t, IsErrorCode(err, ErrTimeout), "got %v", err)
+	assert.Equal(t, lua.LNumber(1), cfg.L.GetGlobal("app"))
+	assert.Equal(t, []lua.LValue{lua.LNumber(2), lua.LNumber(1)}, seen)
+}
@@ -0,0 +1,145 @@
+package lugo
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// pathArgs lists, for each guarded file function, the positions of its path
+// arguments. Arguments that are not strings, such as file handles passed to
+// io.input, are left alone.
+var pathArgs = map[string]map[string][]int{
+	"": {
+		"dofile":   {1},
+		"loadfile": {1},
+	},
+	"io": {
+		"open":   {1},
+		"lines":  {1},
+		"input":  {1},
+		"output": {1},
+	},
+	"os": {
+		"remove": {1},
+		"rename": {1, 2},
+	},
+}
+
+// installPathGuards wraps the Lua functions that take file paths so every
+// path is checked against Sandbox.AllowedPaths and Sandbox.BlockedPaths
+// before the original function runs. It is installed once; the sandbox is
+// consulted on every call.
+func (c *Config) installPathGuards() {
+	if c.pathGuards {
+		return
+	}
+	c.pathGuards = true
+
+	for lib, funcs := range pathArgs {
+		var table *lua.LTable
+		if lib == "" {
+			table = c.L.G.Global
+		} else if t, ok := c.L.GetGlobal(lib).(*lua.LTable); ok {
+			table = t
+		} else {
+			continue
+		}
+
+		for name, positions := range funcs {
+			original, ok := table.RawGetString(name).(*lua.LFunction)
+			if !ok {
+				continue
+			}
+			table.RawSetString(name, c.L.NewFunction(c.guardPaths(original, positions)))
+		}
+	}
+}
+
+// guardPaths returns a function that checks the path arguments at positions
+// before calling original with all of its arguments
+func (c *Config) guardPaths(original *lua.LFunction, positions []int) lua.LGFunction {
+	return func(L *lua.LState) int {
+		for _, pos := range positions {
+			if path, ok := L.Get(pos).(lua.LString); ok {
+				if err := c.checkSandboxPath(string(path)); err != nil {
+					L.RaiseError("%v", err)
+					return 0
+				}
+			}
+		}
+
+		nargs := L.GetTop()
+		L.Insert(original, 1)
+		L.Call(nargs, lua.MultRet)
+		return L.GetTop()
+	}
+}
+
+// checkSandboxPath reports whether the sandbox permits access to path. A path
+// under any BlockedPaths entry is denied; otherwise, if AllowedPaths is set,
+// the path must be under one of its entries.
+func (c *Config) checkSandboxPath(path string) error {
+	if c.sandbox == nil {
+		return nil
+	}
+
+	resolved, err := resolveSandboxPath(path)
+	if err != nil {
+		return &Error{
+			Code:    ErrSandbox,
+			Message: fmt.Sprintf("cannot resolve path %s", path),
+			Cause:   err,
+		}
+	}
+
+	for _, blocked := range c.sandbox.BlockedPaths {
+		if dir, err := resolveSandboxPath(blocked); err == nil && pathWithin(dir, resolved) {
+			return &Error{
+				Code:    ErrSandbox,
+				Message: fmt.Sprintf("access to %s is blocked by the sandbox", path),
+			}
+		}
+	}
+
+	if len(c.sandbox.AllowedPaths) == 0 {
+		return nil
+	}
+	for _, allowed := range c.sandbox.AllowedPaths {
+		if dir, err := resolveSandboxPath(allowed); err == nil && pathWithin(dir, resolved) {
+			return nil
+		}
+	}
+	return &Error{
+		Code:    ErrSandbox,
+		Message: fmt.Sprintf("access to %s is not allowed by the sandbox", path),
+	}
+}
+
+// resolveSandboxPath returns the absolute form of path with symlinks
+// resolved, so links cannot be used to escape the allowed directories. For a
+// path that does not exist yet, the symlinks of its directory are resolved.
+func resolveSandboxPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs)), nil
+	}
+	return abs, nil
+}
+
+// pathWithin reports whether path is dir or inside it
+func pathWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,64 @@
+package lugo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandboxPaths(t *testing.T) {
+	allowed := t.TempDir()
+	blocked := filepath.Join(allowed, "secrets")
+	outside := t.TempDir()
+	require.NoError(t, os.Mkdir(blocked, 0755))
+
+	require.NoError(t, os.WriteFile(filepath.Join(allowed, "motd.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(allowed, "extra.lua"), []byte(`return 42`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(blocked, "key.txt"), []byte("s3cr3t"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "other.txt"), []byte("nope"), 0644))
+
+	cfg := New(WithSandbox(&Sandbox{
+		EnableFileIO: true,
+		AllowedPaths: []string{allowed},
+		BlockedPaths: []string{blocked},
+	}))
+	defer cfg.Close()
+
+	// Loading applies the sandbox, installing the path checks
+	main := filepath.Join(allowed, "main.lua")
+	require.NoError(t, os.WriteFile(main, []byte(`
+		local f = assert(io.open(MOTD))
+		motd = f:read("*a")
+		f:close()
+		extra = dofile(EXTRA)
+	`), 0644))
+	require.NoError(t, cfg.SetGlobal("MOTD", filepath.Join(allowed, "motd.txt")))
+	require.NoError(t, cfg.SetGlobal("EXTRA", filepath.Join(allowed, "extra.lua")))
+	require.NoError(t, cfg.LoadFile(context.Background(), main))
+
+	var motd string
+	var extra int
+	require.NoError(t, cfg.GetGlobal("motd", &motd))
+	require.NoError(t, cfg.GetGlobal("extra", &extra))
+	assert.Equal(t, "hello", motd)
+	assert.Equal(t, 42, extra)
+
+	denied := map[string]string{
+		"blocked inside allowed": `io.open("` + filepath.Join(blocked, "key.txt") + `")`,
+		"outside allowed":        `io.open("` + filepath.Join(outside, "other.txt") + `")`,
+		"traversal":              `io.open("` + allowed + `/secrets/../secrets/key.txt")`,
+		"loadfile":               `loadfile("` + filepath.Join(outside, "other.txt") + `")`,
+		"dofile":                 `dofile("` + filepath.Join(blocked, "key.txt") + `")`,
+		"rename target":          `os.rename("` + filepath.Join(allowed, "motd.txt") + `", "` + filepath.Join(outside, "motd.txt") + `")`,
+	}
+	for name, script := range denied {
+		err := cfg.DoString(script)
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), "sandbox", name)
+	}
+	assert.FileExists(t, filepath.Join(allowed, "motd.txt"))
+}
@@ -4,9 +4,19 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-// SchemaValidator defines validation rules for configuration
+// SchemaValidator defines validation rules for configuration.
+//
+// Rules for Required, Patterns, Ranges, CustomValidators and Nested are keyed
+// by field, matching either the Go field name or the Lua key, and failures
+// name the Lua key. A key containing "." or "*" is instead treated as a path
+// such as "databases.*.port": each segment matches a Go field name or lua
+// tag, a map key, or a slice index, and "*" matches every field, key, or
+// element.
 type SchemaValidator struct {
 	// Required fields
 	Required []string
@@ -18,7 +28,8 @@ type SchemaValidator struct {
 	}
 	// Custom validation functions
 	CustomValidators map[string]func(interface{}) error
-	// Nested validators for complex types
+	// Nested validators for struct fields, or for every element of a
+	// slice, array or map field
 	Nested map[string]*SchemaValidator
 }
 
@@ -71,10 +82,13 @@ func (sv *SchemaValidator) Validate(cfg interface{}) error {
 	typ := val.Type()
 
 	// Check required fields
-	for _, field := range sv.Required {
-		f := val.FieldByName(field)
-		if !f.IsValid() || f.IsZero() {
-			return fmt.Errorf("required field %s is missing or empty", field)
+	for _, name := range sv.Required {
+		f, field, ok := schemaField(val, name)
+		if !ok || f.IsZero() {
+			if ok {
+				name = luaFieldName(field)
+			}
+			return fmt.Errorf("required field %s is missing or empty", name)
 		}
 	}
 
@@ -82,17 +96,17 @@ func (sv *SchemaValidator) Validate(cfg interface{}) error {
 	for i := 0; i < val.NumField(); i++ {
 		field := typ.Field(i)
 		fieldVal := val.Field(i)
-		fieldName := field.Name
+		fieldName := luaFieldName(field)
 
 		// Check patterns
-		if re, ok := sv.Patterns[fieldName]; ok && fieldVal.Kind() == reflect.String {
+		if re, ok := schemaRule(sv.Patterns, field); ok && fieldVal.Kind() == reflect.String {
 			if !re.MatchString(fieldVal.String()) {
 				return fmt.Errorf("field %s does not match pattern %s", fieldName, re)
 			}
 		}
 
 		// Check ranges
-		if r, ok := sv.Ranges[fieldName]; ok {
+		if r, ok := schemaRule(sv.Ranges, field); ok {
 			var num float64
 			switch fieldVal.Kind() {
 			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -106,19 +120,216 @@ func (sv *SchemaValidator) Validate(cfg interface{}) error {
 		}
 
 		// Run custom validators
-		if validator, ok := sv.CustomValidators[fieldName]; ok {
+		if validator, ok := schemaRule(sv.CustomValidators, field); ok {
 			if err := validator(fieldVal.Interface()); err != nil {
 				return fmt.Errorf("field %s: %w", fieldName, err)
 			}
 		}
 
 		// Check nested validators
-		if nested, ok := sv.Nested[fieldName]; ok && fieldVal.Kind() == reflect.Struct {
-			if err := nested.Validate(fieldVal.Interface()); err != nil {
-				return fmt.Errorf("field %s: %w", fieldName, err)
+		if nested, ok := schemaRule(sv.Nested, field); ok {
+			if err := nested.validateNested(fieldVal, fieldName); err != nil {
+				return err
 			}
 		}
 	}
 
+	return sv.validatePaths(val)
+}
+
+// validateNested validates v, a struct or a slice, array or map of structs,
+// against sv. path names v in errors.
+func (sv *SchemaValidator) validateNested(v reflect.Value, path string) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if err := sv.Validate(v.Interface()); err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := sv.validateNested(v.Index(i), path+"."+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			if err := sv.validateNested(v.MapIndex(k), fmt.Sprintf("%s.%v", path, k)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
+
+// validatePaths applies the path-keyed rules to every matching value
+func (sv *SchemaValidator) validatePaths(val reflect.Value) error {
+	for _, key := range sortedPathKeys(sv.Patterns) {
+		re := sv.Patterns[key]
+		for _, m := range matchPath(val, strings.Split(key, "."), "") {
+			if m.value.Kind() != reflect.String {
+				continue
+			}
+			if !re.MatchString(m.value.String()) {
+				return fmt.Errorf("field %s does not match pattern %s", m.path, re)
+			}
+		}
+	}
+
+	for _, key := range sortedPathKeys(sv.Ranges) {
+		r := sv.Ranges[key]
+		for _, m := range matchPath(val, strings.Split(key, "."), "") {
+			num, ok := numericValue(m.value)
+			if !ok {
+				return fmt.Errorf("field %s is not numeric", m.path)
+			}
+			if num < r.Min || num > r.Max {
+				return fmt.Errorf("field %s must be between %f and %f", m.path, r.Min, r.Max)
+			}
+		}
+	}
+
+	for _, key := range sortedPathKeys(sv.CustomValidators) {
+		validator := sv.CustomValidators[key]
+		for _, m := range matchPath(val, strings.Split(key, "."), "") {
+			if err := validator(m.value.Interface()); err != nil {
+				return fmt.Errorf("field %s: %w", m.path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// schemaRule returns the rule for field, keyed by its Go name or Lua key
+func schemaRule[V any](rules map[string]V, field reflect.StructField) (V, bool) {
+	if rule, ok := rules[field.Name]; ok {
+		return rule, true
+	}
+	rule, ok := rules[luaFieldName(field)]
+	return rule, ok
+}
+
+// schemaField returns the field of the struct val named by its Go name or
+// Lua key
+func schemaField(val reflect.Value, name string) (reflect.Value, reflect.StructField, bool) {
+	if field, ok := val.Type().FieldByName(name); ok {
+		return val.FieldByIndex(field.Index), field, true
+	}
+	for i := 0; i < val.NumField(); i++ {
+		if field := val.Type().Field(i); field.IsExported() && luaFieldName(field) == name {
+			return val.Field(i), field, true
+		}
+	}
+	return reflect.Value{}, reflect.StructField{}, false
+}
+
+// pathMatch is a value found by resolving a rule path
+type pathMatch struct {
+	path  string
+	value reflect.Value
+}
+
+// isPathRule reports whether a rule key is a path rather than a field name
+func isPathRule(key string) bool {
+	return strings.ContainsAny(key, ".*")
+}
+
+// sortedPathKeys returns the path-rule keys of a rule map in a stable order
+func sortedPathKeys[V any](rules map[string]V) []string {
+	var keys []string
+	for key := range rules {
+		if isPathRule(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// matchPath returns every value under v addressed by segments
+func matchPath(v reflect.Value, segments []string, prefix string) []pathMatch {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if len(segments) == 0 {
+		return []pathMatch{{path: prefix, value: v}}
+	}
+
+	seg, rest := segments[0], segments[1:]
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+
+	var matches []pathMatch
+	switch v.Kind() {
+	case reflect.Struct:
+		typ := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := luaFieldName(field)
+			if seg == "*" || seg == field.Name || seg == name {
+				matches = append(matches, matchPath(v.Field(i), rest, join(name))...)
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if seg == "*" || seg == k.String() {
+				matches = append(matches, matchPath(v.MapIndex(k), rest, join(k.String()))...)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if seg == "*" || seg == strconv.Itoa(i) {
+				matches = append(matches, matchPath(v.Index(i), rest, join(strconv.Itoa(i)))...)
+			}
+		}
+	}
+
+	return matches
+}
+
+// luaFieldName returns the Lua key used for a struct field
+func luaFieldName(field reflect.StructField) string {
+	if name := field.Tag.Get("lua"); name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
+
+// numericValue returns the value of a numeric kind as a float64
+func numericValue(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
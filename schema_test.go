@@ -1,6 +1,7 @@
 package lugo
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -109,3 +110,117 @@ func TestSchemaValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestSchemaValidationWildcards(t *testing.T) {
+	type Database struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+	type Config struct {
+		Databases map[string]Database `lua:"databases"`
+		Replicas  []Database          `lua:"replicas"`
+	}
+
+	validator := NewSchemaValidator()
+	validator.AddRange("databases.*.port", 1, 65535)
+	require.NoError(t, validator.AddPattern("replicas.*.host", `^[a-z0-9\.-]+$`))
+
+	valid := Config{
+		Databases: map[string]Database{
+			"primary":   {Host: "db1", Port: 5432},
+			"analytics": {Host: "db2", Port: 5433},
+			"cache":     {Host: "db3", Port: 6379},
+		},
+		Replicas: []Database{{Host: "replica-1"}},
+	}
+	assert.NoError(t, validator.Validate(valid))
+
+	invalid := valid
+	invalid.Databases = map[string]Database{
+		"primary": {Host: "db1", Port: 5432},
+		"broken":  {Host: "db2", Port: 70000},
+	}
+	err := validator.Validate(invalid)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "databases.broken.port")
+
+	invalid = valid
+	invalid.Replicas = []Database{{Host: "ok"}, {Host: "Bad Host"}}
+	err = validator.Validate(invalid)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "replicas.1.host")
+}
+
+func TestSchemaWithGet(t *testing.T) {
+	type Server struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+
+	// Rules may use the Go field name or the Lua key
+	schema := NewSchemaValidator()
+	schema.Required = []string{"host"}
+	schema.AddRange("Port", 1, 65535)
+
+	cfg := New(WithSchema("server", schema))
+	defer cfg.Close()
+
+	require.NoError(t, cfg.L.DoString(`server = { host = "localhost", port = 8080 }`))
+	var server Server
+	require.NoError(t, cfg.Get(context.Background(), "server", &server))
+	assert.Equal(t, Server{Host: "localhost", Port: 8080}, server)
+
+	require.NoError(t, cfg.L.DoString(`server = { host = "localhost", port = 70000 }`))
+	err := cfg.Get(context.Background(), "server", &server)
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrValidation))
+	assert.Contains(t, err.Error(), "field port must be between")
+
+	require.NoError(t, cfg.L.DoString(`server = { port = 80 }`))
+	err = cfg.Get(context.Background(), "server", &Server{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "required field host is missing or empty")
+
+	// GetInto applies the schema too
+	err = cfg.GetInto(context.Background(), "server", &Server{}, DecodeOptions{})
+	assert.True(t, IsErrorCode(err, ErrValidation))
+
+	// Other globals are not checked
+	require.NoError(t, cfg.L.DoString(`other = { port = 70000 }`))
+	assert.NoError(t, cfg.Get(context.Background(), "other", &server))
+}
+
+func TestSchemaNestedCollections(t *testing.T) {
+	type Server struct {
+		Host string `lua:"host"`
+		Port int    `lua:"port"`
+	}
+	type Config struct {
+		Servers []Server           `lua:"servers"`
+		Pools   map[string]*Server `lua:"pools"`
+	}
+
+	server := NewSchemaValidator()
+	server.Required = []string{"Host"}
+	validator := NewSchemaValidator()
+	validator.AddNestedValidator("Servers", server)
+	validator.AddNestedValidator("pools", server)
+
+	valid := Config{
+		Servers: []Server{{Host: "a"}, {Host: "b"}},
+		Pools:   map[string]*Server{"primary": {Host: "c"}, "unused": nil},
+	}
+	assert.NoError(t, validator.Validate(valid))
+
+	invalid := valid
+	invalid.Servers = []Server{{Host: "a"}, {Port: 80}}
+	err := validator.Validate(invalid)
+	require.Error(t, err)
+	assert.Equal(t, "field servers.1: required field host is missing or empty", err.Error())
+
+	invalid = valid
+	invalid.Pools = map[string]*Server{"primary": {Port: 80}}
+	err = validator.Validate(invalid)
+	require.Error(t, err)
+	assert.Equal(t, "field pools.primary: required field host is missing or empty", err.Error())
+}
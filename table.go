@@ -0,0 +1,191 @@
+package lugo
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// TableBuilder batches mutations against a single global Lua table
+type TableBuilder struct {
+	cfg     *Config
+	name    string
+	table   *lua.LTable
+	created map[*lua.LTable]bool
+	err     error
+}
+
+// RegisterGlobalTable returns a builder for the named global table. The
+// mutations are collected in a table of their own and leave the global
+// unchanged until Build, which applies them on top of the table the global
+// holds, if any.
+func (c *Config) RegisterGlobalTable(name string) *TableBuilder {
+	tb := &TableBuilder{
+		cfg:     c,
+		name:    name,
+		table:   c.L.NewTable(),
+		created: make(map[*lua.LTable]bool),
+	}
+
+	if name == "" {
+		tb.err = &Error{
+			Code:    ErrInvalidType,
+			Message: "table name cannot be empty",
+		}
+	}
+
+	return tb
+}
+
+// Set sets a value at a dotted path, creating intermediate tables as needed
+func (tb *TableBuilder) Set(path string, value interface{}) *TableBuilder {
+	if tb.err != nil {
+		return tb
+	}
+
+	lv, err := tb.cfg.goToLua(value)
+	if err != nil {
+		tb.err = &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("failed to convert value for '%s'", path),
+			Cause:   err,
+		}
+		return tb
+	}
+
+	parts := strings.Split(path, ".")
+	parent, err := tb.walk(parts[:len(parts)-1])
+	if err != nil {
+		tb.err = err
+		return tb
+	}
+
+	parent.RawSetString(parts[len(parts)-1], lv)
+	return tb
+}
+
+// Merge sets every entry of values. Nested maps are merged into existing
+// sub-tables rather than replacing them.
+func (tb *TableBuilder) Merge(values map[string]interface{}) *TableBuilder {
+	return tb.merge("", values)
+}
+
+func (tb *TableBuilder) merge(prefix string, values map[string]interface{}) *TableBuilder {
+	for key, value := range values {
+		if tb.err != nil {
+			return tb
+		}
+
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			if _, err := tb.walk(strings.Split(path, ".")); err != nil {
+				tb.err = err
+				return tb
+			}
+			tb.merge(path, nested)
+			continue
+		}
+
+		tb.Set(path, value)
+	}
+	return tb
+}
+
+// Build applies the mutations to a copy of the global's table and publishes
+// it as the global. It returns the first error encountered while building,
+// in which case the global is left unchanged.
+func (tb *TableBuilder) Build() error {
+	if tb.err != nil {
+		return tb.err
+	}
+
+	c := tb.cfg
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, _ := c.L.GetGlobal(tb.name).(*lua.LTable)
+	table, err := tb.apply(existing, tb.table, nil)
+	if err != nil {
+		return err
+	}
+	c.L.SetGlobal(tb.name, table)
+	c.changed()
+
+	return nil
+}
+
+// Table returns the table holding the values set so far, which Build applies
+// to the global
+func (tb *TableBuilder) Table() *lua.LTable {
+	return tb.table
+}
+
+// apply returns a copy of base, which may be nil, with the entries of overlay
+// set on it. Tables the builder created along a path are applied to the
+// matching sub-tables of base rather than replacing them.
+func (tb *TableBuilder) apply(base, overlay *lua.LTable, path []string) (*lua.LTable, error) {
+	result := tb.cfg.L.NewTable()
+	if base != nil {
+		base.ForEach(func(k, v lua.LValue) { result.RawSet(k, v) })
+		result.Metatable = base.Metatable
+	}
+
+	var err error
+	overlay.ForEach(func(k, v lua.LValue) {
+		if err != nil {
+			return
+		}
+		nested, ok := v.(*lua.LTable)
+		if !ok || !tb.created[nested] {
+			result.RawSet(k, v)
+			return
+		}
+
+		parts := append(path[:len(path):len(path)], k.String())
+		current := result.RawGet(k)
+		sub, isTable := current.(*lua.LTable)
+		if current != lua.LNil && !isTable {
+			err = &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("path part '%s' exists but is not a table", strings.Join(parts, ".")),
+			}
+			return
+		}
+
+		var merged *lua.LTable
+		if merged, err = tb.apply(sub, nested, parts); err == nil {
+			result.RawSet(k, merged)
+		}
+	})
+	return result, err
+}
+
+// walk returns the table at the given path, creating missing tables
+func (tb *TableBuilder) walk(parts []string) (*lua.LTable, error) {
+	table := tb.table
+	for i, part := range parts {
+		next := table.RawGetString(part)
+		if next == lua.LNil {
+			newTable := tb.cfg.L.NewTable()
+			tb.created[newTable] = true
+			table.RawSetString(part, newTable)
+			table = newTable
+			continue
+		}
+
+		var ok bool
+		table, ok = next.(*lua.LTable)
+		if !ok {
+			return nil, &Error{
+				Code:    ErrInvalidType,
+				Message: fmt.Sprintf("path part '%s' exists but is not a table", strings.Join(parts[:i+1], ".")),
+			}
+		}
+	}
+	return table, nil
+}
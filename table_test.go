@@ -0,0 +1,78 @@
+package lugo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableBuilder(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	err := cfg.RegisterGlobalTable("config").
+		Set("name", "builder").
+		Set("server.host", "localhost").
+		Set("server.port", 8080).
+		Set("server.tls.enabled", true).
+		Merge(map[string]interface{}{
+			"server": map[string]interface{}{
+				"timeout": 30,
+			},
+			"tags": []string{"a", "b"},
+		}).
+		Build()
+	require.NoError(t, err)
+
+	var config struct {
+		Name   string `lua:"name"`
+		Server struct {
+			Host    string `lua:"host"`
+			Port    int    `lua:"port"`
+			Timeout int    `lua:"timeout"`
+			TLS     struct {
+				Enabled bool `lua:"enabled"`
+			} `lua:"tls"`
+		} `lua:"server"`
+		Tags []string `lua:"tags"`
+	}
+	require.NoError(t, cfg.Get(context.Background(), "config", &config))
+
+	assert.Equal(t, "builder", config.Name)
+	assert.Equal(t, "localhost", config.Server.Host)
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, 30, config.Server.Timeout)
+	assert.True(t, config.Server.TLS.Enabled)
+	assert.Equal(t, []string{"a", "b"}, config.Tags)
+
+	// Reopening the table mutates the existing global
+	require.NoError(t, cfg.RegisterGlobalTable("config").Set("name", "updated").Build())
+	require.NoError(t, cfg.Get(context.Background(), "config", &config))
+	assert.Equal(t, "updated", config.Name)
+	assert.Equal(t, 8080, config.Server.Port)
+
+	// Nothing is applied before Build, and a failed Build applies nothing
+	tb := cfg.RegisterGlobalTable("config").Set("server.port", 9090).Set("name.first", "x")
+	port, err := cfg.GetRaw("config.server.port")
+	require.NoError(t, err)
+	assert.Equal(t, "8080", port.String())
+	err = tb.Build()
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+	port, err = cfg.GetRaw("config.server.port")
+	require.NoError(t, err)
+	assert.Equal(t, "8080", port.String())
+
+	t.Run("path through non-table", func(t *testing.T) {
+		err := cfg.RegisterGlobalTable("config").Set("name.first", "x").Build()
+		require.Error(t, err)
+		assert.True(t, IsErrorCode(err, ErrInvalidType))
+	})
+
+	t.Run("empty name", func(t *testing.T) {
+		err := cfg.RegisterGlobalTable("").Set("a", 1).Build()
+		require.Error(t, err)
+	})
+}
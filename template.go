@@ -2,17 +2,43 @@ package lugo
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"os"
+	"strings"
 	"text/template"
+	"time"
 )
 
 // ProcessTemplate processes a Lua configuration file as a template
 func (c *Config) ProcessTemplate(filename string, tcfg TemplateConfig) error {
-	content, err := os.ReadFile(filename)
+	return c.ProcessTemplateContext(context.Background(), filename, tcfg)
+}
+
+// ProcessTemplateContext processes a Lua configuration file as a template,
+// exposing values taken from ctx by tcfg.ContextExtractor through the ctx
+// template function, e.g. {{ ctx "trace_id" }}. Keys the extractor does not
+// provide render as nil.
+func (c *Config) ProcessTemplateContext(ctx context.Context, filename string, tcfg TemplateConfig) error {
+	rendered, err := renderTemplate(ctx, filename, tcfg)
 	if err != nil {
 		return err
 	}
 
+	// Set the config global before executing the template output
+	c.L.SetGlobal("config", c.L.CreateTable(0, 0))
+
+	// Execute the processed template as Lua code
+	return c.DoString(string(rendered))
+}
+
+// renderTemplate reads filename and renders it as a template configured by tcfg
+func renderTemplate(ctx context.Context, filename string, tcfg TemplateConfig) ([]byte, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create template
 	t := template.New(filename)
 
@@ -21,6 +47,16 @@ func (c *Config) ProcessTemplate(filename string, tcfg TemplateConfig) error {
 		tcfg.Functions = make(template.FuncMap)
 	}
 
+	if _, ok := tcfg.Functions["ctx"]; !ok {
+		var values map[string]interface{}
+		if tcfg.ContextExtractor != nil {
+			values = tcfg.ContextExtractor(ctx)
+		}
+		tcfg.Functions["ctx"] = func(key string) interface{} {
+			return values[key]
+		}
+	}
+
 	// Add built-in functions if not overridden
 	if _, ok := tcfg.Functions["env"]; !ok {
 		tcfg.Functions["env"] = os.Getenv
@@ -44,26 +80,109 @@ func (c *Config) ProcessTemplate(filename string, tcfg TemplateConfig) error {
 	// Parse template
 	t, err = t.Parse(string(content))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Execute template
 	var buf bytes.Buffer
 	if err := t.Execute(&buf, tcfg.Variables); err != nil {
-		return err
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	// Set the config global before executing the template output
-	c.L.SetGlobal("config", c.L.CreateTable(0, 0))
+// WithTemplating makes LoadFile render files whose name ends in ".tmpl", such
+// as config.lua.tmpl, as templates before executing them. Templates see the
+// environment variables as fields, e.g. {{ .HOME }}, overridden by the
+// variables given to WithTemplateVariables.
+func WithTemplating(enabled bool) Option {
+	return func(c *Config) {
+		c.templating = enabled
+	}
+}
 
-	// Execute the processed template as Lua code
-	return c.DoString(buf.String())
+// WithTemplateVariables sets the variables of templates loaded by LoadFile
+// when WithTemplating is enabled
+func WithTemplateVariables(vars map[string]interface{}) Option {
+	return func(c *Config) {
+		c.templateVars = vars
+	}
+}
+
+// templateVariables returns the environment overridden by the configured
+// template variables
+func (c *Config) templateVariables() map[string]interface{} {
+	vars := make(map[string]interface{})
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	for k, v := range c.templateVars {
+		vars[k] = v
+	}
+	return vars
+}
+
+// LoadTemplate renders filename as a template with vars and executes the
+// result like LoadFile, running the BeforeLoad and AfterLoad hooks. Execution
+// stops with ErrCanceled when ctx is cancelled, or ErrTimeout when its
+// deadline passes. Use ProcessTemplate for custom
+// delimiters or functions.
+func (c *Config) LoadTemplate(ctx context.Context, filename string, vars map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return &Error{
+			Code:    ErrCanceled,
+			Message: fmt.Sprintf("loading template %s was cancelled before it started", filename),
+			Cause:   err,
+		}
+	}
+
+	start := time.Now()
+	event := HookEvent{
+		Type: BeforeLoad,
+		Name: filename,
+	}
+
+	if err := c.runHooks(ctx, BeforeLoad, event); err != nil {
+		return &Error{
+			Code:    ErrExecution,
+			Message: "before load hook failed",
+			Cause:   err,
+		}
+	}
+
+	execCtx, restore := c.bindExecContext(ctx, 0)
+	err := c.ProcessTemplateContext(ctx, filename, TemplateConfig{Variables: vars})
+	restore()
+
+	event.Type = AfterLoad
+	event.Elapsed = time.Since(start)
+	event.Error = err
+
+	if err != nil {
+		if ctxErr := contextError(execCtx, "loading template "+filename, err); ctxErr != nil {
+			return ctxErr
+		}
+		return &Error{
+			Code:    ErrExecution,
+			Message: "failed to load template",
+			Cause:   err,
+		}
+	}
+
+	return c.runHooks(ctx, AfterLoad, event)
 }
 
+// TemplateContextExtractor returns the values a template may read from a context
+type TemplateContextExtractor func(ctx context.Context) map[string]interface{}
+
 // TemplateConfig holds configuration for template processing
 type TemplateConfig struct {
 	Variables  map[string]interface{}
 	Functions  template.FuncMap
 	LeftDelim  string
 	RightDelim string
+	// ContextExtractor supplies the values of the ctx template function
+	ContextExtractor TemplateContextExtractor
 }
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -98,3 +99,122 @@ func TestTemplateProcessing(t *testing.T) {
 	assert.True(t, result.Server.Debug)
 	assert.Equal(t, []string{"/api", "/health", "/metrics"}, result.Server.Endpoints)
 }
+
+func TestTemplateContextValues(t *testing.T) {
+	type ctxKey string
+
+	tmpFile := filepath.Join(t.TempDir(), "config.lua.tmpl")
+	require.NoError(t, os.WriteFile(tmpFile, []byte(`
+    config = {
+        name = "{{ .name }}",
+        trace_id = "{{ ctx "trace_id" }}",
+        region = "{{ default "global" (ctx "region") }}",
+    }
+`), 0644))
+
+	cfg := New()
+	defer cfg.Close()
+
+	ctx := context.WithValue(context.Background(), ctxKey("trace"), "abc123")
+	err := cfg.ProcessTemplateContext(ctx, tmpFile, TemplateConfig{
+		Variables: map[string]interface{}{"name": "svc"},
+		ContextExtractor: func(ctx context.Context) map[string]interface{} {
+			return map[string]interface{}{"trace_id": ctx.Value(ctxKey("trace"))}
+		},
+	})
+	require.NoError(t, err)
+
+	var result struct {
+		Name    string `lua:"name"`
+		TraceID string `lua:"trace_id"`
+		Region  string `lua:"region"`
+	}
+	require.NoError(t, cfg.Get(context.Background(), "config", &result))
+	assert.Equal(t, "svc", result.Name)
+	assert.Equal(t, "abc123", result.TraceID)
+	assert.Equal(t, "global", result.Region)
+}
+
+func TestLoadTemplate(t *testing.T) {
+	dir := t.TempDir()
+	tmpFile := filepath.Join(dir, "config.lua.tmpl")
+	require.NoError(t, os.WriteFile(tmpFile, []byte(`
+    service = {
+        environment = "{{ .env }}",
+        port = {{ .port }},
+    }
+`), 0644))
+
+	cfg := New()
+	defer cfg.Close()
+
+	var events []HookType
+	for _, hookType := range []HookType{BeforeLoad, AfterLoad} {
+		cfg.RegisterHook(hookType, func(ctx context.Context, event HookEvent) error {
+			events = append(events, event.Type)
+			return nil
+		})
+	}
+
+	err := cfg.LoadTemplate(context.Background(), tmpFile, map[string]interface{}{"env": "staging", "port": 8080})
+	require.NoError(t, err)
+	assert.Equal(t, []HookType{BeforeLoad, AfterLoad}, events)
+
+	var service struct {
+		Environment string `lua:"environment"`
+		Port        int    `lua:"port"`
+	}
+	require.NoError(t, cfg.Get(context.Background(), "service", &service))
+	assert.Equal(t, "staging", service.Environment)
+	assert.Equal(t, 8080, service.Port)
+
+	// An already-cancelled context never runs the template
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = cfg.LoadTemplate(ctx, tmpFile, nil)
+	assert.True(t, IsErrorCode(err, ErrCanceled))
+
+	// Cancellation interrupts a running template
+	loopFile := filepath.Join(dir, "loop.lua.tmpl")
+	require.NoError(t, os.WriteFile(loopFile, []byte(`while true do end`), 0644))
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = cfg.LoadTemplate(ctx, loopFile, nil)
+	assert.True(t, IsErrorCode(err, ErrTimeout), "got %v", err)
+}
+
+func TestLoadFileTemplating(t *testing.T) {
+	dir := t.TempDir()
+	tmpFile := filepath.Join(dir, "config.lua.tmpl")
+	require.NoError(t, os.WriteFile(tmpFile, []byte(`
+    service = {
+        region = "{{ .LUGO_TEST_REGION }}",
+        port = {{ .port }},
+    }
+`), 0644))
+	t.Setenv("LUGO_TEST_REGION", "eu-west-1")
+
+	cfg := New(WithTemplating(true), WithTemplateVariables(map[string]interface{}{"port": 9090}))
+	defer cfg.Close()
+	require.NoError(t, cfg.LoadFile(context.Background(), tmpFile))
+
+	var service struct {
+		Region string `lua:"region"`
+		Port   int    `lua:"port"`
+	}
+	require.NoError(t, cfg.Get(context.Background(), "service", &service))
+	assert.Equal(t, "eu-west-1", service.Region)
+	assert.Equal(t, 9090, service.Port)
+
+	// Render errors fail the load
+	badFile := filepath.Join(dir, "bad.lua.tmpl")
+	require.NoError(t, os.WriteFile(badFile, []byte(`x = {{ .port `), 0644))
+	err := cfg.LoadFile(context.Background(), badFile)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to render template")
+
+	// Without templating the file is loaded as plain Lua
+	plain := New()
+	defer plain.Close()
+	assert.Error(t, plain.LoadFile(context.Background(), tmpFile))
+}
@@ -0,0 +1,625 @@
+package lugo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidatorFunc reports whether a field value satisfies a custom validation rule
+type ValidatorFunc func(value interface{}) bool
+
+// ValidationError describes a struct field that failed a validate tag rule
+type ValidationError struct {
+	// Field is the dotted Lua path of the field, e.g. "server.port"
+	Field string
+	// Rule is the name of the failed rule, e.g. "max"
+	Rule string
+	// Param is the rule parameter, e.g. "65535", if any
+	Param string
+	// Value is the offending field value
+	Value interface{}
+	// Detail optionally explains the failure, e.g. which elements collide
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	var msg string
+	if e.Param != "" {
+		msg = fmt.Sprintf("field %s failed rule %s=%s (value: %v)", e.Field, e.Rule, e.Param, e.Value)
+	} else {
+		msg = fmt.Sprintf("field %s failed rule %s (value: %v)", e.Field, e.Rule, e.Value)
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// FieldError describes one failure collected in ValidationErrors
+type FieldError struct {
+	// Path is the dotted Lua path of the field relative to the value being
+	// decoded, e.g. "server.port"
+	Path string
+	// Rule is the name of the failed validate rule, or empty when the value
+	// has the wrong type
+	Rule string
+	// Message describes the failure
+	Message string
+	// Err is the underlying error, such as a *ValidationError
+	Err error
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors holds every failure found while validating a value, so a
+// configuration with several mistakes reports them all at once. Get returns
+// it as the Cause of its ErrValidation error.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Message
+	}
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Message
+	}
+	return fmt.Sprintf("%d validation errors: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the underlying errors, so errors.As finds a
+// *ValidationError among them
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe.Err
+	}
+	return errs
+}
+
+// add appends err as the failure at path, flattening a nested
+// ValidationErrors and prefixing its messages with prefix
+func (e ValidationErrors) add(path string, err error, prefix string) ValidationErrors {
+	var nested ValidationErrors
+	if errors.As(err, &nested) {
+		for _, fe := range nested {
+			fe.Message = prefix + fe.Message
+			e = append(e, fe)
+		}
+		return e
+	}
+
+	fe := FieldError{Path: path, Message: prefix + err.Error(), Err: err}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		fe.Path, fe.Rule = verr.Field, verr.Rule
+	}
+	return append(e, fe)
+}
+
+// relativeTo strips the global name from the paths of type mismatches
+func (e ValidationErrors) relativeTo(name string) ValidationErrors {
+	for i := range e {
+		if e[i].Path == name {
+			e[i].Path = ""
+		} else {
+			e[i].Path = strings.TrimPrefix(e[i].Path, name+".")
+		}
+	}
+	return e
+}
+
+// orNil returns e, or nil when it holds no failures
+func (e ValidationErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// RegisterValidator registers a custom rule usable in `validate` struct tags
+func (c *Config) RegisterValidator(name string, fn ValidatorFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.validators == nil {
+		c.validators = make(map[string]ValidatorFunc)
+	}
+	c.validators[name] = fn
+	delete(c.validatorFuncs, name)
+}
+
+// RegisterValidatorFunc registers a custom rule usable in `validate` struct
+// tags, e.g. `validate:"cron"`, whose function explains failures. fn receives
+// the decoded Go value of the field and returns nil if it is valid, or an
+// error describing the problem, which becomes the Detail of the
+// *ValidationError. Built-in rules take precedence over custom ones.
+func (c *Config) RegisterValidatorFunc(tag string, fn func(value interface{}) error) error {
+	if tag == "" || strings.ContainsAny(tag, ",= ") {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("invalid validation rule name %q", tag),
+		}
+	}
+	if fn == nil {
+		return &Error{
+			Code:    ErrInvalidType,
+			Message: "validator cannot be nil",
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.validatorFuncs == nil {
+		c.validatorFuncs = make(map[string]func(interface{}) error)
+	}
+	c.validatorFuncs[tag] = fn
+	delete(c.validators, tag)
+	return nil
+}
+
+// ruleFailure carries the error of a failed RegisterValidatorFunc rule from
+// checkRule to applyRules
+type ruleFailure struct {
+	err error
+}
+
+func (f *ruleFailure) Error() string {
+	return f.err.Error()
+}
+
+var (
+	hostnameRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*\.?$`)
+	semverRegex   = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+	durationType  = reflect.TypeOf(time.Duration(0))
+	timeType      = reflect.TypeOf(time.Time{})
+	bigIntType    = reflect.TypeOf(big.Int{})
+	bigFloatType  = reflect.TypeOf(big.Float{})
+)
+
+// validateStruct applies the validate tags of every field in val, which must
+// be a struct, descending into nested structs, pointers, slices and maps
+func (c *Config) validateStruct(val reflect.Value, path string) error {
+	return c.validateFields(val, val, path)
+}
+
+// validateFields validates the fields of the struct val. root is the value
+// validation started from, which rules such as ref resolve paths against.
+func (c *Config) validateFields(root, val reflect.Value, path string) error {
+	var errs ValidationErrors
+	typ := val.Type()
+	for i := 0; i < val.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" { // Skip unexported fields
+			continue
+		}
+
+		fieldPath := joinFieldPath(path, luaFieldName(field))
+		if isInlined(field, "lua") {
+			fieldPath = path
+		}
+		fieldVal := val.Field(i)
+
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			if err := c.applyRules(root, val, fieldVal, fieldPath, strings.Split(tag, ",")); err != nil {
+				errs = errs.add(fieldPath, err, "")
+				continue
+			}
+		}
+
+		if err := c.validateNested(root, fieldVal, fieldPath); err != nil {
+			errs = errs.add(fieldPath, err, "")
+		}
+	}
+	return errs.orNil()
+}
+
+// validateNested descends into values that may contain tagged structs
+func (c *Config) validateNested(root, val reflect.Value, path string) error {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return nil
+		}
+		return c.validateNested(root, val.Elem(), path)
+	case reflect.Struct:
+		if val.Type() == timeType {
+			return nil
+		}
+		return c.validateFields(root, val, path)
+	case reflect.Slice, reflect.Array:
+		var errs ValidationErrors
+		for i := 0; i < val.Len(); i++ {
+			elemPath := joinFieldPath(path, strconv.Itoa(i))
+			if err := c.validateNested(root, val.Index(i), elemPath); err != nil {
+				errs = errs.add(elemPath, err, "")
+			}
+		}
+		return errs.orNil()
+	case reflect.Map:
+		var errs ValidationErrors
+		for _, key := range sortedMapKeys(val) {
+			elemPath := joinFieldPath(path, fmt.Sprint(key.Interface()))
+			if err := c.validateNested(root, val.MapIndex(key), elemPath); err != nil {
+				errs = errs.add(elemPath, err, "")
+			}
+		}
+		return errs.orNil()
+	}
+	return nil
+}
+
+// applyRules checks val against rules. parent is the struct holding the
+// field, used by rules that refer to sibling fields.
+func (c *Config) applyRules(root, parent, val reflect.Value, path string, rules []string) error {
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if val.IsZero() {
+				return nil
+			}
+			continue
+		case "dive":
+			return c.dive(root, parent, val, path, rules[i+1:])
+		case "unique":
+			if err := checkUnique(val, path, param); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Only presence rules apply to a nil pointer
+		if v := indirect(val); (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() &&
+			name != "required" && name != "required_if" {
+			continue
+		}
+
+		ok, err := c.checkRule(root, parent, val, name, param)
+		if failure, isFailure := err.(*ruleFailure); isFailure {
+			return &ValidationError{Field: path, Rule: name, Param: param, Value: val.Interface(), Detail: failure.Error()}
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &ValidationError{Field: path, Rule: name, Param: param, Value: val.Interface()}
+		}
+	}
+	return nil
+}
+
+// dive applies rules to every element of a slice, array or map
+func (c *Config) dive(root, parent, val reflect.Value, path string, rules []string) error {
+	var errs ValidationErrors
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			elemPath := joinFieldPath(path, strconv.Itoa(i))
+			if err := c.applyRules(root, parent, val.Index(i), elemPath, rules); err != nil {
+				errs = errs.add(elemPath, err, "")
+			}
+		}
+	case reflect.Map:
+		for _, key := range sortedMapKeys(val) {
+			elemPath := joinFieldPath(path, fmt.Sprint(key.Interface()))
+			if err := c.applyRules(root, parent, val.MapIndex(key), elemPath, rules); err != nil {
+				errs = errs.add(elemPath, err, "")
+			}
+		}
+	default:
+		return &Error{
+			Code:    ErrValidation,
+			Message: fmt.Sprintf("rule dive on field %s requires a slice or map, got %s", path, val.Kind()),
+		}
+	}
+	return errs.orNil()
+}
+
+// sortedMapKeys returns the keys of a map in a stable order so errors are
+// reported the same way on every run
+func sortedMapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+	return keys
+}
+
+// checkUnique reports the first pair of elements of a slice or array that
+// are equal, or whose key field is equal when key names a struct field
+func checkUnique(val reflect.Value, path, key string) error {
+	val = indirect(val)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return &Error{
+			Code:    ErrValidation,
+			Message: fmt.Sprintf("rule unique on field %s requires a slice, got %s", path, val.Kind()),
+		}
+	}
+
+	first := make(map[interface{}]int)
+	for i := 0; i < val.Len(); i++ {
+		elem := indirect(val.Index(i))
+		if (elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface) && elem.IsNil() {
+			continue
+		}
+
+		if key != "" {
+			field, ok := structField(elem, key)
+			if !ok {
+				return invalidRuleParam("unique", key)
+			}
+			elem = indirect(field)
+		}
+
+		var id interface{} = fmt.Sprint(elem.Interface())
+		if elem.Type().Comparable() {
+			id = elem.Interface()
+		}
+
+		if j, ok := first[id]; ok {
+			return &ValidationError{
+				Field:  path,
+				Rule:   "unique",
+				Param:  key,
+				Value:  elem.Interface(),
+				Detail: fmt.Sprintf("elements %d and %d are duplicates", j, i),
+			}
+		}
+		first[id] = i
+	}
+	return nil
+}
+
+// checkReference reports whether val, or every element of val if it is a
+// slice, names an entry of the collection at path under root. path uses the
+// dotted Lua names of fields and may contain * to fan out over a slice or
+// map, e.g. "backends.*.name". A map contributes its keys and a slice its
+// elements.
+func checkReference(root, val reflect.Value, path string) (bool, error) {
+	if path == "" {
+		return false, invalidRuleParam("ref", path)
+	}
+
+	names := make(map[string]bool)
+	for _, m := range matchPath(root, strings.Split(path, "."), "") {
+		target := indirect(m.value)
+		switch target.Kind() {
+		case reflect.Map:
+			for _, k := range target.MapKeys() {
+				names[fmt.Sprint(k.Interface())] = true
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < target.Len(); i++ {
+				names[stringValue(target.Index(i))] = true
+			}
+		default:
+			names[stringValue(target)] = true
+		}
+	}
+
+	val = indirect(val)
+	if val.Kind() == reflect.Slice || val.Kind() == reflect.Array {
+		for i := 0; i < val.Len(); i++ {
+			if !names[stringValue(val.Index(i))] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return names[stringValue(val)], nil
+}
+
+// structField returns the field of struct val with the given Go or Lua name
+func structField(val reflect.Value, name string) (reflect.Value, bool) {
+	if val.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath == "" && (field.Name == name || luaFieldName(field) == name) {
+			return val.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// checkRule reports whether val satisfies a single rule
+func (c *Config) checkRule(root, parent, val reflect.Value, name, param string) (bool, error) {
+	switch name {
+	case "required":
+		return !val.IsZero(), nil
+	case "required_if":
+		fields := strings.Fields(param)
+		if len(fields) < 2 {
+			return false, invalidRuleParam(name, param)
+		}
+		other := parent.FieldByName(fields[0])
+		if !other.IsValid() {
+			return false, invalidRuleParam(name, param)
+		}
+		current := fmt.Sprint(indirect(other).Interface())
+		for _, want := range fields[1:] {
+			if current == want {
+				return !val.IsZero(), nil
+			}
+		}
+		return true, nil
+	case "min", "max", "len":
+		return compareSize(val, name, param)
+	case "oneof":
+		current := fmt.Sprint(indirect(val).Interface())
+		for _, option := range strings.Fields(param) {
+			if current == option {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "startswith":
+		return strings.HasPrefix(stringValue(val), param), nil
+	case "endswith":
+		return strings.HasSuffix(stringValue(val), param), nil
+	case "email":
+		s := stringValue(val)
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s, nil
+	case "hostname":
+		return hostnameRegex.MatchString(stringValue(val)), nil
+	case "hostname_port":
+		host, port, err := net.SplitHostPort(stringValue(val))
+		if err != nil {
+			return false, nil
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return false, nil
+		}
+		return host == "" || net.ParseIP(host) != nil || hostnameRegex.MatchString(host), nil
+	case "ip":
+		return net.ParseIP(stringValue(val)) != nil, nil
+	case "url":
+		u, err := url.Parse(stringValue(val))
+		return err == nil && u.Scheme != "" && u.Host != "", nil
+	case "semver":
+		return semverRegex.MatchString(stringValue(val)), nil
+	case "duration":
+		if val.Type() == durationType {
+			return true, nil
+		}
+		_, err := time.ParseDuration(stringValue(val))
+		return err == nil, nil
+	case "ref":
+		return checkReference(root, val, param)
+	case "gtfield":
+		other := parent.FieldByName(param)
+		if !other.IsValid() {
+			return false, invalidRuleParam(name, param)
+		}
+		return greaterThan(indirect(val), indirect(other))
+	}
+
+	if custom, ok := c.validators[name]; ok {
+		return custom(val.Interface()), nil
+	}
+	if custom, ok := c.validatorFuncs[name]; ok {
+		if err := custom(val.Interface()); err != nil {
+			return false, &ruleFailure{err: err}
+		}
+		return true, nil
+	}
+	return false, &Error{
+		Code:    ErrValidation,
+		Message: fmt.Sprintf("unknown validation rule %q", name),
+	}
+}
+
+// compareSize implements min, max and len: numbers compare by value,
+// durations by duration, and strings, slices and maps by length
+func compareSize(val reflect.Value, rule, param string) (bool, error) {
+	val = indirect(val)
+
+	var current, limit float64
+	switch {
+	case val.Type() == durationType:
+		d, err := time.ParseDuration(param)
+		if err != nil {
+			return false, invalidRuleParam(rule, param)
+		}
+		current, limit = float64(val.Int()), float64(d)
+	default:
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false, invalidRuleParam(rule, param)
+		}
+		limit = n
+
+		switch val.Kind() {
+		case reflect.String:
+			current = float64(utf8.RuneCountInString(val.String()))
+		case reflect.Slice, reflect.Array, reflect.Map:
+			current = float64(val.Len())
+		default:
+			num, ok := numericValue(val)
+			if !ok {
+				return false, &Error{
+					Code:    ErrValidation,
+					Message: fmt.Sprintf("rule %s does not apply to %s", rule, val.Kind()),
+				}
+			}
+			current = num
+		}
+	}
+
+	switch rule {
+	case "min":
+		return current >= limit, nil
+	case "max":
+		return current <= limit, nil
+	default:
+		return current == limit, nil
+	}
+}
+
+// greaterThan reports whether a is greater than b, for numbers, durations
+// and times
+func greaterThan(a, b reflect.Value) (bool, error) {
+	if a.Type() == timeType && b.Type() == timeType {
+		return a.Interface().(time.Time).After(b.Interface().(time.Time)), nil
+	}
+	x, ok1 := numericValue(a)
+	y, ok2 := numericValue(b)
+	if !ok1 || !ok2 {
+		return false, &Error{
+			Code:    ErrValidation,
+			Message: fmt.Sprintf("rule gtfield cannot compare %s with %s", a.Type(), b.Type()),
+		}
+	}
+	return x > y, nil
+}
+
+// indirect dereferences pointers and interfaces down to a concrete value
+func indirect(val reflect.Value) reflect.Value {
+	for (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) && !val.IsNil() {
+		val = val.Elem()
+	}
+	return val
+}
+
+// stringValue returns the string form of val for string rules
+func stringValue(val reflect.Value) string {
+	val = indirect(val)
+	if val.Kind() == reflect.String {
+		return val.String()
+	}
+	return fmt.Sprint(val.Interface())
+}
+
+// invalidRuleParam reports a malformed validate tag
+func invalidRuleParam(rule, param string) error {
+	return &Error{
+		Code:    ErrValidation,
+		Message: fmt.Sprintf("invalid parameter %q for validation rule %s", param, rule),
+	}
+}
+
+// joinFieldPath appends a segment to a dotted field path
+func joinFieldPath(path, segment string) string {
+	if path == "" {
+		return segment
+	}
+	return path + "." + segment
+}
@@ -0,0 +1,345 @@
+package lugo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validatedApp struct {
+	Name     string `lua:"name" validate:"required"`
+	Version  string `lua:"version" validate:"required,semver"`
+	LogLevel string `lua:"log_level" validate:"oneof=debug info warn error"`
+	Server   struct {
+		Host    string        `lua:"host" validate:"required,hostname"`
+		Port    int           `lua:"port" validate:"required,min=1,max=65535"`
+		Timeout time.Duration `lua:"timeout" validate:"omitempty,min=1s,max=1m"`
+	} `lua:"server"`
+	Admins  []string `lua:"admins" validate:"omitempty,dive,email"`
+	TLS     bool     `lua:"tls"`
+	Cert    string   `lua:"cert" validate:"required_if=TLS true"`
+	Metrics *string  `lua:"metrics" validate:"omitempty,url"`
+}
+
+func loadValidatedApp(t *testing.T, cfg *Config, overrides string) error {
+	t.Helper()
+	require.NoError(t, cfg.DoString(`
+		app = {
+			name = "svc",
+			version = "1.4.0",
+			log_level = "info",
+			server = { host = "api.example.com", port = 8080 },
+			admins = { "ops@example.com" },
+		}
+	`+overrides))
+	var app validatedApp
+	return cfg.Get(context.Background(), "app", &app)
+}
+
+func TestValidateTags(t *testing.T) {
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+
+	require.NoError(t, loadValidatedApp(t, cfg, ""))
+
+	tests := []struct {
+		name      string
+		overrides string
+		field     string
+		rule      string
+	}{
+		{"invalid semver", `app.version = "1.4"`, "version", "semver"},
+		{"log level outside oneof", `app.log_level = "verbose"`, "log_level", "oneof"},
+		{"port above max", `app.server.port = 70000`, "server.port", "max"},
+		{"missing required", `app.server.host = nil`, "server.host", "required"},
+		{"invalid element", `app.admins = { "ops@example.com", "nope" }`, "admins.1", "email"},
+		{"required_if", `app.tls = true`, "cert", "required_if"},
+		{"pointer url", `app.metrics = "not a url"`, "metrics", "url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadValidatedApp(t, cfg, tt.overrides)
+			require.Error(t, err)
+			assert.True(t, IsErrorCode(err, ErrValidation))
+
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr), "expected ValidationError, got %v", err)
+			assert.Equal(t, tt.field, verr.Field)
+			assert.Equal(t, tt.rule, verr.Rule)
+			assert.Contains(t, err.Error(), tt.field)
+		})
+	}
+
+	// Durations compare against duration parameters
+	require.NoError(t, loadValidatedApp(t, cfg, `app.server.timeout = 30 * 1e9`))
+	err := loadValidatedApp(t, cfg, `app.server.timeout = 120 * 1e9`)
+	assert.True(t, IsErrorCode(err, ErrValidation))
+}
+
+func TestValidateTagsDisabledByDefault(t *testing.T) {
+	cfg := New()
+	defer cfg.Close()
+
+	assert.NoError(t, loadValidatedApp(t, cfg, `app.version = "not semver"`))
+}
+
+func TestWithValidationOption(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		cfg := New(WithValidation(enabled))
+		err := loadValidatedApp(t, cfg, `app.server.port = 70000`)
+		assert.Equal(t, enabled, IsErrorCode(err, ErrValidation), "WithValidation(%v)", enabled)
+		cfg.Close()
+	}
+}
+
+func TestRegisterValidator(t *testing.T) {
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+
+	cfg.RegisterValidator("port_range", func(v interface{}) bool {
+		port, ok := v.(int)
+		return ok && port >= 1024 && port <= 65535
+	})
+
+	type Server struct {
+		Port int `lua:"port" validate:"port_range"`
+	}
+	require.NoError(t, cfg.DoString(`server = { port = 80 }`))
+
+	var s Server
+	err := cfg.Get(context.Background(), "server", &s)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, "port_range", verr.Rule)
+
+	require.NoError(t, cfg.DoString(`server = { port = 8080 }`))
+	require.NoError(t, cfg.Get(context.Background(), "server", &s))
+
+	// Unknown rules are reported rather than silently ignored
+	type Bad struct {
+		Port int `lua:"port" validate:"no_such_rule"`
+	}
+	err = cfg.Get(context.Background(), "server", &Bad{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown validation rule "no_such_rule"`)
+}
+
+func TestRegisterValidatorFunc(t *testing.T) {
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+
+	field := regexp.MustCompile(`^(\*|\d+(-\d+)?)(/\d+)?(,(\d+(-\d+)?))*$`)
+	require.NoError(t, cfg.RegisterValidatorFunc("cron", func(v interface{}) error {
+		spec, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %T", v)
+		}
+		fields := strings.Fields(spec)
+		if len(fields) != 5 {
+			return fmt.Errorf("expected 5 fields, got %d", len(fields))
+		}
+		for i, f := range fields {
+			if !field.MatchString(f) {
+				return fmt.Errorf("field %d (%q) is not a valid cron field", i+1, f)
+			}
+		}
+		return nil
+	}))
+
+	type Job struct {
+		Schedule string `lua:"schedule" validate:"required,cron"`
+	}
+
+	require.NoError(t, cfg.DoString(`job = { schedule = "*/15 0-6 * * 1,3,5" }`))
+	var job Job
+	require.NoError(t, cfg.Get(context.Background(), "job", &job))
+
+	require.NoError(t, cfg.DoString(`job = { schedule = "every monday" }`))
+	err := cfg.Get(context.Background(), "job", &job)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, "cron", verr.Rule)
+	assert.Equal(t, "expected 5 fields, got 2", verr.Detail)
+	assert.Contains(t, err.Error(), "expected 5 fields")
+
+	assert.True(t, IsErrorCode(cfg.RegisterValidatorFunc("", func(interface{}) error { return nil }), ErrInvalidType))
+	assert.True(t, IsErrorCode(cfg.RegisterValidatorFunc("a,b", func(interface{}) error { return nil }), ErrInvalidType))
+	assert.True(t, IsErrorCode(cfg.RegisterValidatorFunc("cron", nil), ErrInvalidType))
+}
+
+func TestValidateUnique(t *testing.T) {
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+
+	type Server struct {
+		Name string `lua:"name"`
+		Port int    `lua:"port"`
+	}
+	type Cluster struct {
+		Ports   []int     `lua:"ports" validate:"unique"`
+		Servers []*Server `lua:"servers" validate:"unique=Name"`
+	}
+
+	get := func(script string) error {
+		require.NoError(t, cfg.DoString(script))
+		var c Cluster
+		return cfg.Get(context.Background(), "cluster", &c)
+	}
+
+	require.NoError(t, get(`cluster = {
+		ports = { 80, 443 },
+		servers = { { name = "a", port = 80 }, { name = "b", port = 80 } },
+	}`))
+
+	err := get(`cluster = { ports = { 80, 443, 80 } }`)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr), "got %v", err)
+	assert.Equal(t, "ports", verr.Field)
+	assert.Equal(t, "unique", verr.Rule)
+	assert.Equal(t, 80, verr.Value)
+	assert.Contains(t, err.Error(), "elements 0 and 2")
+
+	err = get(`cluster = { servers = { { name = "a" }, { name = "b" }, { name = "b" } } }`)
+	require.True(t, errors.As(err, &verr), "got %v", err)
+	assert.Equal(t, "servers", verr.Field)
+	assert.Equal(t, "b", verr.Value)
+	assert.Contains(t, err.Error(), "elements 1 and 2")
+}
+
+func TestValidateReferences(t *testing.T) {
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+
+	type Backend struct {
+		Name string `lua:"name"`
+		URL  string `lua:"url"`
+	}
+	type Route struct {
+		Path     string   `lua:"path"`
+		Backend  string   `lua:"backend" validate:"ref=backends.*.name"`
+		Fallback []string `lua:"fallback" validate:"omitempty,ref=pools"`
+	}
+	type Gateway struct {
+		Backends []Backend          `lua:"backends"`
+		Pools    map[string]float64 `lua:"pools"`
+		Routes   []Route            `lua:"routes"`
+	}
+
+	get := func(routes string) error {
+		require.NoError(t, cfg.DoString(`gateway = {
+			backends = { { name = "api", url = "http://api" }, { name = "web", url = "http://web" } },
+			pools = { east = 1, west = 2 },
+			routes = `+routes+`,
+		}`))
+		var g Gateway
+		return cfg.Get(context.Background(), "gateway", &g)
+	}
+
+	require.NoError(t, get(`{ { path = "/api", backend = "api", fallback = { "east", "west" } }, { path = "/", backend = "web" } }`))
+
+	err := get(`{ { path = "/api", backend = "api" }, { path = "/billing", backend = "billing" } }`)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr), "got %v", err)
+	assert.Equal(t, "routes.1.backend", verr.Field)
+	assert.Equal(t, "ref", verr.Rule)
+	assert.Equal(t, "billing", verr.Value)
+
+	err = get(`{ { path = "/", backend = "web", fallback = { "east", "north" } } }`)
+	require.True(t, errors.As(err, &verr), "got %v", err)
+	assert.Equal(t, "routes.0.fallback", verr.Field)
+}
+
+func TestValidationErrorsCollected(t *testing.T) {
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+	ctx := context.Background()
+
+	// Three rule failures in one config are reported together
+	require.NoError(t, cfg.DoString(`
+		app = {
+			name = "api",
+			version = "not-a-version",
+			log_level = "verbose",
+			server = { host = "localhost", port = 70000 },
+		}
+	`))
+	var app validatedApp
+	err := cfg.Get(ctx, "app", &app)
+	require.Error(t, err)
+	assert.True(t, IsErrorCode(err, ErrValidation))
+
+	var verrs ValidationErrors
+	require.True(t, errors.As(err, &verrs))
+	paths := make([]string, len(verrs))
+	for i, fe := range verrs {
+		paths[i] = fe.Path
+	}
+	assert.Equal(t, []string{"version", "log_level", "server.port"}, paths)
+	assert.Equal(t, "max", verrs[2].Rule)
+	assert.Contains(t, err.Error(), "3 validation errors")
+
+	// The individual failures are still reachable with errors.As
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, "version", verr.Field)
+
+	// Type mismatches are collected too, with an empty rule
+	require.NoError(t, cfg.DoString(`
+		app = {
+			name = 42,
+			version = "1.0.0",
+			server = { host = true, port = "eighty" },
+		}
+	`))
+	err = cfg.Get(ctx, "app", &app)
+	require.Error(t, err)
+	require.True(t, errors.As(err, &verrs))
+	paths = paths[:0]
+	for _, fe := range verrs {
+		paths = append(paths, fe.Path)
+		assert.Empty(t, fe.Rule)
+	}
+	assert.ElementsMatch(t, []string{"name", "server.host", "server.port"}, paths)
+	assert.Contains(t, err.Error(), "field server: field port: expected number, got string")
+}
+
+func TestValidationMapOrder(t *testing.T) {
+	type member struct {
+		Email string `lua:"email" validate:"email"`
+	}
+	type team struct {
+		Contacts map[string]string `lua:"contacts" validate:"dive,email"`
+		Members  map[string]member `lua:"members"`
+	}
+	cfg := New(WithValidation(true))
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(`
+		team = {
+			contacts = { d = "x", a = "x", c = "x", b = "x" },
+			members = { z = { email = "x" }, m = { email = "x" }, k = { email = "x" } },
+		}
+	`))
+
+	// Map entries are reported in key order on every run
+	for range 10 {
+		var tm team
+		err := cfg.Get(context.Background(), "team", &tm)
+		var verrs ValidationErrors
+		require.True(t, errors.As(err, &verrs))
+		paths := make([]string, len(verrs))
+		for i, fe := range verrs {
+			paths[i] = fe.Path
+		}
+		assert.Equal(t, []string{
+			"contacts.a", "contacts.b", "contacts.c", "contacts.d",
+			"members.k.email", "members.m.email", "members.z.email",
+		}, paths)
+	}
+}
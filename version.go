@@ -0,0 +1,154 @@
+package lugo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PluginAPIVersion is the version of the plugin API provided by this package.
+// Plugins declare the range of API versions they support with the
+// "api_version" metadata field.
+const PluginAPIVersion = "1.3.0"
+
+// semver is a parsed major.minor.patch version
+type semver [3]int
+
+// parseSemver parses a version such as "1", "1.2" or "v1.2.3". Missing
+// components default to zero and pre-release or build suffixes are ignored.
+func parseSemver(s string) (semver, error) {
+	var v semver
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if s == "" || len(parts) > 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// compare returns -1, 0 or 1 depending on whether v is lower than, equal to
+// or greater than other
+func (v semver) compare(other semver) int {
+	for i := range v {
+		switch {
+		case v[i] < other[i]:
+			return -1
+		case v[i] > other[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// String returns the version in major.minor.patch form
+func (v semver) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// versionSatisfies reports whether version matches constraint. A constraint
+// is a space or comma separated list of comparators, all of which must hold:
+//
+//	>=1.0.0 <2.0.0   explicit bounds (=, >, >=, <, <= are supported)
+//	^1.2             compatible with 1.2: >=1.2.0 <2.0.0 (<0.3.0 for 0.2)
+//	~1.2             patch releases of 1.2: >=1.2.0 <1.3.0
+//	1.2              same as ^1.2
+//	*                any version
+func versionSatisfies(version, constraint string) (bool, error) {
+	v, err := parseSemver(version)
+	if err != nil {
+		return false, err
+	}
+
+	fields := strings.FieldsFunc(constraint, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	for _, field := range fields {
+		ok, err := matchComparator(v, field)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchComparator checks v against a single comparator such as ">=1.2"
+func matchComparator(v semver, comparator string) (bool, error) {
+	if comparator == "*" {
+		return true, nil
+	}
+
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(comparator, prefix) {
+			op = prefix
+			break
+		}
+	}
+
+	bound, err := parseSemver(comparator[len(op):])
+	if err != nil {
+		return false, fmt.Errorf("invalid version constraint %q", comparator)
+	}
+
+	cmp := v.compare(bound)
+	switch op {
+	case ">=":
+		return cmp >= 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "=":
+		return cmp == 0, nil
+	case "~":
+		return cmp >= 0 && v[0] == bound[0] && v[1] == bound[1], nil
+	default: // "^" or a bare version
+		if cmp < 0 || v[0] != bound[0] {
+			return false, nil
+		}
+		if bound[0] == 0 {
+			return v[1] == bound[1], nil
+		}
+		return true, nil
+	}
+}
+
+// checkPluginAPIVersion verifies that a plugin's declared api_version
+// constraint accepts PluginAPIVersion. Plugins that do not declare a
+// constraint are assumed to be compatible.
+func checkPluginAPIVersion(path string, metadata map[string]interface{}) (string, error) {
+	raw, ok := metadata["api_version"]
+	if !ok || raw == nil {
+		return "", nil
+	}
+
+	constraint, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("plugin %s has invalid api_version: expected string, got %T", path, raw)
+	}
+
+	compatible, err := versionSatisfies(PluginAPIVersion, constraint)
+	if err != nil {
+		return "", fmt.Errorf("plugin %s has invalid api_version: %w", path, err)
+	}
+	if !compatible {
+		return "", fmt.Errorf("plugin %s requires plugin API %s, but this host provides %s",
+			path, constraint, PluginAPIVersion)
+	}
+	return constraint, nil
+}
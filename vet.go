@@ -0,0 +1,203 @@
+package lugo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// VetIssue is a problem Vet found in a config file
+type VetIssue struct {
+	// Path is the dotted Lua path of the offending value, e.g.
+	// "server.port", or empty for problems with the file as a whole.
+	// Slice elements are numbered from 0, as in ValidationError.
+	Path string
+	// Rule is the failed validate rule, or empty for other problems
+	Rule string
+	// Message describes the problem
+	Message string
+	// Position is the file and line that set the value, when known
+	Position string
+}
+
+// Vet checks filename against schema, a struct (or pointer to one) whose
+// fields describe the globals the file sets, without changing c. The file is
+// run on a scratch copy of the Lua state under c's sandbox, with c's
+// functions and migrations but no hooks or bindings. Vet reports unknown
+// globals and keys, values of the wrong type, and failed validate rules, all
+// at once; a file that fails to run is reported as a single issue. The
+// returned error is for problems other than the file's content, such as a
+// missing file.
+func (c *Config) Vet(ctx context.Context, filename string, schema interface{}) ([]VetIssue, error) {
+	t := reflect.TypeOf(schema)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, &Error{
+			Code:    ErrInvalidType,
+			Message: fmt.Sprintf("schema must be a struct, got %T", schema),
+		}
+	}
+	if _, err := os.Stat(filename); err != nil {
+		return nil, &Error{
+			Code:    ErrIO,
+			Message: fmt.Sprintf("failed to read %s", filename),
+			Cause:   err,
+		}
+	}
+
+	scratch := c.replicate()
+	defer scratch.Close()
+	c.mu.RLock()
+	scratch.migrations = c.migrations
+	c.mu.RUnlock()
+	scratch.sourcePositions = nil
+	scratch.hooks = nil
+
+	before := scratch.snapshotGlobals()[scratch.L.G.Global]
+	if err := scratch.LoadFile(ctx, filename); err != nil {
+		return []VetIssue{{Message: err.Error()}}, nil
+	}
+
+	// Gather the globals the file set into one table shaped like schema
+	root := scratch.L.NewTable()
+	scratch.L.G.Global.ForEach(func(k, v lua.LValue) {
+		name, ok := k.(lua.LString)
+		if !ok || builtinGlobals[string(name)] || v.Type() == lua.LTFunction {
+			return
+		}
+		_, assigned := scratch.sourcePositions[string(name)]
+		if before[k] != v || assigned {
+			root.RawSet(k, v)
+		}
+	})
+
+	d := scratch.newDecoder()
+	position := func(path string) string {
+		return scratch.sourcePositions[d.luaPath(t, path)]
+	}
+
+	var issues []VetIssue
+	add := func(errs ValidationErrors) {
+		for _, fe := range errs {
+			issues = append(issues, VetIssue{
+				Path:     fe.Path,
+				Rule:     fe.Rule,
+				Message:  fe.Message,
+				Position: position(fe.Path),
+			})
+		}
+	}
+
+	for _, path := range d.unknownKeys(root, t, "") {
+		issues = append(issues, VetIssue{
+			Path:     path,
+			Message:  fmt.Sprintf("unknown key '%s'", path),
+			Position: position(path),
+		})
+	}
+
+	if err := scratch.validateValue(root, t, ""); err != nil {
+		add(ValidationErrors(nil).add("", err, "").relativeTo(""))
+	} else {
+		target := reflect.New(t)
+		if err := scratch.decodeInto(root, target.Interface(), d); err != nil {
+			issues = append(issues, VetIssue{Message: err.Error()})
+		} else if err := scratch.validateNested(target.Elem(), target.Elem(), ""); err != nil {
+			add(ValidationErrors(nil).add("", err, ""))
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues, nil
+}
+
+// unknownKeys returns the dotted paths of the keys under table that match no
+// field of t, looking into nested structs and the elements of slices and maps
+func (d *decoder) unknownKeys(table *lua.LTable, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType || t == bigIntType || t == bigFloatType {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		d.fieldTypes(t, fields)
+		table.ForEach(func(k, v lua.LValue) {
+			key := k.String()
+			fieldType, ok := fields[key]
+			if _, isString := k.(lua.LString); !isString || !ok {
+				unknown = append(unknown, join(key))
+				return
+			}
+			if nested, ok := v.(*lua.LTable); ok {
+				unknown = append(unknown, d.unknownKeys(nested, fieldType, join(key))...)
+			}
+		})
+	case reflect.Slice, reflect.Array, reflect.Map:
+		table.ForEach(func(k, v lua.LValue) {
+			nested, ok := v.(*lua.LTable)
+			if !ok {
+				return
+			}
+			key := k.String()
+			if n, isIndex := k.(lua.LNumber); isIndex && t.Kind() != reflect.Map {
+				// Number elements from 0, as validation errors do
+				key = strconv.Itoa(int(n) - 1)
+			}
+			unknown = append(unknown, d.unknownKeys(nested, t.Elem(), join(key))...)
+		})
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// luaPath converts path, whose slice elements are numbered from 0, to the
+// path of the same value in Lua, where they are numbered from 1, following
+// the fields of t. The rest of the path is kept as is from the first segment
+// that matches no field.
+func (d *decoder) luaPath(t reflect.Type, path string) string {
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := make(map[string]reflect.Type)
+			d.fieldTypes(t, fields)
+			fieldType, ok := fields[segment]
+			if !ok {
+				return strings.Join(segments, ".")
+			}
+			t = fieldType
+		case reflect.Slice, reflect.Array:
+			if n, err := strconv.Atoi(segment); err == nil {
+				segments[i] = strconv.Itoa(n + 1)
+			}
+			t = t.Elem()
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return strings.Join(segments, ".")
+		}
+	}
+	return strings.Join(segments, ".")
+}
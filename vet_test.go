@@ -0,0 +1,93 @@
+package lugo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVet(t *testing.T) {
+	type Server struct {
+		Host string `lua:"host" validate:"required"`
+		Port int    `lua:"port" validate:"min=1,max=65535"`
+	}
+	type Schema struct {
+		Server   Server   `lua:"server"`
+		Replicas []Server `lua:"replicas"`
+		LogLevel string   `lua:"log_level" validate:"oneof=debug info warn error"`
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`server = {
+    prot = 8080,
+    port = 70000,
+}
+replicas = {
+    { host = "r1", port = 1 },
+    { port = 2, zone = "b" },
+}
+log_level = "verbose"
+extra = true
+function helper() end
+`), 0644))
+
+	cfg := New()
+	defer cfg.Close()
+	require.NoError(t, cfg.DoString(`existing = 1`))
+
+	issues, err := cfg.Vet(context.Background(), path, Schema{})
+	require.NoError(t, err)
+
+	var paths, rules []string
+	for _, issue := range issues {
+		paths = append(paths, issue.Path)
+		rules = append(rules, issue.Rule)
+	}
+	assert.Equal(t, []string{"extra", "log_level", "replicas.1.host", "replicas.1.zone", "server.host", "server.port", "server.prot"}, paths)
+	assert.Equal(t, []string{"", "oneof", "required", "", "required", "max", ""}, rules)
+	assert.Equal(t, "unknown key 'server.prot'", issues[6].Message)
+	assert.Equal(t, path+":2", issues[6].Position)
+	assert.Equal(t, path+":7", issues[3].Position)
+
+	// Vetting leaves the config untouched
+	assert.Equal(t, []string{"existing"}, cfg.ListGlobals())
+
+	// Type mismatches are reported for every offending value
+	require.NoError(t, os.WriteFile(path, []byte(`server = { host = 1, port = "http" }`), 0644))
+	issues, err = cfg.Vet(context.Background(), path, &Schema{})
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+	assert.Equal(t, "server.host", issues[0].Path)
+	assert.Equal(t, "server.port", issues[1].Path)
+
+	// Slice elements are numbered from 0 in paths but found at their Lua index
+	require.NoError(t, os.WriteFile(path, []byte(`replicas = {
+    { host = "r1", port = 1 },
+    { host = "r2", port = 0 },
+}
+`), 0644))
+	issues, err = cfg.Vet(context.Background(), path, struct {
+		Replicas []Server `lua:"replicas"`
+	}{})
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Equal(t, "replicas.1.port", issues[0].Path)
+	assert.Equal(t, path+":3", issues[0].Position)
+
+	// A file that fails to run is a single issue
+	require.NoError(t, os.WriteFile(path, []byte(`server = {`), 0644))
+	issues, err = cfg.Vet(context.Background(), path, Schema{})
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Empty(t, issues[0].Path)
+
+	_, err = cfg.Vet(context.Background(), filepath.Join(dir, "missing.lua"), Schema{})
+	assert.True(t, IsErrorCode(err, ErrIO))
+	_, err = cfg.Vet(context.Background(), path, "not a struct")
+	assert.True(t, IsErrorCode(err, ErrInvalidType))
+}
@@ -30,6 +30,10 @@ type ConfigWatcher struct {
 	stopChan chan struct{}
 	mu       sync.RWMutex
 	wcfg     WatcherConfig
+	logger   *zap.Logger
+
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // NewWatcher creates a new configuration watcher
@@ -52,6 +56,7 @@ func (c *Config) NewWatcher(wcfg WatcherConfig) (*ConfigWatcher, error) {
 		paths:    make(map[string]bool),
 		stopChan: make(chan struct{}),
 		wcfg:     wcfg,
+		logger:   c.logger,
 	}
 
 	for _, path := range wcfg.Paths {
@@ -84,6 +89,7 @@ func (w *ConfigWatcher) AddPath(path string) error {
 	}
 
 	w.paths[absPath] = true
+	w.logger.Debug("watching path", zap.String("path", absPath))
 	return nil
 }
 
@@ -109,10 +115,13 @@ func (w *ConfigWatcher) RemovePath(path string) error {
 	return nil
 }
 
-// Close stops watching for changes
+// Close stops watching for changes. It is safe to call more than once.
 func (w *ConfigWatcher) Close() error {
-	close(w.stopChan)
-	return w.watcher.Close()
+	w.closeOnce.Do(func() {
+		close(w.stopChan)
+		w.closeErr = w.watcher.Close()
+	})
+	return w.closeErr
 }
 
 func (w *ConfigWatcher) watch() {
@@ -135,13 +144,17 @@ func (w *ConfigWatcher) watch() {
 		var err error
 		for _, path := range paths {
 			if err = w.cfg.LoadFile(context.Background(), path); err != nil {
-				w.cfg.logger.Error("failed to reload config",
+				w.logger.Error("failed to reload config",
 					zap.String("path", path),
 					zap.Error(err))
 				break
 			}
 		}
 
+		if err == nil {
+			w.logger.Debug("config reloaded", zap.Int("paths", len(paths)))
+		}
+
 		if w.wcfg.OnReload != nil {
 			w.wcfg.OnReload(err)
 		}
@@ -165,7 +178,7 @@ func (w *ConfigWatcher) watch() {
 			if !ok {
 				return
 			}
-			w.cfg.logger.Error("watcher error", zap.Error(err))
+			w.logger.Error("watcher error", zap.Error(err))
 
 		case <-w.stopChan:
 			if debounceTimer != nil {